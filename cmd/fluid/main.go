@@ -45,6 +45,59 @@ func main() {
 			Category: "client",
 			Action:   fluidMount,
 		},
+		{
+			Name:     "flush",
+			Usage:    "force the fluidfs server to flush dirty files",
+			Category: "client",
+			Action:   fluidFlush,
+			Flags: []cli.Flag{
+				cli.BoolFlag{
+					Name:  "status, s",
+					Usage: "report the number of dirty files without flushing",
+				},
+			},
+		},
+		{
+			Name:      "du",
+			Usage:     "report the space used by files in a mount point",
+			Category:  "client",
+			ArgsUsage: "[path ...]",
+			Action:    fluidDu,
+		},
+		{
+			Name:      "import",
+			Usage:     "import a local directory tree into a mount point",
+			Category:  "client",
+			ArgsUsage: "srcdir prefix",
+			Action:    fluidImport,
+		},
+		{
+			Name:      "export",
+			Usage:     "export a mount point to a local directory",
+			Category:  "client",
+			ArgsUsage: "prefix destdir",
+			Action:    fluidExport,
+		},
+		{
+			Name:      "reload-fstab",
+			Usage:     "reload the fstab, mounting added and unmounting removed mount points",
+			Category:  "client",
+			ArgsUsage: "[path]",
+			Action:    fluidReloadFStab,
+		},
+		{
+			Name:      "maintenance",
+			Usage:     "quiesce modifications for a backup or migration, or resume them",
+			Category:  "client",
+			ArgsUsage: "on|off",
+			Action:    fluidMaintenance,
+			Flags: []cli.Flag{
+				cli.BoolFlag{
+					Name:  "status, s",
+					Usage: "report if fluidfs is in maintenance mode",
+				},
+			},
+		},
 		{
 			Name:     "web",
 			Usage:    "get the url to the fluidfs web interface",
@@ -125,6 +178,102 @@ func fluidMount(c *cli.Context) error {
 	return nil
 }
 
+// Post a flush request to the FluidFS server or query the flush status.
+func fluidFlush(c *cli.Context) error {
+	if err := client.Flush(c.Bool("status")); err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+
+	return nil
+}
+
+// Get the space used by each path, or the current directory if none given.
+func fluidDu(c *cli.Context) error {
+	paths := []string(c.Args())
+	if len(paths) == 0 {
+		paths = []string{"."}
+	}
+
+	for _, path := range paths {
+		if err := client.Du(path); err != nil {
+			return cli.NewExitError(err.Error(), 1)
+		}
+	}
+
+	return nil
+}
+
+// Post a request to import a local directory tree into a mount point.
+func fluidImport(c *cli.Context) error {
+	if c.NArg() != 2 {
+		return cli.NewExitError("import requires source directory and prefix arguments", 1)
+	}
+
+	args := c.Args()
+	if err := client.Import(args[0], args[1]); err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+
+	return nil
+}
+
+// Post a request to export a mount point to a local directory.
+func fluidExport(c *cli.Context) error {
+	if c.NArg() != 2 {
+		return cli.NewExitError("export requires prefix and destination directory arguments", 1)
+	}
+
+	args := c.Args()
+	if err := client.Export(args[0], args[1]); err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+
+	return nil
+}
+
+// Post a request to reload the fstab from the path or the configured fstab.
+func fluidReloadFStab(c *cli.Context) error {
+	if c.NArg() > 1 {
+		return cli.NewExitError("reload-fstab takes at most one fstab path argument", 1)
+	}
+
+	if err := client.ReloadFStab(c.Args().First()); err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+
+	return nil
+}
+
+// Post a request to enter or leave maintenance mode or query its status.
+func fluidMaintenance(c *cli.Context) error {
+	status := c.Bool("status")
+	if status {
+		if c.NArg() != 0 {
+			return cli.NewExitError("maintenance --status takes no arguments", 1)
+		}
+	} else if c.NArg() != 1 {
+		return cli.NewExitError("specify on or off to enter or leave maintenance mode", 1)
+	}
+
+	var enabled bool
+	if !status {
+		switch fluid.Regularize(c.Args().First()) {
+		case "on":
+			enabled = true
+		case "off":
+			enabled = false
+		default:
+			return cli.NewExitError(fmt.Sprintf("unknown maintenance mode '%s', specify on or off", c.Args().First()), 1)
+		}
+	}
+
+	if err := client.Maintenance(enabled, status); err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+
+	return nil
+}
+
 // Post a request to get the address of the web interface and open a browser.
 func fluidWeb(c *cli.Context) error {
 	if err := client.Web(); err != nil {
@@ -20,28 +20,87 @@ func main() {
 	app.Usage = "A highly consistent distributed filesystem."
 	app.Version = fluid.PackageVersion()
 
+	// Free up -v for the verbose flag
+	cli.VersionFlag = cli.BoolFlag{
+		Name:  "version",
+		Usage: "print the version",
+	}
+
 	// Global flags
 	app.Flags = []cli.Flag{
 		cli.StringFlag{
 			Name:  "c, config",
 			Usage: "specify the path to a yaml configuration",
 		},
+		cli.BoolFlag{
+			Name:  "v, verbose",
+			Usage: "log debug messages regardless of the configured level",
+		},
+		cli.BoolFlag{
+			Name:  "q, quiet",
+			Usage: "only log warnings and errors regardless of the configured level",
+		},
 	}
 
-	// Function run before every single command
-	app.Before = initFluid
-
 	// Define the commands available to this helper.
 	app.Commands = []cli.Command{
 		{
 			Name:   "start",
 			Usage:  "start the fluidfs replica",
+			Before: initFluid,
 			Action: startReplica,
 		},
 		{
-			Name:   "config",
-			Usage:  "print the configuration and exit",
-			Action: printConfig,
+			Name:      "init",
+			Usage:     "interactively create a configuration file",
+			ArgsUsage: "[path]",
+			Action:    initConfig,
+		},
+		{
+			Name:      "config",
+			Usage:     "print the configuration and exit",
+			ArgsUsage: "[path]",
+			Before:    initConfigFluid,
+			Action:    printConfig,
+			Flags: []cli.Flag{
+				cli.BoolFlag{
+					Name:  "init",
+					Usage: "write a starter configuration to the path or ~/.fluidfs/config.yml",
+				},
+			},
+		},
+		{
+			Name:   "migrate-blobs",
+			Usage:  "copy blobs from one storage directory to another",
+			Before: initFluid,
+			Action: migrateBlobs,
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "from, f",
+					Usage: "storage `path` to copy from (default is the configured storage)",
+				},
+				cli.StringFlag{
+					Name:  "to, t",
+					Usage: "storage `path` to copy blobs to",
+				},
+				cli.IntFlag{
+					Name:  "workers, w",
+					Usage: "number of blobs to copy concurrently",
+					Value: fluid.DefaultMigrationWorkers,
+				},
+			},
+		},
+		{
+			Name:   "errors",
+			Usage:  "list the error codes and their meanings",
+			Action: listErrors,
+		},
+		{
+			Name:      "storage-stats",
+			Usage:     "report the blob size distribution and storage tree shape",
+			ArgsUsage: "[path]",
+			Before:    initFluid,
+			Action:    storageStats,
 		},
 	}
 
@@ -49,14 +108,28 @@ func main() {
 	app.Run(os.Args)
 }
 
+// Run before the commands that require the configuration and the fstab. The
+// init and errors commands do not, so that they work on a fresh machine.
 func initFluid(c *cli.Context) error {
-	if err := fluid.Init(c.String("config")); err != nil {
+	if err := fluid.Init(c.GlobalString("config")); err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+
+	if _, err := fluid.SetVerbosity(c.GlobalBool("verbose"), c.GlobalBool("quiet")); err != nil {
 		return cli.NewExitError(err.Error(), 1)
 	}
 
 	return nil
 }
 
+// Writing a starter configuration does not require an existing one.
+func initConfigFluid(c *cli.Context) error {
+	if c.Bool("init") {
+		return nil
+	}
+	return initFluid(c)
+}
+
 func startReplica(c *cli.Context) error {
 	if err := fluid.Run(); err != nil {
 		return cli.NewExitError(err.Error(), 1)
@@ -65,7 +138,69 @@ func startReplica(c *cli.Context) error {
 	return nil
 }
 
-func printConfig(c *cli.Context) {
+func initConfig(c *cli.Context) error {
+	path, err := fluid.RunWizard(c.Args().First(), os.Stdin, os.Stdout)
+	if err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+
+	fmt.Printf("wrote configuration to %s\n", path)
+	return nil
+}
+
+func printConfig(c *cli.Context) error {
+	// Write the configuration to disk if requested
+	if c.Bool("init") {
+		path, err := fluid.InitConfig(c.Args().First(), c.GlobalString("config"))
+		if err != nil {
+			return cli.NewExitError(err.Error(), 1)
+		}
+
+		fmt.Printf("wrote configuration to %s\n", path)
+		return nil
+	}
+
 	// Print the configuration and exit
 	fmt.Println(fluid.ShowConfig())
+	return nil
+}
+
+func migrateBlobs(c *cli.Context) error {
+	if c.String("to") == "" {
+		return cli.NewExitError("specify the storage path to migrate blobs to", 1)
+	}
+
+	// Report the progress of the migration on a single line.
+	progress := func(report fluid.MigrationReport) {
+		fmt.Printf("\r%s", report)
+	}
+
+	report, err := fluid.MigrateBlobs(c.String("from"), c.String("to"), c.Int("workers"), progress)
+	if report.Total > 0 {
+		fmt.Println()
+	}
+
+	if err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+
+	fmt.Println(report)
+	return nil
+}
+
+func storageStats(c *cli.Context) error {
+	stats, err := fluid.StorageStatistics(c.Args().First())
+	if err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+
+	fmt.Println(stats)
+	return nil
+}
+
+func listErrors(c *cli.Context) error {
+	for _, code := range fluid.ErrorCodes() {
+		fmt.Printf("%3d  %-24s %s\n", code.Code, code.Name, code.Description)
+	}
+	return nil
 }
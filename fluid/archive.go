@@ -0,0 +1,230 @@
+// Streams subtrees of a file system to clients as tar or zip archives.
+
+package fluid
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"fmt"
+	"io"
+	"net/http"
+	"path/filepath"
+
+	"bazil.org/fuse"
+)
+
+// Archive formats that subtrees can be downloaded as.
+const (
+	ArchiveTar = "tar"
+	ArchiveZip = "zip"
+)
+
+// Size of the buffer that the data of files is copied into the archive with.
+const archiveBufferSize = 32 * 1024
+
+//===========================================================================
+// Subtree Archives
+//===========================================================================
+
+// Archive describes a subtree of the file system to be written as a tar or
+// zip archive. The entries are listed when the archive is created, but the
+// data of each file is only copied as it is written, a buffer at a time, so
+// that the file system is only locked while each buffer is filled and the
+// archive is never held in memory. Files are held in memory rather than in
+// blobs, so their data is copied from the file rather than read from disk.
+type Archive struct {
+	Name    string         // The name of the top level entry of the archive
+	Format  string         // Either ArchiveTar or ArchiveZip
+	fs      *FileSystem    // The file system the entries belong to
+	entries []archiveEntry // The entries of the subtree in traversal order
+}
+
+// An entity in the archive, named relative to the parent of the subtree.
+type archiveEntry struct {
+	name  string    // Slash separated path of the entry in the archive
+	attrs fuse.Attr // The attributes of the entity when it was listed
+	file  *File     // The file to read data from, nil for directories
+}
+
+// Archive lists the subtree at the path relative to the root of the file
+// system for writing as an archive in the specified format. The subtree is
+// the top level entry in the archive; the root is named by the prefix.
+func (fs *FileSystem) Archive(path, format string) (*Archive, error) {
+	format = Regularize(format)
+	if format != ArchiveTar && format != ArchiveZip {
+		return nil, fmt.Errorf("unknown archive format: '%s'", format)
+	}
+
+	fs.Lock()
+	defer fs.Unlock()
+
+	ent, err := fs.lookup(path)
+	if err != nil {
+		return nil, err
+	}
+
+	archive := &Archive{Name: ent.GetNode().Name, Format: format, fs: fs}
+	if ent == Entity(fs.root) {
+		archive.Name = fs.mount.Prefix
+	}
+
+	base := ent.Path()
+	err = traverse(ent, func(child Entity) error {
+		rel, err := filepath.Rel(base, child.Path())
+		if err != nil {
+			return err
+		}
+
+		entry := archiveEntry{
+			name:  filepath.ToSlash(filepath.Join(archive.Name, rel)),
+			attrs: child.GetNode().Attrs,
+		}
+
+		if file, ok := child.(*File); ok {
+			entry.file = file
+		}
+
+		archive.entries = append(archive.entries, entry)
+		return nil
+	}, make(map[uint64]bool))
+
+	if err != nil {
+		return nil, err
+	}
+
+	return archive, nil
+}
+
+// Filename returns the name of the archive file, e.g. "docs.tar".
+func (a *Archive) Filename() string {
+	return a.Name + "." + a.Format
+}
+
+// Header sets the content type and disposition of the archive download.
+func (a *Archive) Header(h http.Header) {
+	switch a.Format {
+	case ArchiveTar:
+		h.Set(HeaderContentTypeKey, "application/x-tar")
+	case ArchiveZip:
+		h.Set(HeaderContentTypeKey, "application/zip")
+	}
+
+	h.Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", a.Filename()))
+}
+
+// Stream writes the archive to w, preserving the modes and modification
+// times of its entries.
+func (a *Archive) Stream(w io.Writer) error {
+	switch a.Format {
+	case ArchiveTar:
+		return a.writeTar(w)
+	case ArchiveZip:
+		return a.writeZip(w)
+	default:
+		return fmt.Errorf("unknown archive format: '%s'", a.Format)
+	}
+}
+
+// Write the entries as a tar archive.
+func (a *Archive) writeTar(w io.Writer) error {
+	tw := tar.NewWriter(w)
+	for _, entry := range a.entries {
+		hdr := &tar.Header{
+			Name:    entry.name,
+			Mode:    int64(entry.attrs.Mode.Perm()),
+			Uid:     int(entry.attrs.Uid),
+			Gid:     int(entry.attrs.Gid),
+			ModTime: entry.attrs.Mtime,
+		}
+
+		if entry.file == nil {
+			hdr.Name += "/"
+			hdr.Typeflag = tar.TypeDir
+		} else {
+			hdr.Typeflag = tar.TypeReg
+			hdr.Size = a.size(entry.file)
+		}
+
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+
+		if entry.file != nil {
+			if err := a.copyData(tw, entry.file, hdr.Size); err != nil {
+				return err
+			}
+		}
+	}
+
+	return tw.Close()
+}
+
+// Write the entries as a zip archive, compressing the data of files.
+func (a *Archive) writeZip(w io.Writer) error {
+	zw := zip.NewWriter(w)
+	for _, entry := range a.entries {
+		hdr := &zip.FileHeader{Name: entry.name}
+		hdr.SetModTime(entry.attrs.Mtime)
+
+		if entry.file == nil {
+			hdr.Name += "/"
+			hdr.SetMode(entry.attrs.Mode)
+		} else {
+			hdr.Method = zip.Deflate
+			hdr.SetMode(entry.attrs.Mode.Perm())
+		}
+
+		fw, err := zw.CreateHeader(hdr)
+		if err != nil {
+			return err
+		}
+
+		if entry.file != nil {
+			if err := a.copyData(fw, entry.file, a.size(entry.file)); err != nil {
+				return err
+			}
+		}
+	}
+
+	return zw.Close()
+}
+
+// Returns the current size of the data of the file.
+func (a *Archive) size(file *File) int64 {
+	a.fs.Lock()
+	defer a.fs.Unlock()
+	return int64(len(file.Data))
+}
+
+// Copy size bytes of the data of the file to w a buffer at a time, holding
+// the file system lock only while each buffer is filled, so that the file can
+// be written while the archive is streamed. Exactly size bytes are written
+// since the size may already be in the header of the entry; if the file was
+// truncated in the meantime the rest of the entry is filled with zeros.
+func (a *Archive) copyData(w io.Writer, file *File, size int64) error {
+	buf := make([]byte, archiveBufferSize)
+	for off := int64(0); off < size; {
+		chunk := buf
+		if size-off < int64(len(chunk)) {
+			chunk = chunk[:size-off]
+		}
+
+		a.fs.Lock()
+		n := 0
+		if off < int64(len(file.Data)) {
+			n = copy(chunk, file.Data[off:])
+		}
+		a.fs.Unlock()
+
+		for i := n; i < len(chunk); i++ {
+			chunk[i] = 0
+		}
+
+		if _, err := w.Write(chunk); err != nil {
+			return err
+		}
+		off += int64(len(chunk))
+	}
+
+	return nil
+}
@@ -0,0 +1,267 @@
+package fluid_test
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"time"
+
+	"bazil.org/fuse"
+	"golang.org/x/net/context"
+
+	. "github.com/bbengfort/fluidfs/fluid"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Archive", func() {
+
+	var ctx context.Context
+	var fs *FileSystem
+	var root *Dir
+	var mtime time.Time
+	var contents map[string]string
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		fs = newFileSystem()
+		node, err := fs.Root()
+		Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+		root = node.(*Dir)
+
+		// Create the subtree to archive along with a file outside of it
+		create := func(dir *Dir, name string, mode os.FileMode, data string) {
+			createFile(dir, name, mode, []byte(data)).Attrs.Mtime = mtime
+		}
+
+		mtime = time.Date(2017, 4, 1, 12, 0, 0, 0, time.UTC)
+		contents = map[string]string{
+			"docs/a.txt":       "the quick brown fox",
+			"docs/notes/b.txt": randString(8192),
+			"docs/notes/c.sh":  "#!/bin/sh",
+		}
+
+		docs := mkdir(root, "docs", 0750)
+		notes := mkdir(docs, "notes", 0750)
+		create(docs, "a.txt", 0644, contents["docs/a.txt"])
+		create(notes, "b.txt", 0600, contents["docs/notes/b.txt"])
+		create(notes, "c.sh", 0755, contents["docs/notes/c.sh"])
+		create(root, "outside.txt", 0644, "not in the subtree")
+	})
+
+	// Stream the archive of the subtree into a buffer.
+	stream := func(path, format string) *bytes.Buffer {
+		archive, err := fs.Archive(path, format)
+		Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+
+		buf := new(bytes.Buffer)
+		Ω(archive.Stream(buf)).Should(Succeed())
+		return buf
+	}
+
+	It("should stream a subtree as a tar archive", func() {
+		tr := tar.NewReader(stream("docs", ArchiveTar))
+
+		dirs := make([]string, 0)
+		files := make(map[string]string)
+		for {
+			hdr, err := tr.Next()
+			if err == io.EOF {
+				break
+			}
+			Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+
+			if hdr.Typeflag == tar.TypeDir {
+				dirs = append(dirs, hdr.Name)
+				Ω(hdr.Mode).Should(Equal(int64(0750)))
+				continue
+			}
+
+			data, err := ioutil.ReadAll(tr)
+			Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+			files[hdr.Name] = string(data)
+			Ω(hdr.ModTime.Equal(mtime)).Should(BeTrue(), "%s mtime is %s", hdr.Name, hdr.ModTime)
+
+			if hdr.Name == "docs/notes/c.sh" {
+				Ω(hdr.Mode).Should(Equal(int64(0755)))
+			}
+		}
+
+		Ω(dirs).Should(ConsistOf("docs/", "docs/notes/"))
+		Ω(files).Should(Equal(contents))
+	})
+
+	It("should stream a subtree as a zip archive", func() {
+		buf := stream("docs", ArchiveZip)
+		zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+		Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+
+		dirs := make([]string, 0)
+		files := make(map[string]string)
+		for _, zf := range zr.File {
+			if zf.FileInfo().IsDir() {
+				dirs = append(dirs, zf.Name)
+				continue
+			}
+
+			rc, err := zf.Open()
+			Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+			data, err := ioutil.ReadAll(rc)
+			Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+			rc.Close()
+
+			files[zf.Name] = string(data)
+			Ω(zf.ModTime().Equal(mtime)).Should(BeTrue(), "%s mtime is %s", zf.Name, zf.ModTime())
+
+			if zf.Name == "docs/notes/b.txt" {
+				Ω(zf.Mode()).Should(Equal(os.FileMode(0600)))
+			}
+		}
+
+		Ω(dirs).Should(ConsistOf("docs/", "docs/notes/"))
+		Ω(files).Should(Equal(contents))
+	})
+
+	It("should stream files larger than the copy buffer", func() {
+		data := randString(100*1024 + 17)
+		req := &fuse.CreateRequest{Name: "large.bin", Mode: 0644}
+		node, _, err := root.Create(ctx, req, new(fuse.CreateResponse))
+		Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+		wreq := &fuse.WriteRequest{Data: []byte(data)}
+		Ω(node.(*File).Write(ctx, wreq, new(fuse.WriteResponse))).Should(Succeed())
+
+		for _, format := range []string{ArchiveTar, ArchiveZip} {
+			buf := stream("large.bin", format)
+
+			var streamed []byte
+			if format == ArchiveTar {
+				tr := tar.NewReader(buf)
+				hdr, err := tr.Next()
+				Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+				Ω(hdr.Size).Should(Equal(int64(len(data))))
+				streamed, err = ioutil.ReadAll(tr)
+				Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+			} else {
+				zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+				Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+				Ω(zr.File).Should(HaveLen(1))
+				rc, err := zr.File[0].Open()
+				Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+				streamed, err = ioutil.ReadAll(rc)
+				Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+				rc.Close()
+			}
+
+			Ω(string(streamed)).Should(Equal(data), "%s data does not match", format)
+		}
+	})
+
+	It("should name the root of the mount point by its prefix", func() {
+		archive, err := fs.Archive("", ArchiveZip)
+		Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+		Ω(archive.Filename()).Should(Equal("testing.zip"))
+
+		tr := tar.NewReader(stream("/", ArchiveTar))
+		names := make([]string, 0)
+		for {
+			hdr, err := tr.Next()
+			if err == io.EOF {
+				break
+			}
+			Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+			names = append(names, hdr.Name)
+		}
+
+		Ω(names).Should(ContainElement("testing/"))
+		Ω(names).Should(ContainElement("testing/outside.txt"))
+		Ω(names).Should(ContainElement("testing/docs/notes/b.txt"))
+	})
+
+	It("should set the download headers", func() {
+		archive, err := fs.Archive("docs", "TAR")
+		Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+
+		header := make(http.Header)
+		archive.Header(header)
+		Ω(header.Get("Content-Type")).Should(Equal("application/x-tar"))
+		Ω(header.Get("Content-Disposition")).Should(Equal(`attachment; filename="docs.tar"`))
+	})
+
+	It("should require a known format and an existing path", func() {
+		_, err := fs.Archive("docs", "rar")
+		Ω(err).Should(MatchError("unknown archive format: 'rar'"))
+
+		_, err = fs.Archive("missing", ArchiveTar)
+		Ω(err).Should(MatchError("missing: no such file or directory"))
+	})
+
+	It("should stream archives through the API", func() {
+		api := new(C2SAPI)
+		Ω(api.Init()).Should(Succeed())
+		api.AddHandler("/archive", func(r *http.Request) (int, interface{}, error) {
+			archive, err := fs.Archive("docs", ArchiveTar)
+			return http.StatusOK, archive, err
+		})
+
+		w := httptest.NewRecorder()
+		api.Router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/archive", nil))
+		Ω(w.Code).Should(Equal(http.StatusOK))
+		Ω(w.Header().Get("Content-Type")).Should(Equal("application/x-tar"))
+
+		hdr, err := tar.NewReader(w.Body).Next()
+		Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+		Ω(hdr.Name).Should(Equal("docs/"))
+	})
+
+	It("should not apply the server write timeout to streams", func() {
+		api := new(C2SAPI)
+		Ω(api.Init()).Should(Succeed())
+		api.AddHandler("/slow", func(r *http.Request) (int, interface{}, error) {
+			return http.StatusOK, &slowStream{parts: 3, delay: 150 * time.Millisecond}, nil
+		})
+
+		srv := httptest.NewUnstartedServer(api.Router)
+		srv.Config.WriteTimeout = 100 * time.Millisecond
+		srv.Start()
+		defer srv.Close()
+
+		rep, err := http.Get(srv.URL + "/slow")
+		Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+		defer rep.Body.Close()
+
+		body, err := ioutil.ReadAll(rep.Body)
+		Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+		Ω(string(body)).Should(Equal("part\npart\npart\n"))
+	})
+
+})
+
+// A stream that writes its parts slowly, flushing each to the client.
+type slowStream struct {
+	parts int
+	delay time.Duration
+}
+
+func (s *slowStream) Header(h http.Header) {
+	h.Set("Content-Type", "text/plain")
+}
+
+func (s *slowStream) Stream(w io.Writer) error {
+	for i := 0; i < s.parts; i++ {
+		time.Sleep(s.delay)
+		if _, err := io.WriteString(w, "part\n"); err != nil {
+			return err
+		}
+		if f, ok := w.(http.Flusher); ok {
+			f.Flush()
+		}
+	}
+	return nil
+}
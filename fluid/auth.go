@@ -0,0 +1,69 @@
+// Bearer token authentication middleware for the C2S API.
+
+package fluid
+
+import (
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"strings"
+)
+
+// Authorization scheme expected in the Authorization header.
+const bearerScheme = "Bearer "
+
+//===========================================================================
+// Authentication Middleware
+//===========================================================================
+
+// Authenticate wraps a handler so that requests must present the bearer
+// token from the security configuration in the Authorization header. If no
+// token is configured, all requests are passed through. If public reads are
+// allowed, then GET and HEAD requests are passed through without a token.
+// Requests that are not authorized receive a 401 error response.
+func Authenticate(conf *SecurityConfig, inner http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !conf.Enabled() || (conf.PublicReads && isReadMethod(r.Method)) {
+			inner.ServeHTTP(w, r)
+			return
+		}
+
+		if err := conf.Authorize(r); err != nil {
+			data := &ErrorResponse{Code: http.StatusUnauthorized, Error: err.Error()}
+			ctype, body, _ := marshalResponse(r.Header.Get(HeaderAcceptKey), data)
+
+			w.Header().Set("WWW-Authenticate", `Bearer realm="fluidfs"`)
+			w.Header().Set(HeaderContentTypeKey, ctype)
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write(body)
+			return
+		}
+
+		inner.ServeHTTP(w, r)
+	})
+}
+
+// Authorize returns an error if the request does not have the bearer token.
+func (conf *SecurityConfig) Authorize(r *http.Request) error {
+	auth := r.Header.Get(HeaderAuthorizationKey)
+	if auth == "" {
+		return errors.New("authorization required")
+	}
+
+	if !strings.HasPrefix(auth, bearerScheme) {
+		return errors.New("authorization must use a bearer token")
+	}
+
+	// Compare in constant time so the token can't be discovered by timing.
+	token := strings.TrimPrefix(auth, bearerScheme)
+	if subtle.ConstantTimeCompare([]byte(token), []byte(conf.Token)) != 1 {
+		return errors.New("invalid authorization token")
+	}
+
+	return nil
+}
+
+// Returns true if the method does not modify the state of the replica.
+func isReadMethod(method string) bool {
+	return method == http.MethodGet || method == http.MethodHead
+}
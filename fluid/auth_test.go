@@ -0,0 +1,205 @@
+package fluid_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	. "github.com/bbengfort/fluidfs/fluid"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Authentication", func() {
+
+	const token = "correct-horse-battery-staple"
+
+	var api *C2SAPI
+
+	BeforeEach(func() {
+		api = &C2SAPI{Security: &SecurityConfig{Token: token}}
+		Ω(api.Init()).Should(Succeed())
+	})
+
+	// Serve a request with the authorization header to the API router.
+	serve := func(method, endpoint, auth string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, endpoint, nil)
+		if auth != "" {
+			req.Header.Set(HeaderAuthorizationKey, auth)
+		}
+
+		w := httptest.NewRecorder()
+		api.Router.ServeHTTP(w, req)
+		return w
+	}
+
+	It("should require a token for API requests", func() {
+		w := serve(http.MethodPost, FlushEndpoint, "")
+		Ω(w.Code).Should(Equal(http.StatusUnauthorized))
+		Ω(w.Header().Get("WWW-Authenticate")).Should(HavePrefix("Bearer"))
+		Ω(w.Body.String()).Should(MatchJSON(`{"code": 401, "error": "authorization required"}`))
+
+		w = serve(http.MethodGet, StatusEndpoint, "")
+		Ω(w.Code).Should(Equal(http.StatusUnauthorized))
+	})
+
+	It("should reject an incorrect token", func() {
+		w := serve(http.MethodPost, FlushEndpoint, "Bearer incorrect-horse-battery")
+		Ω(w.Code).Should(Equal(http.StatusUnauthorized))
+
+		w = serve(http.MethodPost, FlushEndpoint, "Basic "+token)
+		Ω(w.Code).Should(Equal(http.StatusUnauthorized))
+	})
+
+	It("should allow requests with the correct token", func() {
+		w := serve(http.MethodPost, FlushEndpoint, "Bearer "+token)
+		Ω(w.Code).Should(Equal(http.StatusOK))
+
+		w = serve(http.MethodGet, StatusEndpoint, "Bearer "+token)
+		Ω(w.Code).Should(Equal(http.StatusOK))
+	})
+
+	It("should allow public reads when configured", func() {
+		api.Security.PublicReads = true
+
+		w := serve(http.MethodGet, StatusEndpoint, "")
+		Ω(w.Code).Should(Equal(http.StatusOK))
+
+		w = serve(http.MethodPost, FlushEndpoint, "")
+		Ω(w.Code).Should(Equal(http.StatusUnauthorized))
+	})
+
+	It("should not require a token for the probes", func() {
+		w := serve(http.MethodGet, HealthEndpoint, "")
+		Ω(w.Code).Should(Equal(http.StatusOK))
+	})
+
+	It("should not require a token if none is configured", func() {
+		api.Security.Token = ""
+
+		w := serve(http.MethodPost, FlushEndpoint, "")
+		Ω(w.Code).Should(Equal(http.StatusOK))
+	})
+
+	It("should require a token for the profiling endpoints", func() {
+		api.EnableProfiling()
+
+		w := serve(http.MethodGet, ProfilingEndpoint, "")
+		Ω(w.Code).Should(Equal(http.StatusUnauthorized))
+
+		w = serve(http.MethodGet, ProfilingEndpoint+"cmdline", "")
+		Ω(w.Code).Should(Equal(http.StatusUnauthorized))
+
+		w = serve(http.MethodGet, ProfilingEndpoint, "Bearer "+token)
+		Ω(w.Code).Should(Equal(http.StatusOK))
+	})
+
+	It("should send the token from the CLI client", func() {
+		server := httptest.NewServer(api.Router)
+		defer server.Close()
+
+		// Point the client at the test server
+		surl, err := url.Parse(server.URL)
+		Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+		_, port, err := net.SplitHostPort(surl.Host)
+		Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+
+		cli := new(CLIClient)
+		cli.Init()
+		cli.PID.Port, err = strconv.Atoi(port)
+		Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+
+		cli.Token = ""
+		Ω(cli.Post(FlushEndpoint, nil, new(FlushResponse))).Should(MatchError("authorization required"))
+
+		cli.Token = token
+		Ω(cli.Post(FlushEndpoint, nil, new(FlushResponse))).Should(Succeed())
+	})
+
+	Describe("configuration", func() {
+
+		It("should not allow short tokens", func() {
+			conf := &SecurityConfig{Token: "secret"}
+			Ω(conf.Validate()).Should(MatchError("Improperly configured: the api token must be at least 16 characters."))
+		})
+
+		It("should only allow transfers with a token or a transfer root", func() {
+			conf := new(SecurityConfig)
+			Ω(conf.AllowTransfer("/tmp/backup")).Should(MatchError("imports and exports require an api token or a transfer root"))
+
+			conf.Token = token
+			Ω(conf.AllowTransfer("/tmp/backup")).Should(Succeed())
+		})
+
+		It("should only allow transfers inside of the transfer root", func() {
+			tmpDir, err := ioutil.TempDir("", "fluid-transfer")
+			Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+			defer os.RemoveAll(tmpDir)
+
+			transfers := filepath.Join(tmpDir, "transfers")
+			Ω(os.Mkdir(transfers, 0755)).Should(Succeed())
+
+			conf := &SecurityConfig{Token: token, TransferRoot: transfers}
+			Ω(conf.Validate()).Should(Succeed())
+
+			Ω(conf.AllowTransfer(transfers)).Should(Succeed())
+			Ω(conf.AllowTransfer(filepath.Join(transfers, "backup", "new"))).Should(Succeed())
+			Ω(conf.AllowTransfer(tmpDir)).Should(MatchError(ContainSubstring("is not in the transfer root")))
+			Ω(conf.AllowTransfer(filepath.Join(transfers, "..", "other"))).ShouldNot(Succeed())
+			Ω(conf.AllowTransfer(transfers + "-other")).ShouldNot(Succeed())
+
+			// Symlinks cannot be used to escape the transfer root
+			Ω(os.Symlink(tmpDir, filepath.Join(transfers, "escape"))).Should(Succeed())
+			Ω(conf.AllowTransfer(filepath.Join(transfers, "escape", "backup"))).ShouldNot(Succeed())
+		})
+
+		It("should require an absolute transfer root", func() {
+			conf := &SecurityConfig{TransferRoot: "transfers"}
+			Ω(conf.Validate()).Should(MatchError("Improperly configured: transfer root 'transfers' is not an absolute path."))
+		})
+
+		It("should not write a token from the environment", func() {
+			tmpDir, err := ioutil.TempDir("", "fluid-token")
+			Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+			defer os.RemoveAll(tmpDir)
+
+			defer os.Setenv(EnvToken, os.Getenv(EnvToken))
+			Ω(os.Setenv(EnvToken, "environment-secret-token")).Should(Succeed())
+
+			conf := new(Config)
+			Ω(conf.Defaults()).Should(Succeed())
+			conf.Security.Token = "configured-secret-token"
+			Ω(conf.Environ()).Should(Succeed())
+			Ω(conf.Security.Token).Should(Equal("environment-secret-token"))
+
+			path := filepath.Join(tmpDir, "config.yml")
+			Ω(conf.Write(path)).Should(Succeed())
+
+			data, err := ioutil.ReadFile(path)
+			Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+			Ω(string(data)).ShouldNot(ContainSubstring("environment-secret-token"))
+			Ω(string(data)).Should(ContainSubstring("configured-secret-token"))
+
+			// The configuration is only readable by the user
+			info, err := os.Stat(path)
+			Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+			Ω(info.Mode().Perm()).Should(Equal(os.FileMode(ModeConfig)))
+		})
+
+		It("should allow authentication to be disabled", func() {
+			conf := new(SecurityConfig)
+			conf.Defaults()
+			Ω(conf.Validate()).Should(Succeed())
+			Ω(conf.Enabled()).Should(BeFalse())
+		})
+
+	})
+
+})
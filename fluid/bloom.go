@@ -0,0 +1,187 @@
+// Bloom filter summaries of blob hashes for blob set reconciliation.
+
+package fluid
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// DefaultFalsePositiveRate is the target false positive rate of blob filters
+// if one is not specified.
+const DefaultFalsePositiveRate = 0.01
+
+//===========================================================================
+// Blob Filter
+//===========================================================================
+
+// BlobFilter is a bloom filter of blob hashes that summarizes a blob store
+// far more compactly than a list of its hashes. A filter never reports that
+// a hash it contains is missing, but it may report that a missing hash is
+// contained at the configured false positive rate. A peer receiving the
+// filter can therefore quickly determine which of its blobs are definitely
+// missing from the sender, falling back to exact checks for the rest.
+type BlobFilter struct {
+	bits []uint64 // The bit array of the filter
+	m    uint64   // The number of bits in the filter
+	k    uint64   // The number of hash functions
+	n    uint64   // The number of hashes added to the filter
+}
+
+// NewBlobFilter creates a filter sized to hold n hashes with the specified
+// false positive rate, which must be between 0 and 1 exclusive. If the rate
+// is zero then the DefaultFalsePositiveRate is used.
+func NewBlobFilter(n int, fpr float64) (*BlobFilter, error) {
+	if fpr == 0 {
+		fpr = DefaultFalsePositiveRate
+	}
+
+	if fpr < 0 || fpr >= 1 {
+		return nil, fmt.Errorf("false positive rate %f must be between 0 and 1", fpr)
+	}
+
+	if n < 1 {
+		n = 1
+	}
+
+	// Compute the optimal number of bits and hash functions
+	m := math.Ceil(-1 * float64(n) * math.Log(fpr) / (math.Ln2 * math.Ln2))
+	k := math.Max(1, math.Floor(m/float64(n)*math.Ln2+0.5))
+
+	return &BlobFilter{
+		bits: make([]uint64, (uint64(m)+63)/64),
+		m:    uint64(m),
+		k:    uint64(k),
+	}, nil
+}
+
+// Add a blob hash to the filter.
+func (f *BlobFilter) Add(hash string) {
+	h1, h2 := f.hashes(hash)
+	for i := uint64(0); i < f.k; i++ {
+		idx := (h1 + i*h2) % f.m
+		f.bits[idx/64] |= 1 << (idx % 64)
+	}
+	f.n++
+}
+
+// Contains returns false if the blob hash is definitely not in the filter,
+// or true if the hash is probably in the filter.
+func (f *BlobFilter) Contains(hash string) bool {
+	h1, h2 := f.hashes(hash)
+	for i := uint64(0); i < f.k; i++ {
+		idx := (h1 + i*h2) % f.m
+		if f.bits[idx/64]&(1<<(idx%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Missing returns the hashes that are definitely not in the filter.
+func (f *BlobFilter) Missing(hashes []string) []string {
+	missing := make([]string, 0)
+	for _, hash := range hashes {
+		if !f.Contains(hash) {
+			missing = append(missing, hash)
+		}
+	}
+	return missing
+}
+
+// Len returns the number of hashes that have been added to the filter.
+func (f *BlobFilter) Len() int {
+	return int(f.n)
+}
+
+// MarshalBinary encodes the filter so that it can be sent to a peer.
+func (f *BlobFilter) MarshalBinary() ([]byte, error) {
+	data := make([]byte, 24+8*len(f.bits))
+	binary.BigEndian.PutUint64(data[0:], f.m)
+	binary.BigEndian.PutUint64(data[8:], f.k)
+	binary.BigEndian.PutUint64(data[16:], f.n)
+
+	for i, word := range f.bits {
+		binary.BigEndian.PutUint64(data[24+8*i:], word)
+	}
+
+	return data, nil
+}
+
+// UnmarshalBinary decodes a filter that was encoded with MarshalBinary.
+func (f *BlobFilter) UnmarshalBinary(data []byte) error {
+	if len(data) < 24 || (len(data)-24)%8 != 0 {
+		return errors.New("could not decode blob filter: bad length")
+	}
+
+	f.m = binary.BigEndian.Uint64(data[0:])
+	f.k = binary.BigEndian.Uint64(data[8:])
+	f.n = binary.BigEndian.Uint64(data[16:])
+	f.bits = make([]uint64, (len(data)-24)/8)
+
+	if f.m == 0 || f.k == 0 || uint64(len(f.bits)) != (f.m+63)/64 {
+		return errors.New("could not decode blob filter: bad header")
+	}
+
+	for i := range f.bits {
+		f.bits[i] = binary.BigEndian.Uint64(data[24+8*i:])
+	}
+
+	return nil
+}
+
+// Compute two independent hashes of the blob hash to use double hashing to
+// simulate the k hash functions of the filter.
+func (f *BlobFilter) hashes(hash string) (uint64, uint64) {
+	h1 := fnv.New64a()
+	h1.Write([]byte(hash))
+
+	h2 := fnv.New64()
+	h2.Write([]byte(hash))
+
+	// Ensure the second hash is odd so that it is never zero.
+	return h1.Sum64(), h2.Sum64() | 1
+}
+
+//===========================================================================
+// Package Filter Helpers
+//===========================================================================
+
+// FilterBlobs creates a filter of all of the blob hashes in the storage
+// directory with the specified false positive rate.
+func FilterBlobs(dataDir string, fpr float64) (*BlobFilter, error) {
+	hashes := make([]string, 0)
+
+	visit := func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if !info.IsDir() && filepath.Ext(path) == BlobExt {
+			hashes = append(hashes, strings.TrimSuffix(info.Name(), BlobExt))
+		}
+
+		return nil
+	}
+
+	if err := filepath.Walk(dataDir, visit); err != nil {
+		return nil, fmt.Errorf("could not enumerate blobs in %s: %s", dataDir, err.Error())
+	}
+
+	filter, err := NewBlobFilter(len(hashes), fpr)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, hash := range hashes {
+		filter.Add(hash)
+	}
+
+	return filter, nil
+}
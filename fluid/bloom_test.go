@@ -0,0 +1,104 @@
+package fluid_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	. "github.com/bbengfort/fluidfs/fluid"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("BlobFilter", func() {
+
+	It("should require a valid false positive rate", func() {
+		_, err := NewBlobFilter(100, 1.5)
+		Ω(err).Should(HaveOccurred())
+
+		_, err = NewBlobFilter(100, -0.1)
+		Ω(err).Should(HaveOccurred())
+
+		_, err = NewBlobFilter(100, 0)
+		Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+	})
+
+	It("should round trip through its binary encoding", func() {
+		filter, err := NewBlobFilter(100, 0.01)
+		Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+		filter.Add("foo")
+		filter.Add("bar")
+
+		data, err := filter.MarshalBinary()
+		Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+
+		decoded := new(BlobFilter)
+		Ω(decoded.UnmarshalBinary(data)).Should(Succeed())
+		Ω(decoded.Len()).Should(Equal(2))
+		Ω(decoded.Contains("foo")).Should(BeTrue())
+		Ω(decoded.Contains("bar")).Should(BeTrue())
+		Ω(decoded.Missing([]string{"foo", "baz"})).Should(Equal([]string{"baz"}))
+
+		Ω(decoded.UnmarshalBinary(data[:20])).ShouldNot(Succeed())
+	})
+
+	Context("over a populated store", func() {
+
+		var err error
+		var dataDir string
+		var hashes []string
+
+		BeforeEach(func() {
+			dataDir, err = ioutil.TempDir("", TempDirPrefix)
+			Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+
+			config := new(StorageConfig)
+			config.Defaults()
+			config.Path = dataDir
+
+			chunker, err := NewChunker([]byte(randString(1048576)), config)
+			Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+
+			hashes = make([]string, 0)
+			for chunker.Next() {
+				blob := chunker.Chunk().(*Blob)
+				Ω(blob.Save(dataDir)).Should(Succeed())
+				hashes = append(hashes, blob.Hash())
+			}
+		})
+
+		AfterEach(func() {
+			Ω(os.RemoveAll(dataDir)).Should(Succeed())
+		})
+
+		It("should have no false negatives", func() {
+			filter, err := FilterBlobs(dataDir, 0.01)
+			Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+			Ω(filter.Len()).Should(Equal(len(hashes)))
+
+			for _, hash := range hashes {
+				Ω(filter.Contains(hash)).Should(BeTrue())
+			}
+
+			Ω(filter.Missing(hashes)).Should(BeEmpty())
+		})
+
+		It("should have a bounded false positive rate", func() {
+			filter, err := FilterBlobs(dataDir, 0.01)
+			Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+
+			trials := 10000
+			positives := 0
+			for i := 0; i < trials; i++ {
+				if filter.Contains(randString(64)) {
+					positives++
+				}
+			}
+
+			Ω(float64(positives) / float64(trials)).Should(BeNumerically("<", 0.03))
+		})
+
+	})
+
+})
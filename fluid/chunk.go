@@ -28,13 +28,14 @@ const (
 
 // Specifies the names of available hashing algorithms
 const (
-	MD5      = "md5"
-	SHA1     = "sha1"
-	SHA224   = "sha224"
-	SHA256   = "sha256"
-	CityHash = "cityhash"
-	Murmur   = "murmur"
-	SipHash  = "siphash"
+	MD5       = "md5"
+	SHA1      = "sha1"
+	SHA224    = "sha224"
+	SHA256    = "sha256"
+	CityHash  = "cityhash"
+	Murmur    = "murmur"
+	Murmur128 = "murmur128"
+	SipHash   = "siphash"
 )
 
 // Specifies the storage permission modes
@@ -52,11 +53,19 @@ const (
 	RKPrime      = uint64(31)
 )
 
+// Factor by which normalized chunking makes boundaries less likely before the
+// target block size and more likely after it.
+const normalizationFactor = uint64(4)
+
 // Names of available chunking mechanisms for validation
 var chunkingMethodNames = []string{VariableLengthChunking, FixedLengthChunking}
 
 // Names of hashing algorithms for validation
-var hashingAlgorithmNames = []string{MD5, SHA1, SHA224, SHA256, Murmur}
+var hashingAlgorithmNames = []string{MD5, SHA1, SHA224, SHA256, Murmur, Murmur128}
+
+// Names of hashing algorithms whose output depends on the architecture of
+// the replica, which must not be used by replicas with mixed architectures.
+var archDependentHashing = []string{Murmur}
 
 //===========================================================================
 // Chunking Structs and Interfaces
@@ -104,6 +113,7 @@ type Chunker interface {
 	Reset() error   // Reset the chunker to its original state
 	BlockSize() int // Returns the underlying size (or maximum size) of chunks
 	Offset() uint64 // The length of the current chunk from the current index
+	Count() int     // Returns the number of chunks without creating them, then resets
 }
 
 // NewChunker uses a storage configuration to initialize the appropriate
@@ -129,6 +139,7 @@ func NewChunker(data []byte, config *StorageConfig) (Chunker, error) {
 			blockSize:    uint64(config.BlockSize),
 			minBlockSize: uint64(config.MinBlockSize),
 			maxBlockSize: uint64(config.MaxBlockSize),
+			normalized:   config.NormalizedChunking,
 		}
 	default:
 		return nil, fmt.Errorf("unknown chunking method: '%s'", config.Chunking)
@@ -161,7 +172,8 @@ func NewDefaultChunker(data []byte) (Chunker, error) {
 // CreateHasher evalautes the string passed in and initializes the appropriate
 // hashing algorithm for use with the SetHasher function of a Chunker.
 // TODO: Make hashingAlgorithmNames a map of names to functions instead of switch.
-// NOTE: This function optimizes murmur for x64 architecutres and will result in different values for x86 vs. x64 systems!
+// NOTE: murmur reads its input as native words and will result in different
+// values on big and little endian systems! Use murmur128 for mixed replicas.
 func CreateHasher(name string) (func() hash.Hash, error) {
 	switch name {
 	case MD5:
@@ -177,6 +189,8 @@ func CreateHasher(name string) (func() hash.Hash, error) {
 			// NOTE: this function optimizes murmur3 for x64 architectures
 			return murmur3.New128()
 		}, nil
+	case Murmur128:
+		return NewMurmur128, nil
 	default:
 		return nil, fmt.Errorf("unknown hashing algorithm: '%s'", name)
 	}
@@ -285,6 +299,58 @@ func (b *Blob) Load(path string) error {
 	return nil
 }
 
+// Stat a blob at a path on disk without loading its data into memory. The
+// path, hash, and size of the blob are populated so that the data can be
+// streamed from disk using the Reader or WriteTo methods.
+func (b *Blob) Stat(path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+
+	if info.IsDir() {
+		return fmt.Errorf("%s is a directory not a blob", path)
+	}
+
+	// Store the path and size on the blob.
+	b.path = path
+	b.size = int(info.Size())
+
+	// Compute the hash from the filename if it has the .blob extension
+	if filepath.Ext(path) == BlobExt {
+		_, filename := filepath.Split(path)
+		b.hash = strings.TrimSuffix(filename, BlobExt)
+	}
+
+	return nil
+}
+
+// Reader opens the blob file on disk and returns a reader that streams the
+// blob data rather than loading it all into memory. The caller must close
+// the reader when done. The blob must have been loaded, stat'd or saved so
+// that the path to the blob on disk is known.
+func (b *Blob) Reader() (io.ReadCloser, error) {
+	return os.Open(b.Path())
+}
+
+// WriteTo writes the blob data to w, implementing the io.WriterTo interface.
+// If the data has been loaded it is written directly, otherwise the data is
+// streamed from the blob file on disk without being buffered in memory.
+func (b *Blob) WriteTo(w io.Writer) (int64, error) {
+	if b.data != nil {
+		n, err := w.Write(b.data)
+		return int64(n), err
+	}
+
+	r, err := b.Reader()
+	if err != nil {
+		return 0, err
+	}
+	defer r.Close()
+
+	return io.Copy(w, r)
+}
+
 // Save a blob to a directory on disk. The blob will be stored in a file name
 // based on its hash to prevent duplicates and collisions and to allow for
 // easy lookups on disk.
@@ -296,8 +362,21 @@ func (b *Blob) Load(path string) error {
 //
 // This method will therefore create the appropriate subdirectories and join
 // it to the root dataDir passed into the function and write the file to that
-// location so Blob.Load can use the filename to retrieve the hash.
+// location so Blob.Load can use the filename to retrieve the hash. The blob
+// and its directories are written with the permissions in the storage
+// configuration.
+//
+// The blob is written to a temporary file that is renamed into place, so a
+// crash while saving never leaves a partial blob whose filename claims the
+// hash of the complete data.
 func (b *Blob) Save(dataDir string) error {
+	blobPerm, dirPerm := storagePerms()
+	return b.SaveMode(dataDir, blobPerm, dirPerm)
+}
+
+// SaveMode saves the blob to a directory on disk as Save does, writing the
+// blob file with blobPerm and creating the directories with dirPerm.
+func (b *Blob) SaveMode(dataDir string, blobPerm, dirPerm os.FileMode) error {
 
 	// Compute the path with the data directory
 	// NOTE: this stores the data directory with the blob; is this a problem for serialization?
@@ -308,15 +387,21 @@ func (b *Blob) Save(dataDir string) error {
 	}
 
 	// Ensure the parent directory exists
-	dir := filepath.Dir(path)
-	_ = os.MkdirAll(dir, ModeStorageDir)
-
-	// Write the file
-	if err := ioutil.WriteFile(path, b.data, ModeBlob); err != nil {
+	if err := os.MkdirAll(filepath.Dir(path), dirPerm); err != nil {
 		return err
 	}
 
-	return nil
+	// Write the file atomically so that partial blobs are never visible
+	return writeFileAtomic(path, b.data, blobPerm)
+}
+
+// Returns the permissions of blob files and storage directories from the
+// storage configuration, or the default permissions if it is not loaded.
+func storagePerms() (blobPerm, dirPerm os.FileMode) {
+	if config == nil || config.Storage == nil {
+		return ModeBlob, ModeStorageDir
+	}
+	return config.Storage.BlobPerm(), config.Storage.DirPerm()
 }
 
 //===========================================================================
@@ -413,6 +498,19 @@ func (c *FixedLengthChunker) Reset() error {
 	return nil
 }
 
+// Count returns the number of chunks that iteration will yield, computed
+// arithmetically from the length of the data. Count resets the chunker.
+func (c *FixedLengthChunker) Count() int {
+	c.Reset()
+
+	// The last block absorbs any remainder smaller than the minimum size.
+	if c.blockSize <= 0 || len(c.data) < c.minBlockSize {
+		return 0
+	}
+
+	return (len(c.data)-c.minBlockSize)/c.blockSize + 1
+}
+
 // BlockSize simply returns the fixed length in bytes of the blobs being
 // chunked. Note that the last block in the chunker may have a different size
 // between minBlockSize and blockSize + minBlockSize.
@@ -460,6 +558,7 @@ type RabinKarpChunker struct {
 	blockSize    uint64   // The target size of the blobs
 	minBlockSize uint64   // The minimium size for a blob
 	maxBlockSize uint64   // The maximum size for a blob
+	normalized   bool     // Use normalized chunking to tighten blob sizes
 	saved        []uint64 // Internal window  state
 }
 
@@ -488,7 +587,7 @@ func (c *RabinKarpChunker) Offset() uint64 {
 		hash = (hash-c.saved[uint64(c.data[c.index+offset-c.hashLen])])*c.bytes + uint64(c.data[c.index+offset])
 		offset++
 
-		if ((offset >= c.minBlockSize) && (hash%c.blockSize) == 1) || (offset >= c.maxBlockSize) {
+		if ((offset >= c.minBlockSize) && (hash%c.divisor(offset)) == 1) || (offset >= c.maxBlockSize) {
 			return offset
 		}
 	}
@@ -496,12 +595,38 @@ func (c *RabinKarpChunker) Offset() uint64 {
 	return offset
 }
 
+// Computes the divisor of the rolling hash that determines the likelihood
+// of a boundary at the offset. Normally a boundary occurs about once per
+// block size bytes. With normalized chunking, boundaries are less likely
+// before the target block size and more likely after it, which tightens the
+// distribution of blob sizes around the target.
+func (c *RabinKarpChunker) divisor(offset uint64) uint64 {
+	if !c.normalized {
+		return c.blockSize
+	}
+
+	if offset < c.blockSize {
+		return c.blockSize * normalizationFactor
+	}
+
+	// The divisor must be greater than one for a boundary to be possible.
+	if divisor := c.blockSize / normalizationFactor; divisor > 1 {
+		return divisor
+	}
+	return 2
+}
+
 // Next advances the chunker by computing the next blob and modifing its
 // internal indices so that it can be returned via the Chunk() method. Next()
 // advances the chunker in a variable length mechanism as per the Rabin-Karp
 // algorithm.
 func (c *RabinKarpChunker) Next() bool {
 
+	// Without data the first chunk would be empty and Next would never end.
+	if len(c.data) == 0 {
+		return false
+	}
+
 	if c.index == 0 && c.offset == 0 {
 		c.offset = c.Offset()
 		return true
@@ -558,6 +683,20 @@ func (c *RabinKarpChunker) Reset() error {
 	return nil
 }
 
+// Count returns the number of chunks that iteration will yield by finding
+// the chunk boundaries with the rolling hash, without hashing or creating
+// the blobs. Count resets the chunker.
+func (c *RabinKarpChunker) Count() int {
+	c.Reset()
+
+	count := 0
+	for c.Next() {
+		count++
+	}
+
+	return count
+}
+
 // BlockSize returns the largest possible blob size in bytes. Since Rabin-Karp
 // chunking implements variable length chunks, the size of each Blob must be
 // checked on the Blob data structure. However this method will return the
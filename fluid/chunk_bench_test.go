@@ -0,0 +1,160 @@
+package fluid_test
+
+import (
+	"fmt"
+	"math/rand"
+	"os"
+	"testing"
+
+	. "github.com/bbengfort/fluidfs/fluid"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// Benchmarks of chunking and hashing throughput, run with:
+//
+//     go test -run NONE -bench . ./fluid/
+//
+// Baseline throughput on a single core Intel Xeon linux/amd64 VM, which is
+// only a rough guide since results vary by hardware:
+//
+//     BenchmarkFixedChunker/64KB     1178 MB/s
+//     BenchmarkFixedChunker/1MB      1190 MB/s
+//     BenchmarkRabinKarp/64KB         278 MB/s
+//     BenchmarkRabinKarp/1MB          250 MB/s
+//     BenchmarkHashers/md5            651 MB/s
+//     BenchmarkHashers/sha1          1523 MB/s
+//     BenchmarkHashers/sha224        1335 MB/s
+//     BenchmarkHashers/sha256        1403 MB/s
+//     BenchmarkHashers/murmur        5387 MB/s
+
+// Seed for the random data so that every benchmark run chunks the same data.
+const benchSeed = 42
+
+// Representative data sizes for the chunking benchmarks.
+var benchSizes = []int{64 * 1024, 1024 * 1024}
+
+// Create deterministic random data of length n. A separate source is used so
+// that seeding it doesn't make the random data in other tests deterministic.
+func benchData(n int) []byte {
+	rng := rand.New(rand.NewSource(benchSeed))
+	data := make([]byte, n)
+	for i := range data {
+		data[i] = byte(letterRunes[rng.Intn(len(letterRunes))])
+	}
+	return data
+}
+
+// Format a size in bytes for the name of a sub-benchmark.
+func benchName(n int) string {
+	if n >= 1024*1024 {
+		return fmt.Sprintf("%dMB", n/(1024*1024))
+	}
+	return fmt.Sprintf("%dKB", n/1024)
+}
+
+// Returns a benchmark function that chunks the data with the chunking method
+// and computes the signature of every blob, as is done when files are stored.
+func benchChunker(chunking string, data []byte) func(*testing.B) {
+	return func(b *testing.B) {
+		conf := new(StorageConfig)
+		conf.Defaults()
+		conf.Chunking = chunking
+
+		b.SetBytes(int64(len(data)))
+		b.ResetTimer()
+
+		for i := 0; i < b.N; i++ {
+			chunker, err := NewChunker(data, conf)
+			if err != nil {
+				b.Fatal(err)
+			}
+
+			for chunker.Next() {
+				chunker.Chunk()
+			}
+		}
+	}
+}
+
+// BenchmarkFixedChunker measures the throughput of fixed length chunking.
+func BenchmarkFixedChunker(b *testing.B) {
+	for _, size := range benchSizes {
+		b.Run(benchName(size), benchChunker(FixedLengthChunking, benchData(size)))
+	}
+}
+
+// BenchmarkRabinKarp measures the throughput of variable length chunking.
+func BenchmarkRabinKarp(b *testing.B) {
+	for _, size := range benchSizes {
+		b.Run(benchName(size), benchChunker(VariableLengthChunking, benchData(size)))
+	}
+}
+
+// BenchmarkHashers measures the throughput of the blob hashing algorithms.
+func BenchmarkHashers(b *testing.B) {
+	data := benchData(64 * 1024)
+	for _, name := range []string{MD5, SHA1, SHA224, SHA256, Murmur} {
+		hasher, err := CreateHasher(name)
+		if err != nil {
+			b.Fatal(err)
+		}
+
+		b.Run(name, func(b *testing.B) {
+			b.SetBytes(int64(len(data)))
+			for i := 0; i < b.N; i++ {
+				hash := hasher()
+				hash.Write(data)
+				hash.Sum(nil)
+			}
+		})
+	}
+}
+
+//===========================================================================
+// Throughput Regression Guard
+//===========================================================================
+
+// EnvThroughput enables the throughput regression guard when set, e.g.
+//
+//	FLUIDFS_THROUGHPUT=1 go test ./fluid/
+//
+// The guard is not run by default since the floors are absolute and fail
+// under the race detector or on a busy CI machine.
+const EnvThroughput = "FLUIDFS_THROUGHPUT"
+
+// Run the benchmark and return its throughput in MB/s.
+func throughput(bench func(*testing.B)) float64 {
+	result := testing.Benchmark(bench)
+	if result.T <= 0 {
+		return 0
+	}
+	return float64(result.Bytes) * float64(result.N) / 1e6 / result.T.Seconds()
+}
+
+var _ = Describe("Chunking Throughput", func() {
+
+	// The floors are an order of magnitude below the baseline throughput so
+	// that slow or busy machines do not fail, while a regression such as an
+	// accidental quadratic loop still does.
+	const fixedFloor = 50.0    // MB/s
+	const variableFloor = 20.0 // MB/s
+
+	BeforeEach(func() {
+		if os.Getenv(EnvThroughput) == "" || testing.Short() {
+			Skip(fmt.Sprintf("throughput is only measured if %s is set", EnvThroughput))
+		}
+	})
+
+	It("should chunk fixed length blobs above the throughput floor", func() {
+		mbps := throughput(benchChunker(FixedLengthChunking, benchData(1024*1024)))
+		Ω(mbps).Should(BeNumerically(">", fixedFloor), "fixed chunking at %0.1f MB/s", mbps)
+	})
+
+	It("should chunk variable length blobs above the throughput floor", func() {
+		mbps := throughput(benchChunker(VariableLengthChunking, benchData(1024*1024)))
+		Ω(mbps).Should(BeNumerically(">", variableFloor), "variable chunking at %0.1f MB/s", mbps)
+	})
+
+})
@@ -1,12 +1,14 @@
 package fluid_test
 
 import (
+	"bytes"
 	"crypto/rand"
 	"fmt"
 	"io/ioutil"
 	"os"
 	"path/filepath"
 	"strings"
+	"syscall"
 
 	. "github.com/bbengfort/fluidfs/fluid"
 
@@ -19,7 +21,7 @@ var _ = Describe("Chunk", func() {
 	Describe("hashing algorithm selection", func() {
 
 		It("should select a hashing function based on name", func() {
-			names := []string{"md5", "sha1", "sha224", "sha256", "murmur"}
+			names := []string{"md5", "sha1", "sha224", "sha256", "murmur", "murmur128"}
 			for _, name := range names {
 				hasher, err := CreateHasher(name)
 				Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
@@ -164,6 +166,60 @@ var _ = Describe("Chunk", func() {
 
 		})
 
+		It("should be able to create portable murmur hashes", func() {
+
+			// Create the signed chunker
+			chunker := new(SignedChunker)
+			hasher, err := CreateHasher(Murmur128)
+			Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+			chunker.SetHasher(hasher)
+
+			// The fixtures match murmur on little endian architectures.
+			var sigTests = []struct {
+				value  []byte
+				signed string
+			}{
+				{short, "pOalFoebLnN03XVP31S9gw"},
+				{text1k, "UjjAhpjBZFykusXZEZ-2hw"},
+				{text4k, "mhX6H2FP3bbWAubrGgZsSw"},
+				{text12k, "WDAF3cGMHlygHhuNN8xEVg"},
+			}
+
+			for _, st := range sigTests {
+				Ω(chunker.Signature(st.value)).Should(Equal(st.signed))
+			}
+
+		})
+
+		It("should compute the same portable murmur hash from partial writes", func() {
+			data := []byte(randString(1031))
+
+			expected := NewMurmur128()
+			expected.Write(data)
+
+			for _, size := range []int{1, 7, 15, 16, 17, 100} {
+				hash := NewMurmur128()
+				for i := 0; i < len(data); i += size {
+					end := i + size
+					if end > len(data) {
+						end = len(data)
+					}
+					hash.Write(data[i:end])
+				}
+
+				Ω(hash.Sum(nil)).Should(Equal(expected.Sum(nil)), "writes of %d bytes", size)
+			}
+
+			// Every tail length is hashed the same as the vendored murmur3
+			reference, _ := CreateHasher(Murmur)
+			for n := 0; n <= 32; n++ {
+				a, b := NewMurmur128(), reference()
+				a.Write(data[:n])
+				b.Write(data[:n])
+				Ω(a.Sum(nil)).Should(Equal(b.Sum(nil)), "%d bytes", n)
+			}
+		})
+
 		It("should return same hash no matter the hash ordering", func() {
 
 			// create random data of 7168 bytes each
@@ -178,7 +234,7 @@ var _ = Describe("Chunk", func() {
 			}
 
 			// Evaluate all hashing algorithms
-			names := []string{MD5, SHA1, SHA224, SHA256, Murmur}
+			names := []string{MD5, SHA1, SHA224, SHA256, Murmur, Murmur128}
 			for _, name := range names {
 
 				signer := new(SignedChunker)
@@ -345,6 +401,157 @@ var _ = Describe("Chunk", func() {
 			Ω(blob).Should(Equal(newBlob))
 		})
 
+		It("should stat a blob on disk without loading the data", func() {
+			data := []byte(randString(4096))
+			blob, err := MakeBlob(data, SHA256)
+			Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+			Ω(blob.Save(tmpDir)).Should(Succeed())
+
+			statted := new(Blob)
+			Ω(statted.Stat(blob.Path())).Should(Succeed())
+			Ω(statted.Data()).Should(BeNil())
+			Ω(statted.Size()).Should(Equal(len(data)))
+			Ω(statted.Hash()).Should(Equal(blob.Hash()))
+			Ω(statted.Path()).Should(Equal(blob.Path()))
+
+			Ω(new(Blob).Stat(filepath.Join(tmpDir, "missing.blob"))).ShouldNot(Succeed())
+		})
+
+		It("should save a blob with the configured permissions", func() {
+			conf := new(StorageConfig)
+			conf.Defaults()
+			conf.BlobMode = "0640"
+			conf.DirMode = "0750"
+			Ω(conf.BlobPerm()).Should(Equal(os.FileMode(0640)))
+			Ω(conf.DirPerm()).Should(Equal(os.FileMode(0750)))
+
+			blob, err := MakeBlob([]byte(randString(4096)), SHA256)
+			Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+			Ω(blob.SaveMode(tmpDir, conf.BlobPerm(), conf.DirPerm())).Should(Succeed())
+
+			info, err := os.Stat(blob.Path())
+			Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+			Ω(info.Mode().Perm()).Should(Equal(os.FileMode(0640)))
+
+			info, err = os.Stat(filepath.Dir(blob.Path()))
+			Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+			Ω(info.Mode().Perm()).Should(Equal(os.FileMode(0750)))
+		})
+
+		It("should save blobs subject to the umask", func() {
+			defer syscall.Umask(syscall.Umask(027))
+
+			blob, err := MakeBlob([]byte(randString(4096)), SHA256)
+			Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+			Ω(blob.SaveMode(tmpDir, 0644, 0755)).Should(Succeed())
+
+			info, err := os.Stat(blob.Path())
+			Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+			Ω(info.Mode().Perm()).Should(Equal(os.FileMode(0640)))
+
+			info, err = os.Stat(filepath.Dir(blob.Path()))
+			Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+			Ω(info.Mode().Perm()).Should(Equal(os.FileMode(0750)))
+		})
+
+		It("should save blobs atomically without leaving temporary files", func() {
+			blob, err := MakeBlob([]byte(randString(4096)), SHA256)
+			Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+
+			// Simulate a crash that left a truncated blob at the final path
+			path := filepath.Join(tmpDir, blob.Path())
+			Ω(os.MkdirAll(filepath.Dir(path), ModeStorageDir)).Should(Succeed())
+			Ω(ioutil.WriteFile(path, blob.Data()[:100], ModeBlob)).Should(Succeed())
+
+			// Saving replaces the partial blob with the complete data
+			Ω(blob.Save(tmpDir)).Should(Succeed())
+			data, err := ioutil.ReadFile(path)
+			Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+			Ω(data).Should(Equal(blob.Data()))
+
+			// Only the blob remains in its directory
+			infos, err := ioutil.ReadDir(filepath.Dir(path))
+			Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+			Ω(infos).Should(HaveLen(1))
+			Ω(infos[0].Name()).Should(Equal(blob.Hash() + BlobExt))
+		})
+
+		It("should not count an interrupted save as a blob", func() {
+			blob, err := MakeBlob([]byte(randString(4096)), SHA256)
+			Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+			Ω(blob.Save(tmpDir)).Should(Succeed())
+
+			// Simulate a crash that left the temporary file of a save behind
+			other, err := MakeBlob([]byte(randString(4096)), SHA256)
+			Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+			tmp := filepath.Join(filepath.Dir(blob.Path()), "."+other.Hash()+BlobExt+".123456")
+			Ω(ioutil.WriteFile(tmp, other.Data()[:100], ModeBlob)).Should(Succeed())
+
+			filter, err := FilterBlobs(tmpDir, 0.01)
+			Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+			Ω(filter.Len()).Should(Equal(1))
+			Ω(filter.Contains(blob.Hash())).Should(BeTrue())
+
+			stats, err := StorageStatistics(tmpDir)
+			Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+			Ω(stats.Blobs).Should(Equal(1))
+		})
+
+		It("should stream the same bytes as the data from a reader", func() {
+			data := []byte(randString(16384))
+			blob, err := MakeBlob(data, SHA256)
+			Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+			Ω(blob.Save(tmpDir)).Should(Succeed())
+
+			statted := new(Blob)
+			Ω(statted.Stat(blob.Path())).Should(Succeed())
+
+			reader, err := statted.Reader()
+			Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+
+			rdata, err := ioutil.ReadAll(reader)
+			Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+			Ω(rdata).Should(Equal(blob.Data()))
+
+			// The underlying file should be closed by the reader
+			Ω(reader.Close()).Should(Succeed())
+			_, err = reader.Read(make([]byte, 1))
+			Ω(err).Should(HaveOccurred())
+			Ω(reader.Close()).ShouldNot(Succeed())
+		})
+
+		It("should return an error streaming a blob that isn't on disk", func() {
+			blob, err := MakeBlob([]byte(randString(512)), SHA256)
+			Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+
+			_, err = blob.Reader()
+			Ω(err).Should(HaveOccurred())
+		})
+
+		It("should write the blob data to a writer", func() {
+			data := []byte(randString(16384))
+			blob, err := MakeBlob(data, SHA256)
+			Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+			Ω(blob.Save(tmpDir)).Should(Succeed())
+
+			// Write from the data in memory
+			buf := new(bytes.Buffer)
+			n, err := blob.WriteTo(buf)
+			Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+			Ω(n).Should(Equal(int64(len(data))))
+			Ω(buf.Bytes()).Should(Equal(data))
+
+			// Write by streaming from disk
+			statted := new(Blob)
+			Ω(statted.Stat(blob.Path())).Should(Succeed())
+
+			buf.Reset()
+			n, err = statted.WriteTo(buf)
+			Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+			Ω(n).Should(Equal(int64(len(data))))
+			Ω(buf.Bytes()).Should(Equal(data))
+		})
+
 	})
 
 	Describe("fixed length chunking", func() {
@@ -388,6 +595,27 @@ var _ = Describe("Chunk", func() {
 
 		})
 
+		It("should count the chunks without creating them", func() {
+			for _, size := range []int{0, 100, 128, 512, 640, 641, 2048, 2100} {
+				chunker, err := NewChunker([]byte(randString(size)), config)
+				Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+
+				count := 0
+				for chunker.Next() {
+					chunker.Chunk()
+					count++
+				}
+
+				Ω(chunker.Count()).Should(Equal(count), "%d bytes", size)
+
+				// The chunker is reset and can be iterated again
+				for chunker.Next() {
+					count--
+				}
+				Ω(count).Should(BeZero())
+			}
+		})
+
 		It("should create even length chunks", func() {
 			data := []byte(randString(2048))
 			chunker, err := NewChunker(data, config)
@@ -585,6 +813,27 @@ var _ = Describe("Chunk", func() {
 
 		})
 
+		It("should count the chunks without creating them", func() {
+			for _, size := range []int{0, 100, 2048, 87542} {
+				chunker, err := NewChunker([]byte(randString(size)), config)
+				Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+
+				count := 0
+				for chunker.Next() {
+					chunker.Chunk()
+					count++
+				}
+
+				Ω(chunker.Count()).Should(Equal(count), "%d bytes", size)
+
+				// The chunker is reset and can be iterated again
+				for chunker.Next() {
+					count--
+				}
+				Ω(count).Should(BeZero())
+			}
+		})
+
 		It("should create variable length blobs", func() {
 			data := []byte(randString(87542))
 			chunker, err := NewChunker(data, config)
@@ -644,6 +893,47 @@ var _ = Describe("Chunk", func() {
 			Ω(sizes).Should(Equal(expected))
 		})
 
+		It("should tighten blob sizes around the target with normalized chunking", func() {
+			data := []byte(randString(1048576))
+
+			// Compute the variance of the blob sizes, ignoring the last blob.
+			variance := func() float64 {
+				chunker, err := NewChunker(data, config)
+				Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+
+				sizes := make([]float64, 0)
+				total := 0
+				for chunker.Next() {
+					size := chunker.Chunk().Size()
+					Ω(size).Should(BeNumerically("<=", config.MaxBlockSize))
+					sizes = append(sizes, float64(size))
+					total += size
+				}
+
+				Ω(total).Should(Equal(len(data)))
+				sizes = sizes[:len(sizes)-1]
+
+				mean := 0.0
+				for _, size := range sizes {
+					mean += size / float64(len(sizes))
+				}
+
+				sumsq := 0.0
+				for _, size := range sizes {
+					sumsq += (size - mean) * (size - mean)
+				}
+				return sumsq / float64(len(sizes))
+			}
+
+			config.NormalizedChunking = false
+			standard := variance()
+
+			config.NormalizedChunking = true
+			normalized := variance()
+
+			Ω(normalized).Should(BeNumerically("<", standard))
+		})
+
 		It("should be able to iterate through chunks multiple times (call reset)", func() {
 			data := []byte(randString(32640))
 			chunker, err := NewChunker(data, config)
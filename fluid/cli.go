@@ -7,13 +7,17 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io/ioutil"
 	"net/http"
 	"net/url"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"runtime"
+	"strings"
 	"time"
+
+	"github.com/google/uuid"
 )
 
 //===========================================================================
@@ -25,6 +29,7 @@ import (
 // API to create interfaces that can make calls to the server.
 type CLIClient struct {
 	PID    *PID         // A reference to the PID file to connect to the server.
+	Token  string       // Bearer token to authenticate with the server.
 	client *http.Client // Internal HTTP Client to make requests to the server.
 }
 
@@ -32,17 +37,24 @@ type CLIClient struct {
 // the FluidFS Server. This function may return an error.
 func (c *CLIClient) Init() error {
 
+	// Create an HTTP client with a 30 second timeout.
+	c.client = &http.Client{
+		Timeout: 30 * time.Second,
+	}
+
+	// Load the API token from the configuration if one hasn't been set.
+	if c.Token == "" {
+		if conf, err := LoadConfig(""); err == nil {
+			c.Token = conf.Security.Token
+		}
+	}
+
 	// Load the PID file to detect the location to query the web service.
 	c.PID = new(PID)
 	if err := c.PID.Load(); err != nil {
 		return errors.New("Could not connect to the FluidFS server: no PID file detected.")
 	}
 
-	// Create an HTTP client with a 30 second timeout.
-	c.client = &http.Client{
-		Timeout: 30 * time.Second,
-	}
-
 	return nil
 }
 
@@ -54,15 +66,13 @@ func (c *CLIClient) Init() error {
 // running, or if there is no PID file detected, then the Status message will
 // not run because the error is caught/returned in Init().
 func (c *CLIClient) Status() error {
-	res, err := c.Get(StatusEndpoint)
-	if err != nil {
+	res := new(StatusResponse)
+	if err := c.Get(StatusEndpoint, res); err != nil {
 		return err
 	}
 
-	status := res["status"].(string)
-	timestamp := res["timestamp"].(string)
-	mounts := res["mounts"].(string)
-	fmt.Printf("FluidFS Status: %s at %s\n%s\n", status, timestamp, mounts)
+	fmt.Printf("FluidFS Status: %s at %s\n%s\n", res.Status, res.Timestamp, res.Mounts)
+	fmt.Printf("%d FUSE requests in flight, %d queued\n", res.InFlight, res.Queued)
 	return nil
 }
 
@@ -74,19 +84,161 @@ func (c *CLIClient) Status() error {
 // TODO: add mount and umount commands, see #39
 // TODO: unhack this!
 func (c *CLIClient) Mount(path string, prefix string) error {
-	data := make(JSON)
-	data["path"] = path
-	data["prefix"] = prefix
-	data["uid"] = os.Geteuid()
-	data["gid"] = os.Getegid()
+	uid := int64(os.Geteuid())
+	gid := int64(os.Getegid())
+	req := &MountRequest{Path: path, Prefix: prefix, UID: &uid, GID: &gid}
+
+	res := new(MountResponse)
+	if err := c.Post(MountEndpoint, req, res); err != nil {
+		return fmt.Errorf("could not post request to fluidfs: %s", err.Error())
+	}
+
+	fmt.Printf("created mount point for fluid://%s at %s:\n%s\n", prefix, path, res.Mount)
+	return nil
+}
+
+// Flush forces the FluidFS Server to flush all dirty files, or if status is
+// true, reports the number of dirty files without flushing them.
+func (c *CLIClient) Flush(status bool) error {
+	res := new(FlushResponse)
+
+	if status {
+		if err := c.Get(FlushStatusEndpoint, res); err != nil {
+			return err
+		}
+
+		fmt.Printf("%d files have not been flushed\n", res.Dirty)
+		return nil
+	}
+
+	if err := c.Post(FlushEndpoint, nil, res); err != nil {
+		return fmt.Errorf("could not post request to fluidfs: %s", err.Error())
+	}
+
+	fmt.Printf("flushed %d files\n", res.Flushed)
+	return nil
+}
+
+// Maintenance enters or leaves maintenance mode on the FluidFS server, or if
+// status is true, reports if the server is in maintenance mode.
+func (c *CLIClient) Maintenance(enabled, status bool) error {
+	res := new(MaintenanceResponse)
+
+	if status {
+		if err := c.Get(MaintenanceEndpoint, res); err != nil {
+			return err
+		}
+	} else {
+		req := &MaintenanceRequest{Enabled: enabled}
+		if err := c.Post(MaintenanceEndpoint, req, res); err != nil {
+			return fmt.Errorf("could not post request to fluidfs: %s", err.Error())
+		}
+	}
+
+	if !res.Enabled {
+		fmt.Println("fluidfs is not in maintenance mode")
+		return nil
+	}
+
+	if status {
+		fmt.Println("fluidfs is in maintenance mode")
+		return nil
+	}
+
+	fmt.Printf("fluidfs is in maintenance mode, flushed %d files\n", res.Flushed)
+	return nil
+}
+
+// Du reports the space used by the subtree at the path, which must be inside
+// of a mount point, in the manner of the du command.
+func (c *CLIClient) Du(path string) error {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+
+	res := new(UsageResponse)
+	if err := c.GetQuery(UsageEndpoint, url.Values{"path": {path}}, res); err != nil {
+		return err
+	}
 
-	res, err := c.Post(MountEndpoint, data)
+	fmt.Printf("%d\t%d\t%0.2fx\t%s\n", res.LogicalBytes, res.PhysicalBytes, res.DedupRatio, res.Path)
+	return nil
+}
+
+// Import posts a request to import the local directory tree at src into the
+// mount point with the prefix and reports the counts of the import.
+func (c *CLIClient) Import(src string, prefix string) error {
+	src, err := filepath.Abs(src)
 	if err != nil {
+		return err
+	}
+
+	req := &ImportRequest{Source: src, Prefix: prefix}
+	res := new(ImportResponse)
+	if err := c.Post(ImportEndpoint, req, res); err != nil {
+		return fmt.Errorf("could not post request to fluidfs: %s", err.Error())
+	}
+
+	fmt.Printf(
+		"imported %s into fluid://%s: %d files (%d bytes in %d blobs), %d directories, %d unchanged, %d ignored\n",
+		res.Source, res.Prefix, res.Files, res.Bytes, res.Blobs, res.Dirs, res.Skipped, res.Ignored,
+	)
+	return nil
+}
+
+// Export posts a request to export the mount point with the prefix to the
+// local directory at dst and reports the counts of the export.
+func (c *CLIClient) Export(prefix string, dst string) error {
+	dst, err := filepath.Abs(dst)
+	if err != nil {
+		return err
+	}
+
+	req := &ExportRequest{Prefix: prefix, Target: dst}
+	res := new(ExportResponse)
+	if err := c.Post(ExportEndpoint, req, res); err != nil {
 		return fmt.Errorf("could not post request to fluidfs: %s", err.Error())
 	}
 
-	mp := res["mount"].(string)
-	fmt.Printf("created mount point for fluid://%s at %s:\n%s\n", prefix, path, mp)
+	fmt.Printf(
+		"exported fluid://%s to %s: %d files (%d bytes), %d directories\n",
+		res.Prefix, res.Target, res.Files, res.Bytes, res.Dirs,
+	)
+	return nil
+}
+
+// ReloadFStab posts a request to reload the fstab from the path, or from the
+// configured fstab if the path is empty, and reports the changed mounts.
+func (c *CLIClient) ReloadFStab(path string) error {
+	if path != "" {
+		var err error
+		if path, err = filepath.Abs(path); err != nil {
+			return err
+		}
+	}
+
+	req := &ReloadRequest{Path: path}
+	res := new(ReloadResponse)
+	if err := c.Post(ReloadEndpoint, req, res); err != nil {
+		return fmt.Errorf("could not post request to fluidfs: %s", err.Error())
+	}
+
+	fmt.Printf("reloaded fstab from %s\n", res.Path)
+	for _, prefix := range res.Mounted {
+		fmt.Printf("  mounted fluid://%s\n", prefix)
+	}
+	for _, prefix := range res.Unmounted {
+		fmt.Printf("  unmounted fluid://%s\n", prefix)
+	}
+	fmt.Printf("%d mount points unchanged\n", len(res.Unchanged))
+
+	if len(res.Failed) > 0 {
+		for _, msg := range res.Failed {
+			fmt.Printf("  %s\n", msg)
+		}
+		return fmt.Errorf("%d mount points could not be reloaded", len(res.Failed))
+	}
 	return nil
 }
 
@@ -94,26 +246,83 @@ func (c *CLIClient) Mount(path string, prefix string) error {
 // system specific helper program to open the URL on demand. If the command
 // is unable to open the browser, it will simply ignore the exec error.
 func (c *CLIClient) Web() error {
-	var err error
 	addr := c.Endpoint(RootEndpoint).String()
 
 	// Notify the user of the web browser.
 	fmt.Printf("Access the FluidFS web interface at %s\n", addr)
 
-	switch runtime.GOOS {
-	case "linux":
-		err = exec.Command("xdg-open", addr).Start()
-	case "windows", "darwin":
-		err = exec.Command("open", addr).Start()
+	if err := OpenBrowser(addr, Platform(), startCommand); err != nil {
+		fmt.Printf("Could not open web browser: %s\n", err.Error())
+	}
+
+	return nil
+}
+
+//===========================================================================
+// Web Browser Helpers
+//===========================================================================
+
+// Platform returns the operating system the client is running on, which is
+// runtime.GOOS except on the Windows Subsystem for Linux, which is "wsl".
+func Platform() string {
+	if runtime.GOOS == "linux" && isWSL() {
+		return "wsl"
+	}
+	return runtime.GOOS
+}
+
+// BrowserCommands returns the commands that can open the url in a web
+// browser on the specified platform, in the order they should be tried.
+func BrowserCommands(platform, url string) ([][]string, error) {
+	switch platform {
+	case "darwin":
+		return [][]string{{"open", url}}, nil
+	case "windows":
+		return [][]string{{"cmd", "/c", "start", url}}, nil
+	case "wsl":
+		return [][]string{{"wslview", url}, {"explorer.exe", url}}, nil
+	case "linux", "freebsd", "openbsd", "netbsd", "dragonfly":
+		return [][]string{{"xdg-open", url}}, nil
 	default:
-		err = fmt.Errorf("unsupported platform: %s", runtime.GOOS)
+		return nil, fmt.Errorf("unsupported platform: %s", platform)
 	}
+}
 
+// OpenBrowser opens the url in a web browser on the specified platform by
+// calling run with each of the platform's browser commands until one of
+// them succeeds. Returns the error of the last command if they all fail.
+func OpenBrowser(url, platform string, run func(name string, args ...string) error) error {
+	cmds, err := BrowserCommands(platform, url)
 	if err != nil {
-		fmt.Printf("Could not open web browser: %s\n", err.Error())
+		return err
 	}
 
-	return nil
+	for _, cmd := range cmds {
+		if err = run(cmd[0], cmd[1:]...); err == nil {
+			return nil
+		}
+	}
+
+	return err
+}
+
+// Start the command without waiting for it to complete.
+func startCommand(name string, args ...string) error {
+	return exec.Command(name, args...).Start()
+}
+
+// Detect if Linux is running on the Windows Subsystem for Linux.
+func isWSL() bool {
+	if os.Getenv("WSL_DISTRO_NAME") != "" {
+		return true
+	}
+
+	release, err := ioutil.ReadFile("/proc/sys/kernel/osrelease")
+	if err != nil {
+		return false
+	}
+
+	return strings.Contains(strings.ToLower(string(release)), "microsoft")
 }
 
 //===========================================================================
@@ -142,72 +351,73 @@ func (c *CLIClient) Endpoint(resource string, detail ...string) *url.URL {
 }
 
 // Do executes a request with the internal client, ensuring that all necessary
-// headers are set and that any required authentication is added.
+// headers are set and that any required authentication is added. A request
+// ID is generated if one is not already set so the request can be traced.
 // TODO: Ensure that the server verifies the version information.
 func (c *CLIClient) Do(request *http.Request) (*http.Response, error) {
 	// Add the application version header and content type
 	request.Header.Set(HeaderAcceptKey, HeaderContentTypeVal)
 	request.Header.Set(HeaderVersionKey, fmt.Sprintf(HeaderVersionVal, PackageVersion()))
 
+	// Add the request ID to correlate the request in the server logs
+	if request.Header.Get(HeaderRequestIDKey) == "" {
+		request.Header.Set(HeaderRequestIDKey, uuid.New().String())
+	}
+
+	// Authenticate with the server if a token is available
+	if c.Token != "" {
+		request.Header.Set(HeaderAuthorizationKey, bearerScheme+c.Token)
+	}
+
 	// Execute the request
 	return c.client.Do(request)
 }
 
 // Get makes an http GET request to the FLuidFS C2S API resource or command
-// along with any specified details to the endpoint. The Get function returns
-// arbitrary JSON data. It is up to the caller to parse and handle responses.
-// TODO: allow the specificiation to submit a query string.
-// TODO: return an error if the server returns an error.
-func (c *CLIClient) Get(resource string, detail ...string) (JSON, error) {
+// along with any specified details to the endpoint. The JSON response is
+// decoded into out, which should be a pointer to one of the response types.
+// If the server returns an error, the error message is returned instead.
+func (c *CLIClient) Get(resource string, out interface{}, detail ...string) error {
+	return c.GetQuery(resource, nil, out, detail...)
+}
+
+// GetQuery makes an http GET request like Get with the query string encoded
+// from the specified values.
+func (c *CLIClient) GetQuery(resource string, query url.Values, out interface{}, detail ...string) error {
 	// Construct the URL and the HTTP request
-	url := c.Endpoint(resource, detail...)
-	req, err := http.NewRequest(http.MethodGet, url.String(), nil)
+	ep := c.Endpoint(resource, detail...)
+	ep.RawQuery = query.Encode()
+	req, err := http.NewRequest(http.MethodGet, ep.String(), nil)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
 	// Execute the HTTP request
 	res, err := c.Do(req)
 	if err != nil {
-		return nil, err
-	}
-
-	// Parse the JSON response and return
-	data := make(JSON)
-	if err := json.NewDecoder(res.Body).Decode(&data); err != nil {
-		return nil, err
-	}
-
-	// Check if an error has occurred
-	if res.StatusCode != http.StatusOK {
-		msg, ok := data["error"].(string)
-		if ok {
-			return data, errors.New(msg)
-		}
-
-		return data, errors.New(res.Status)
+		return err
 	}
 
-	return data, nil
+	return decodeResponse(res, out)
 }
 
 // Post an http POST request along with JSON data to the FluidFS C2S API
-// resource or command. Teh Post function returns JSON data from the server,
-// it's up to the caller to handle responses.
-func (c *CLIClient) Post(resource string, data JSON, detail ...string) (JSON, error) {
+// resource or command. The request data is marshaled from in and the JSON
+// response is decoded into out, which should be a pointer to a response.
+func (c *CLIClient) Post(resource string, in, out interface{}, detail ...string) error {
 	// Get the URL with the associated endpoint
 	url := c.Endpoint(resource, detail...)
 
 	// Marshall the POST data into a byte buffer
 	body := new(bytes.Buffer)
-	if err := json.NewEncoder(body).Encode(data); err != nil {
-		return nil, err
+	if err := json.NewEncoder(body).Encode(in); err != nil {
+		return err
 	}
 
 	// Create the POST request
 	req, err := http.NewRequest(http.MethodPost, url.String(), body)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
 	// Set any necessary headers
@@ -216,24 +426,27 @@ func (c *CLIClient) Post(resource string, data JSON, detail ...string) (JSON, er
 	// Execute the http request
 	res, err := c.Do(req)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	// Parse the JSON response
-	var resData JSON
-	if err := json.NewDecoder(res.Body).Decode(&resData); err != nil {
-		return nil, err
-	}
+	return decodeResponse(res, out)
+}
+
+// Helper function to decode a JSON response into out, or to return the
+// message of the error response if the request was not successful.
+func decodeResponse(res *http.Response, out interface{}) error {
+	defer res.Body.Close()
 
 	// Check if an error has occurred
 	if res.StatusCode != http.StatusOK {
-		msg, ok := resData["error"].(string)
-		if ok {
-			return resData, errors.New(msg)
+		data := new(ErrorResponse)
+		if err := json.NewDecoder(res.Body).Decode(data); err == nil && data.Error != "" {
+			return errors.New(data.Error)
 		}
 
-		return resData, errors.New(res.Status)
+		return errors.New(res.Status)
 	}
 
-	return resData, nil
+	// Parse the JSON response
+	return json.NewDecoder(res.Body).Decode(out)
 }
@@ -1,6 +1,8 @@
 package fluid_test
 
 import (
+	"errors"
+
 	. "github.com/bbengfort/fluidfs/fluid"
 
 	. "github.com/onsi/ginkgo"
@@ -35,4 +37,61 @@ var _ = Describe("CLI", func() {
 		Ω(cli.Endpoint("path", "to", "file.txt").String()).Should(Equal("http://localhost:3264/path/to/file.txt"))
 	})
 
+	Describe("opening a web browser", func() {
+
+		const url = "http://localhost:4157/"
+
+		var calls [][]string
+
+		BeforeEach(func() {
+			calls = make([][]string, 0)
+		})
+
+		// Records the commands that are run, failing the specified commands.
+		run := func(fail ...string) func(string, ...string) error {
+			return func(name string, args ...string) error {
+				calls = append(calls, append([]string{name}, args...))
+				for _, f := range fail {
+					if f == name {
+						return errors.New("command not found")
+					}
+				}
+				return nil
+			}
+		}
+
+		It("should choose the correct command per platform", func() {
+			expected := map[string][]string{
+				"darwin":  {"open", url},
+				"windows": {"cmd", "/c", "start", url},
+				"wsl":     {"wslview", url},
+				"linux":   {"xdg-open", url},
+				"freebsd": {"xdg-open", url},
+				"openbsd": {"xdg-open", url},
+			}
+
+			for platform, cmd := range expected {
+				calls = make([][]string, 0)
+				Ω(OpenBrowser(url, platform, run())).Should(Succeed())
+				Ω(calls).Should(Equal([][]string{cmd}), platform)
+			}
+		})
+
+		It("should fall back to explorer on WSL without wslview", func() {
+			Ω(OpenBrowser(url, "wsl", run("wslview"))).Should(Succeed())
+			Ω(calls).Should(Equal([][]string{{"wslview", url}, {"explorer.exe", url}}))
+		})
+
+		It("should return an error if no command can open the browser", func() {
+			Ω(OpenBrowser(url, "wsl", run("wslview", "explorer.exe"))).ShouldNot(Succeed())
+			Ω(calls).Should(HaveLen(2))
+		})
+
+		It("should return an error on unsupported platforms", func() {
+			Ω(OpenBrowser(url, "plan9", run())).ShouldNot(Succeed())
+			Ω(calls).Should(BeEmpty())
+		})
+
+	})
+
 })
@@ -7,9 +7,15 @@ import (
 	"fmt"
 	"io/ioutil"
 	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
 	"os"
 	"os/user"
 	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
 
 	kvdb "github.com/bbengfort/fluidfs/fluid/db"
 
@@ -19,12 +25,30 @@ import (
 // DefaultPort that the replica listens on
 const DefaultPort = 4157
 
+// DefaultAPIHost that the C2S API binds to, only reachable from the replica.
+const DefaultAPIHost = "localhost"
+
 // Configuration directories and fixtures
 const (
 	ConfigDirectory       = "fluidfs"
 	HiddenConfigDirectory = ".fluidfs"
 )
 
+// EnvToken is the environment variable that sets the C2S API token.
+const EnvToken = "FLUIDFS_TOKEN"
+
+// DefaultMaxUploadSize is the largest request the C2S API accepts to upload
+// files, since each uploaded file is held in memory.
+const DefaultMaxUploadSize = 64 * 1024 * 1024
+
+// DefaultMaxClockSkew is how far ahead of the local clock the hybrid logical
+// clock versions observed from other replicas may be.
+const DefaultMaxClockSkew = time.Minute
+
+// ModeConfig is the mode of configuration files written by FluidFS, which
+// are only readable by the user since they may contain the C2S API token.
+const ModeConfig = 0600
+
 //===========================================================================
 // Config Structs and Interfaces
 //===========================================================================
@@ -42,15 +66,25 @@ type Configuration interface {
 // from YAML configuration files and supplies the primary inputs to the
 // FluidFS server as well as connection interfaces to clients.
 type Config struct {
-	PID      uint            `yaml:"pid"`             // Used to determine replica presidence
-	Name     string          `yaml:"name,omitempty"`  // The name of the replica
-	Host     string          `yaml:"host,omitempty"`  // The listen address or host the replica
-	Port     int             `yaml:"port,omitempty"`  //  The port the replica listens on
-	FStab    string          `yaml:"fstab,omitempty"` // The path to the fstab file on disk
-	Logging  *LoggingConfig  `yaml:"logging"`         // Configuration for logging
-	Database *DatabaseConfig `yaml:"database"`        // Database configuration
-	Storage  *StorageConfig  `yaml:"storage"`         // Storage/Chunking configuration
-	Loaded   []string        `yaml:"-"`               // Reference to the loaded configuration paths
+	PID       uint             `yaml:"pid"`             // Used to determine replica presidence
+	Name      string           `yaml:"name,omitempty"`  // The name of the replica
+	Host      string           `yaml:"host,omitempty"`  // The listen address or host the replica
+	Port      int              `yaml:"port,omitempty"`  //  The port the replica listens on
+	APIHost   string           `yaml:"api_host"`        // The address the C2S API binds to
+	APIPort   int              `yaml:"api_port"`        // The port of the C2S API, 0 for any free port
+	FStab     string           `yaml:"fstab,omitempty"` // The path to the fstab file on disk
+	MaxUpload int64            `yaml:"max_upload_size"` // The largest upload request in bytes accepted by the C2S API
+	MaxSkew   time.Duration    `yaml:"max_clock_skew"`  // The bound on the skew of remote hybrid clock versions, 0 for no bound
+	Logging   *LoggingConfig   `yaml:"logging"`         // Configuration for logging
+	Database  *DatabaseConfig  `yaml:"database"`        // Database configuration
+	Storage   *StorageConfig   `yaml:"storage"`         // Storage/Chunking configuration
+	Mount     *MountConfig     `yaml:"mount"`           // FUSE mount configuration
+	CORS      *CORSConfig      `yaml:"cors"`            // Cross-origin access to the C2S API
+	Security  *SecurityConfig  `yaml:"security"`        // Authentication for the C2S API
+	Limits    *RateLimitConfig `yaml:"rate_limit"`      // Per-client rate limits for the C2S API
+	Loaded    []string         `yaml:"-"`               // Reference to the loaded configuration paths
+
+	EnableProfiling bool `yaml:"enable_profiling"` // Serve pprof endpoints on the C2S API
 }
 
 //===========================================================================
@@ -65,6 +99,24 @@ type Config struct {
 // An optional parameter, the path to another configuration can be passed in.
 // This configuration will be loaded after the configuration in Paths().
 func LoadConfig(confPath string) (*Config, error) {
+	conf, err := ReadConfig(confPath)
+	if err != nil {
+		return nil, err
+	}
+
+	// Finally validate the configuration
+	if err := conf.Validate(); err != nil {
+		return nil, err
+	}
+
+	// Return the config, all is well!
+	return conf, nil
+}
+
+// ReadConfig loads the configuration as LoadConfig does but does not validate
+// it, so that nothing is created on disk, e.g. to write a starter
+// configuration on a machine that has not been configured yet.
+func ReadConfig(confPath string) (*Config, error) {
 	// Initialize the config
 	conf := new(Config)
 
@@ -89,12 +141,6 @@ func LoadConfig(confPath string) (*Config, error) {
 		return nil, err
 	}
 
-	// Finally validate the configuration
-	if err := conf.Validate(); err != nil {
-		return nil, err
-	}
-
-	// Return the config, all is well!
 	return conf, nil
 }
 
@@ -148,6 +194,36 @@ func (conf *Config) Read(path string) error {
 	return nil
 }
 
+// Write the configuration as YAML to a path on disk. The file is written to
+// a temporary file in the same directory then moved into place so that a
+// partially written configuration is never read. Note that the loaded paths
+// are not written since they are only relevant to the current process. The
+// file is only readable by the user since it may contain the api token.
+func (conf *Config) Write(path string) error {
+	data, err := yaml.Marshal(conf)
+	if err != nil {
+		return err
+	}
+
+	// Make sure the directory exists.
+	if err := os.MkdirAll(filepath.Dir(path), ModeStorageDir); err != nil {
+		return err
+	}
+
+	return writeFileAtomic(path, data, ModeConfig)
+}
+
+// UserPath returns the path of the configuration in the user's home
+// directory, which is where the configuration is written on initialization.
+func (conf *Config) UserPath() (string, error) {
+	usr, err := user.Current()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(usr.HomeDir, HiddenConfigDirectory, "config.yml"), nil
+}
+
 //===========================================================================
 // Config Interface (Defaults and Validation)
 //===========================================================================
@@ -167,6 +243,16 @@ func (conf *Config) Defaults() error {
 	// Set the default Port
 	conf.Port = DefaultPort
 
+	// Bind the C2S API to any free port on the loopback interface
+	conf.APIHost = DefaultAPIHost
+	conf.APIPort = 0
+
+	// Limit the size of uploads to the C2S API
+	conf.MaxUpload = DefaultMaxUploadSize
+
+	// Bound the clock skew of the versions of other replicas
+	conf.MaxSkew = DefaultMaxClockSkew
+
 	// The default fstab path is in the user's hidden config directory: ~/.fluid/fstab
 	usr, err := user.Current()
 	if err == nil {
@@ -185,6 +271,22 @@ func (conf *Config) Defaults() error {
 	conf.Storage = new(StorageConfig)
 	conf.Storage.Defaults()
 
+	// Create the mount configuration and call its defaults.
+	conf.Mount = new(MountConfig)
+	conf.Mount.Defaults()
+
+	// Create the CORS configuration and call its defaults.
+	conf.CORS = new(CORSConfig)
+	conf.CORS.Defaults()
+
+	// Create the security configuration and call its defaults.
+	conf.Security = new(SecurityConfig)
+	conf.Security.Defaults()
+
+	// Create the rate limit configuration and call its defaults.
+	conf.Limits = new(RateLimitConfig)
+	conf.Limits.Defaults()
+
 	return nil
 }
 
@@ -201,6 +303,34 @@ func (conf *Config) Validate() error {
 		return errors.New("Improperly configured: a name is required.")
 	}
 
+	// Return an error if the C2S API cannot be bound to the host and port
+	if conf.APIHost == "" {
+		return errors.New("Improperly configured: an api host is required.")
+	}
+
+	if strings.Contains(conf.APIHost, ":") && net.ParseIP(conf.APIHost) == nil {
+		return fmt.Errorf("Improperly configured: api host '%s' should not contain a port.", conf.APIHost)
+	}
+
+	if conf.APIPort < 0 || conf.APIPort > 65535 {
+		return fmt.Errorf("Improperly configured: api port %d is not between 0 and 65535.", conf.APIPort)
+	}
+
+	if conf.MaxUpload <= 0 {
+		return fmt.Errorf("Improperly configured: max upload size %d must be positive.", conf.MaxUpload)
+	}
+
+	if conf.MaxSkew < 0 {
+		return fmt.Errorf("Improperly configured: max clock skew %s must not be negative.", conf.MaxSkew)
+	}
+
+	// Expand environment variables and the home directory in the fstab path
+	path, err := ExpandPath(conf.FStab)
+	if err != nil {
+		return fmt.Errorf("Improperly configured: could not expand fstab path: %s", err.Error())
+	}
+	conf.FStab = path
+
 	// Return an error if there is no fstab path
 	if conf.FStab == "" {
 		return errors.New("Improperly configured: an fstab path is required.")
@@ -221,6 +351,26 @@ func (conf *Config) Validate() error {
 		return err
 	}
 
+	// Validate the MountConfig
+	if err := conf.Mount.Validate(); err != nil {
+		return err
+	}
+
+	// Validate the CORSConfig
+	if err := conf.CORS.Validate(); err != nil {
+		return err
+	}
+
+	// Validate the SecurityConfig
+	if err := conf.Security.Validate(); err != nil {
+		return err
+	}
+
+	// Validate the RateLimitConfig
+	if err := conf.Limits.Validate(); err != nil {
+		return err
+	}
+
 	return nil
 }
 
@@ -241,14 +391,44 @@ func (conf *Config) Environ() error {
 		return err
 	}
 
+	// Make sure the mount configuration can get environment variables.
+	if err := conf.Mount.Environ(); err != nil {
+		return err
+	}
+
+	// Make sure the CORS configuration can get environment variables.
+	if err := conf.CORS.Environ(); err != nil {
+		return err
+	}
+
+	// Make sure the security configuration can get environment variables.
+	if err := conf.Security.Environ(); err != nil {
+		return err
+	}
+
+	// Make sure the rate limit configuration can get environment variables.
+	if err := conf.Limits.Environ(); err != nil {
+		return err
+	}
+
 	return nil
 }
 
+// APIAddr returns the address that the C2S API binds to, bracketing IPv6
+// addresses. If the port is 0 the API binds to any free port.
+func (conf *Config) APIAddr() string {
+	return net.JoinHostPort(conf.APIHost, strconv.Itoa(conf.APIPort))
+}
+
 // String returns a pretty representation of the Configuration.
 func (conf *Config) String() string {
 	output := fmt.Sprintf("%s configuration (%s:%d)", conf.Name, conf.Host, conf.Port)
 	output += "\n" + conf.Database.String()
 	output += "\n" + conf.Storage.String()
+	output += "\n" + conf.Mount.String()
+	output += "\n" + conf.CORS.String()
+	output += "\n" + conf.Security.String()
+	output += "\n" + conf.Limits.String()
 	output += "\n" + conf.Logging.String()
 	return output
 }
@@ -280,6 +460,13 @@ func (conf *LoggingConfig) Validate() error {
 		return fmt.Errorf(msg, conf.Level)
 	}
 
+	// Expand environment variables and the home directory in the log path.
+	path, err := ExpandPath(conf.Path)
+	if err != nil {
+		return fmt.Errorf("Improperly configured: could not expand log path: %s", err.Error())
+	}
+	conf.Path = path
+
 	return nil
 }
 
@@ -307,8 +494,9 @@ func (conf *LoggingConfig) String() string {
 // DatabaseConfig is passed to the InitDatabase function to correctly open the
 // right type of database and Database interface.
 type DatabaseConfig struct {
-	Driver string `yaml:"driver,omitempty"` // specifies the database interface to use
-	Path   string `yaml:"path,omitempty"`   // optional path to location on disk to write file
+	Driver  string        `yaml:"driver,omitempty"` // specifies the database interface to use
+	Path    string        `yaml:"path,omitempty"`   // optional path to location on disk to write file
+	Timeout time.Duration `yaml:"timeout"`          // how long to wait for another process to release the lock, 0 waits forever
 }
 
 // Defaults sets the reasonable defaults on the DatabaseConfig object.
@@ -317,6 +505,9 @@ func (conf *DatabaseConfig) Defaults() error {
 	// The default driver is the boltdb driver
 	conf.Driver = kvdb.BoltDBDriver
 
+	// Wait for the lock for long enough for a short command to finish
+	conf.Timeout = 15 * time.Second
+
 	// The default path to the database is in a hidden directory in the home
 	// directory of the user, namely ~/.fluidfs/cache.db
 	usr, err := user.Current()
@@ -338,11 +529,23 @@ func (conf *DatabaseConfig) Validate() error {
 		return fmt.Errorf("Improperly configured: '%s' is not a valid database driver", conf.Driver)
 	}
 
+	// Expand environment variables and the home directory in the path.
+	path, err := ExpandPath(conf.Path)
+	if err != nil {
+		return fmt.Errorf("Improperly configured: could not expand database path: %s", err.Error())
+	}
+	conf.Path = path
+
 	// Ensure that a path has been passed in.
 	if conf.Path == "" {
 		return errors.New("Improperly configured: must specify a path to the database")
 	}
 
+	// Ensure that the lock timeout is not negative.
+	if conf.Timeout < 0 {
+		return errors.New("Improperly configured: database timeout cannot be negative.")
+	}
+
 	return nil
 }
 
@@ -366,6 +569,11 @@ func (conf *DatabaseConfig) GetPath() string {
 	return conf.Path
 }
 
+// GetTimeout implements db.Config
+func (conf *DatabaseConfig) GetTimeout() time.Duration {
+	return conf.Timeout
+}
+
 //===========================================================================
 // Storage Configuration
 //===========================================================================
@@ -379,6 +587,10 @@ type StorageConfig struct {
 	MinBlockSize int    `yaml:"min_block_size"`       // Used in both variable and fixed
 	MaxBlockSize int    `yaml:"max_block_size"`       // Used only in variable length chunking
 	Hashing      string `yaml:"hashing,omitempty"`    // Identifies the hashing algorithm used
+	BlobMode     string `yaml:"blob_mode,omitempty"`  // Octal permissions of blob files, e.g. "0640"
+	DirMode      string `yaml:"dir_mode,omitempty"`   // Octal permissions of storage directories
+
+	NormalizedChunking bool `yaml:"normalized_chunking"` // Tighten variable length blob sizes around the target
 }
 
 // Defaults sets the reasonable defaults on the StorageConfig object.
@@ -407,15 +619,17 @@ func (conf *StorageConfig) Defaults() error {
 	// Default hashing algorithm is SHA256 to prevent collisions
 	conf.Hashing = SHA256
 
+	// Default permissions are readable by all but writable only by the user
+	conf.BlobMode = fmt.Sprintf("%04o", ModeBlob)
+	conf.DirMode = fmt.Sprintf("%04o", ModeStorageDir)
+
 	return nil
 }
 
 // Validate ensures that required chunking settings are correct
 func (conf *StorageConfig) Validate() error {
-
-	// Return an error if there is no storage path
-	if conf.Path == "" {
-		return errors.New("Improperly configured: a path to the storage directory is required.")
+	if err := conf.Check(); err != nil {
+		return err
 	}
 
 	// NOTE: The following happens in validate, e.g. ASAP so that errors happen at startup.
@@ -423,7 +637,7 @@ func (conf *StorageConfig) Validate() error {
 	// Create the storage path if it does not exist and validate that the user
 	// has permission to read and write to the directory.
 	if _, err := os.Stat(conf.Path); os.IsNotExist(err) {
-		if err := os.MkdirAll(conf.Path, ModeStorageDir); err != nil {
+		if err := os.MkdirAll(conf.Path, conf.DirPerm()); err != nil {
 			return fmt.Errorf("Improperly configured: could not create storage directory at '%s'", conf.Path)
 		}
 	}
@@ -434,6 +648,40 @@ func (conf *StorageConfig) Validate() error {
 		return errors.New("Improperly configured: storage directory cannot be accessed.")
 	}
 
+	return nil
+}
+
+// Check the storage configuration as Validate does but without creating the
+// storage directory, e.g. while the user is still being asked for settings.
+func (conf *StorageConfig) Check() error {
+
+	// Expand environment variables and the home directory in the path.
+	path, err := ExpandPath(conf.Path)
+	if err != nil {
+		return fmt.Errorf("Improperly configured: could not expand storage path: %s", err.Error())
+	}
+	conf.Path = path
+
+	// Ensure the blob mode is a legal mode that allows the user to write blobs.
+	if mode, err := parseMode(conf.BlobMode, ModeBlob); err != nil || mode&0600 != 0600 {
+		return fmt.Errorf("Improperly configured: '%s' is not a valid blob mode, must be octal and user read-writable", conf.BlobMode)
+	}
+
+	// Ensure the directory mode is a legal mode that allows the user to add blobs.
+	if mode, err := parseMode(conf.DirMode, ModeStorageDir); err != nil || mode&0700 != 0700 {
+		return fmt.Errorf("Improperly configured: '%s' is not a valid directory mode, must be octal and user accessible", conf.DirMode)
+	}
+
+	// Return an error if there is no storage path
+	if conf.Path == "" {
+		return errors.New("Improperly configured: a path to the storage directory is required.")
+	}
+
+	// Ensure that an existing storage path is a directory.
+	if info, err := os.Stat(conf.Path); err == nil && !info.IsDir() {
+		return errors.New("Improperly configured: storage directory cannot be accessed.")
+	}
+
 	// Ensure that the chunks is all lowercase and whitespace trimmed.
 	conf.Chunking = Regularize(conf.Chunking)
 
@@ -477,3 +725,318 @@ func (conf *StorageConfig) Environ() error {
 func (conf *StorageConfig) String() string {
 	return fmt.Sprintf("%s length %d byte blobs stored at %s", conf.Chunking, conf.BlockSize, conf.Path)
 }
+
+// BlobPerm returns the permissions of blob files written to disk, which are
+// subject to the umask of the process.
+func (conf *StorageConfig) BlobPerm() os.FileMode {
+	mode, _ := parseMode(conf.BlobMode, ModeBlob)
+	return mode
+}
+
+// DirPerm returns the permissions of the directories created in the storage
+// directory, which are subject to the umask of the process.
+func (conf *StorageConfig) DirPerm() os.FileMode {
+	mode, _ := parseMode(conf.DirMode, ModeStorageDir)
+	return mode
+}
+
+// Parse an octal permission mode such as "0640", returning the default mode if
+// the value is empty or cannot be parsed.
+func parseMode(value string, defaultMode os.FileMode) (os.FileMode, error) {
+	if value = strings.TrimSpace(value); value == "" {
+		return defaultMode, nil
+	}
+
+	mode, err := strconv.ParseUint(value, 8, 32)
+	if err != nil {
+		return defaultMode, err
+	}
+
+	if os.FileMode(mode)&^os.ModePerm != 0 {
+		return defaultMode, fmt.Errorf("%s has bits other than permissions set", value)
+	}
+
+	return os.FileMode(mode), nil
+}
+
+// ArchitectureDependent returns true if the hashing algorithm produces
+// different blob hashes on different architectures, in which case replicas
+// with mixed architectures would not be able to share blobs.
+func (conf *StorageConfig) ArchitectureDependent() bool {
+	return ListContains(conf.Hashing, archDependentHashing)
+}
+
+//===========================================================================
+// Mount Configuration
+//===========================================================================
+
+// MountConfig specifies how FUSE file systems are mounted. Mounting can fail
+// transiently, e.g. on macOS right after a previous unmount, so the mount is
+// retried with exponential backoff before giving up.
+type MountConfig struct {
+	Retries int           `yaml:"retries"`           // Number of retries after the first attempt fails
+	Backoff time.Duration `yaml:"backoff,omitempty"` // Wait before the first retry, doubled on each retry
+	Timeout time.Duration `yaml:"timeout"`           // Maximum time for each attempt, 0 for no timeout
+
+	MaxRequests int `yaml:"max_requests"` // Maximum concurrent FUSE requests, 0 for no limit
+}
+
+// Defaults sets the reasonable defaults on the MountConfig object.
+func (conf *MountConfig) Defaults() error {
+	conf.Retries = 3
+	conf.Backoff = 500 * time.Millisecond
+	conf.Timeout = 30 * time.Second
+	conf.MaxRequests = 64
+	return nil
+}
+
+// Validate ensures that required mount settings are correct
+func (conf *MountConfig) Validate() error {
+	if conf.Retries < 0 {
+		return errors.New("Improperly configured: mount retries cannot be negative.")
+	}
+
+	if conf.Backoff < 0 {
+		return errors.New("Improperly configured: mount backoff cannot be negative.")
+	}
+
+	if conf.Timeout < 0 {
+		return errors.New("Improperly configured: mount timeout cannot be negative.")
+	}
+
+	if conf.MaxRequests < 0 {
+		return errors.New("Improperly configured: maximum mount requests cannot be negative.")
+	}
+
+	return nil
+}
+
+// Environ sets the mount configuration from the environment.
+func (conf *MountConfig) Environ() error {
+	return nil
+}
+
+// String returns a pretty representation of the mount configuration.
+func (conf *MountConfig) String() string {
+	return fmt.Sprintf("mount with %d retries (backoff %s, timeout %s, max requests %d)", conf.Retries, conf.Backoff, conf.Timeout, conf.MaxRequests)
+}
+
+//===========================================================================
+// CORS Configuration
+//===========================================================================
+
+// CORSConfig specifies which cross-origin clients, such as a web interface
+// served from another host, may call the C2S API. By default no origins are
+// allowed so the API can only be called from the same origin.
+type CORSConfig struct {
+	AllowedOrigins []string `yaml:"allowed_origins"` // Origins that may call the API, or * for any
+	AllowedMethods []string `yaml:"allowed_methods"` // Methods that cross-origin clients may use
+	AllowedHeaders []string `yaml:"allowed_headers"` // Request headers that cross-origin clients may send
+}
+
+// Defaults sets the reasonable defaults on the CORSConfig object.
+func (conf *CORSConfig) Defaults() error {
+	conf.AllowedOrigins = []string{}
+	conf.AllowedMethods = []string{http.MethodGet, http.MethodPost}
+	conf.AllowedHeaders = []string{HeaderAcceptKey, HeaderContentTypeKey, HeaderAuthorizationKey, HeaderRequestIDKey}
+	return nil
+}
+
+// Validate ensures that required CORS settings are correct
+func (conf *CORSConfig) Validate() error {
+	for _, origin := range conf.AllowedOrigins {
+		if origin == "*" {
+			continue
+		}
+
+		u, err := url.Parse(origin)
+		if err != nil || u.Scheme == "" || u.Host == "" || (u.Path != "" && u.Path != "/") {
+			return fmt.Errorf("Improperly configured: '%s' is not a valid origin", origin)
+		}
+	}
+
+	// Methods are case-sensitive in HTTP, so make sure they're upper case.
+	for i, method := range conf.AllowedMethods {
+		conf.AllowedMethods[i] = strings.ToUpper(strings.TrimSpace(method))
+		if conf.AllowedMethods[i] == "" {
+			return errors.New("Improperly configured: allowed methods cannot be empty.")
+		}
+	}
+
+	return nil
+}
+
+// Environ sets the CORS configuration from the environment.
+func (conf *CORSConfig) Environ() error {
+	return nil
+}
+
+// String returns a pretty representation of the CORS configuration.
+func (conf *CORSConfig) String() string {
+	if len(conf.AllowedOrigins) == 0 {
+		return "cors allows same origin only"
+	}
+	return fmt.Sprintf("cors allows %s from %s", strings.Join(conf.AllowedMethods, ", "), strings.Join(conf.AllowedOrigins, ", "))
+}
+
+//===========================================================================
+// Security Configuration
+//===========================================================================
+
+// Minimum length of the C2S API bearer token.
+const minTokenLength = 16
+
+// SecurityConfig specifies the bearer token that clients must present to the
+// C2S API. If no token is set then the API is unauthenticated. If public
+// reads are allowed then only requests that modify the replica require the
+// token, otherwise every API request does. The transfer root limits the local
+// directories that the API can import trees from and export trees to.
+type SecurityConfig struct {
+	Token        string `yaml:"token,omitempty"`         // Bearer token required by the C2S API
+	PublicReads  bool   `yaml:"public_reads"`            // Allow GET requests without the token
+	TransferRoot string `yaml:"transfer_root,omitempty"` // Local directory the API may import from or export to
+	environ      bool   // If the token was set from the environment
+	fileToken    string // The token from the configuration files, if any
+}
+
+// Defaults sets the reasonable defaults on the SecurityConfig object.
+func (conf *SecurityConfig) Defaults() error {
+	conf.Token = ""
+	conf.PublicReads = false
+	conf.TransferRoot = ""
+	return nil
+}
+
+// Validate ensures that required security settings are correct
+func (conf *SecurityConfig) Validate() error {
+	if conf.Token != "" && len(conf.Token) < minTokenLength {
+		return fmt.Errorf("Improperly configured: the api token must be at least %d characters.", minTokenLength)
+	}
+
+	if conf.TransferRoot != "" {
+		path, err := ExpandPath(conf.TransferRoot)
+		if err != nil {
+			return fmt.Errorf("Improperly configured: could not expand transfer root: %s", err.Error())
+		}
+
+		if !filepath.IsAbs(path) {
+			return fmt.Errorf("Improperly configured: transfer root '%s' is not an absolute path.", path)
+		}
+		conf.TransferRoot = filepath.Clean(path)
+	}
+
+	return nil
+}
+
+// Environ sets the security configuration from the environment so that the
+// token does not have to be written to a configuration file.
+func (conf *SecurityConfig) Environ() error {
+	if token := os.Getenv(EnvToken); token != "" && !conf.environ {
+		conf.fileToken = conf.Token
+		conf.Token = token
+		conf.environ = true
+	}
+	return nil
+}
+
+// MarshalYAML writes the token from the configuration files rather than a
+// token from the environment, so that the environment token is never saved.
+func (conf *SecurityConfig) MarshalYAML() (interface{}, error) {
+	if conf == nil {
+		return nil, nil
+	}
+
+	type plain SecurityConfig
+	out := plain(*conf)
+	if conf.environ {
+		out.Token = conf.fileToken
+	}
+	return out, nil
+}
+
+// Enabled returns true if the C2S API requires authentication.
+func (conf *SecurityConfig) Enabled() bool {
+	return conf.Token != ""
+}
+
+// AllowTransfer returns an error if the C2S API may not import a tree from or
+// export a tree to the local path. If a transfer root is configured the path
+// must be inside of it once symlinks are resolved. Otherwise transfers are
+// only allowed when the token is required, since an export replaces local
+// files and an import reads any file that the replica can.
+func (conf *SecurityConfig) AllowTransfer(path string) error {
+	if conf.TransferRoot == "" {
+		if !conf.Enabled() {
+			return errors.New("imports and exports require an api token or a transfer root")
+		}
+		return nil
+	}
+
+	if !pathWithin(resolvePath(conf.TransferRoot), resolvePath(path)) {
+		return fmt.Errorf("%s is not in the transfer root %s", path, conf.TransferRoot)
+	}
+	return nil
+}
+
+// String returns a pretty representation of the security configuration.
+func (conf *SecurityConfig) String() string {
+	if !conf.Enabled() {
+		return "api authentication disabled"
+	}
+
+	if conf.PublicReads {
+		return "api authentication required for writes"
+	}
+	return "api authentication required"
+}
+
+//===========================================================================
+// Rate Limit Configuration
+//===========================================================================
+
+// RateLimitConfig specifies how many requests per second each client may
+// make to the C2S API, with separate limits for requests that read from the
+// replica and requests that modify it. The burst is the number of requests
+// a client may make at once before being limited. A rate of 0 disables the
+// limit for that class of requests.
+type RateLimitConfig struct {
+	ReadRate   float64 `yaml:"read_rate"`   // Sustained read requests per second per client
+	ReadBurst  int     `yaml:"read_burst"`  // Maximum read requests at once per client
+	WriteRate  float64 `yaml:"write_rate"`  // Sustained write requests per second per client
+	WriteBurst int     `yaml:"write_burst"` // Maximum write requests at once per client
+}
+
+// Defaults sets the reasonable defaults on the RateLimitConfig object.
+func (conf *RateLimitConfig) Defaults() error {
+	conf.ReadRate = 20
+	conf.ReadBurst = 40
+	conf.WriteRate = 2
+	conf.WriteBurst = 10
+	return nil
+}
+
+// Validate ensures that required rate limit settings are correct
+func (conf *RateLimitConfig) Validate() error {
+	if conf.ReadRate < 0 || conf.WriteRate < 0 {
+		return errors.New("Improperly configured: rate limits cannot be negative.")
+	}
+
+	if (conf.ReadRate > 0 && conf.ReadBurst < 1) || (conf.WriteRate > 0 && conf.WriteBurst < 1) {
+		return errors.New("Improperly configured: rate limit bursts must be at least 1.")
+	}
+
+	return nil
+}
+
+// Environ sets the rate limit configuration from the environment.
+func (conf *RateLimitConfig) Environ() error {
+	return nil
+}
+
+// String returns a pretty representation of the rate limit configuration.
+func (conf *RateLimitConfig) String() string {
+	return fmt.Sprintf(
+		"rate limited to %0.1f reads/sec (burst %d) and %0.1f writes/sec (burst %d)",
+		conf.ReadRate, conf.ReadBurst, conf.WriteRate, conf.WriteBurst,
+	)
+}
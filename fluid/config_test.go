@@ -6,6 +6,7 @@ import (
 	"os"
 	"os/user"
 	"path/filepath"
+	"time"
 
 	. "github.com/bbengfort/fluidfs/fluid"
 
@@ -43,12 +44,137 @@ var _ = Describe("Config", func() {
 			Ω(paths).Should(ContainElement(hdc))
 		})
 
-		It("should read a YAML file from a path", func() {
-			Skip("test needs to be implemented")
-		})
+		Context("with a YAML file on disk", func() {
+
+			var tempDir string
+			var path string
+			var err error
+
+			BeforeEach(func() {
+				tempDir, err = ioutil.TempDir("", TempDirPrefix)
+				Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+
+				fixture := "pid: 42\n" +
+					"name: alaska\n" +
+					"host: 192.168.1.42\n" +
+					"port: 3264\n" +
+					"fstab: %s\n" +
+					"logging:\n" +
+					"  level: DEBUG\n" +
+					"database:\n" +
+					"  driver: LevelDB\n" +
+					"  path: %s\n" +
+					"storage:\n" +
+					"  path: %s\n" +
+					"  chunking: fixed\n" +
+					"  block_size: 2048\n" +
+					"  min_block_size: 1024\n" +
+					"  max_block_size: 2048\n" +
+					"  hashing: MD5\n"
+
+				fixture = fmt.Sprintf(
+					fixture,
+					filepath.Join(tempDir, "fstab"),
+					filepath.Join(tempDir, "cache.ldb"),
+					filepath.Join(tempDir, "data"),
+				)
+
+				path = filepath.Join(tempDir, "fluidfs.yml")
+				Ω(ioutil.WriteFile(path, []byte(fixture), 0644)).Should(Succeed())
+			})
+
+			AfterEach(func() {
+				Ω(os.RemoveAll(tempDir)).Should(Succeed())
+			})
+
+			It("should read a YAML file from a path", func() {
+				config := new(Config)
+				Ω(config.Read(path)).Should(Succeed())
+
+				Ω(config.PID).Should(Equal(uint(42)))
+				Ω(config.Name).Should(Equal("alaska"))
+				Ω(config.Host).Should(Equal("192.168.1.42"))
+				Ω(config.Port).Should(Equal(3264))
+				Ω(config.FStab).Should(Equal(filepath.Join(tempDir, "fstab")))
+				Ω(config.Logging.Level).Should(Equal("DEBUG"))
+				Ω(config.Database.Driver).Should(Equal("LevelDB"))
+				Ω(config.Database.Path).Should(Equal(filepath.Join(tempDir, "cache.ldb")))
+				Ω(config.Storage.Path).Should(Equal(filepath.Join(tempDir, "data")))
+				Ω(config.Storage.Chunking).Should(Equal("fixed"))
+				Ω(config.Storage.BlockSize).Should(Equal(2048))
+				Ω(config.Storage.MinBlockSize).Should(Equal(1024))
+				Ω(config.Storage.MaxBlockSize).Should(Equal(2048))
+				Ω(config.Storage.Hashing).Should(Equal("MD5"))
+				Ω(config.Loaded).Should(Equal([]string{path}))
+			})
+
+			It("should return an error reading a missing YAML file", func() {
+				config := new(Config)
+				Ω(config.Read(filepath.Join(tempDir, "missing.yml"))).ShouldNot(Succeed())
+				Ω(config.Loaded).Should(BeEmpty())
+			})
+
+			It("should load the configuration calling interface methods", func() {
+				config, err := LoadConfig(path)
+				Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+
+				// Values from the YAML file should override the defaults
+				Ω(config.PID).Should(Equal(uint(42)))
+				Ω(config.Name).Should(Equal("alaska"))
+				Ω(config.Port).Should(Equal(3264))
+				Ω(config.Loaded).Should(ContainElement(path))
+
+				// Validation should regularize values
+				Ω(config.Database.Driver).Should(Equal("leveldb"))
+				Ω(config.Storage.Hashing).Should(Equal("md5"))
+
+				// Validation should create the storage directory
+				info, err := os.Stat(filepath.Join(tempDir, "data"))
+				Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+				Ω(info.IsDir()).Should(BeTrue())
+			})
+
+			It("should round trip a configuration written to disk", func() {
+				config, err := LoadConfig(path)
+				Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+
+				out := filepath.Join(tempDir, "conf", "written.yml")
+				Ω(config.Write(out)).Should(Succeed())
+
+				other := new(Config)
+				Ω(other.Read(out)).Should(Succeed())
+				Ω(other.Loaded).Should(Equal([]string{out}))
+
+				// The loaded paths are not written with the configuration
+				config.Loaded = nil
+				other.Loaded = nil
+				Ω(other).Should(Equal(config))
+			})
+
+			It("should overwrite a configuration without leaving temporary files", func() {
+				config := new(Config)
+				Ω(config.Read(path)).Should(Succeed())
+				config.Name = "klondike"
+				Ω(config.Write(path)).Should(Succeed())
+
+				other := new(Config)
+				Ω(other.Read(path)).Should(Succeed())
+				Ω(other.Name).Should(Equal("klondike"))
+
+				files, err := ioutil.ReadDir(tempDir)
+				Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+				Ω(files).Should(HaveLen(1))
+			})
+
+			It("should return a validation error when loading a bad configuration", func() {
+				fixture := fmt.Sprintf("pid: 0\nstorage:\n  path: %s\n", tempDir)
+				Ω(ioutil.WriteFile(path, []byte(fixture), 0644)).Should(Succeed())
+
+				config, err := LoadConfig(path)
+				Ω(config).Should(BeNil())
+				Ω(err).Should(HaveOccurred())
+			})
 
-		It("should load the configuration calling interface methods", func() {
-			Skip("test needs to be implemented")
 		})
 
 	})
@@ -67,6 +193,10 @@ var _ = Describe("Config", func() {
 			Ω(config.Logging).Should(BeZero())
 			Ω(config.Database).Should(BeZero())
 			Ω(config.Storage).Should(BeZero())
+			Ω(config.Mount).Should(BeZero())
+			Ω(config.CORS).Should(BeZero())
+			Ω(config.Security).Should(BeZero())
+			Ω(config.Limits).Should(BeZero())
 
 			// Run the defaults and assert that default values are set.
 			err := config.Defaults()
@@ -74,10 +204,15 @@ var _ = Describe("Config", func() {
 
 			Ω(config.Name).ShouldNot(BeZero(), "no name default")
 			Ω(config.Port).ShouldNot(BeZero(), "no port default")
+			Ω(config.APIHost).Should(Equal(DefaultAPIHost), "no api host default")
 			Ω(config.FStab).ShouldNot(BeZero(), "no fstab default")
 			Ω(config.Logging).ShouldNot(BeZero(), "logging not defaulted")
 			Ω(config.Database).ShouldNot(BeZero(), "database not defaulted")
 			Ω(config.Storage).ShouldNot(BeZero(), "storage not defaulted")
+			Ω(config.Mount).ShouldNot(BeZero(), "mount not defaulted")
+			Ω(config.CORS).ShouldNot(BeZero(), "cors not defaulted")
+			Ω(config.Security).ShouldNot(BeZero(), "security not defaulted")
+			Ω(config.Limits).ShouldNot(BeZero(), "rate limits not defaulted")
 		})
 
 		Context("validation after defaults", func() {
@@ -110,6 +245,48 @@ var _ = Describe("Config", func() {
 				Ω(err).Should(MatchError("Improperly configured: an fstab path is required."))
 			})
 
+			It("should validate the api address", func() {
+				config.PID = 1
+				config.Name = "alaska"
+				Ω(config.APIAddr()).Should(Equal("localhost:0"))
+
+				config.APIHost = ""
+				Ω(config.Validate()).Should(MatchError("Improperly configured: an api host is required."))
+
+				config.APIHost = "localhost:4158"
+				Ω(config.Validate()).Should(MatchError("Improperly configured: api host 'localhost:4158' should not contain a port."))
+
+				config.APIHost = "localhost"
+				config.APIPort = 65536
+				Ω(config.Validate()).Should(MatchError("Improperly configured: api port 65536 is not between 0 and 65535."))
+
+				config.APIHost = "::1"
+				config.APIPort = 4158
+				Ω(config.Validate()).Should(Succeed())
+				Ω(config.APIAddr()).Should(Equal("[::1]:4158"))
+			})
+
+			It("should require a positive max upload size", func() {
+				config.PID = 1
+				config.Name = "alaska"
+				Ω(config.MaxUpload).Should(Equal(int64(DefaultMaxUploadSize)))
+
+				config.MaxUpload = 0
+				Ω(config.Validate()).Should(MatchError("Improperly configured: max upload size 0 must be positive."))
+			})
+
+			It("should not allow a negative max clock skew", func() {
+				config.PID = 1
+				config.Name = "alaska"
+				Ω(config.MaxSkew).Should(Equal(DefaultMaxClockSkew))
+
+				config.MaxSkew = 0
+				Ω(config.Validate()).Should(Succeed())
+
+				config.MaxSkew = -1 * time.Second
+				Ω(config.Validate()).Should(MatchError("Improperly configured: max clock skew -1s must not be negative."))
+			})
+
 			It("should validate the logging configuration", func() {
 				config.PID = 1
 				config.Name = "alaska"
@@ -208,6 +385,12 @@ var _ = Describe("Config", func() {
 				config.Defaults()
 			})
 
+			It("should not allow a negative lock timeout", func() {
+				config.Timeout = -1 * time.Second
+				err := config.Validate()
+				Ω(err).Should(MatchError("Improperly configured: database timeout cannot be negative."))
+			})
+
 			It("should not allow bad database drivers", func() {
 				config.Driver = "KODIAC"
 				err := config.Validate()
@@ -300,6 +483,34 @@ var _ = Describe("Config", func() {
 				Ω(os.RemoveAll(tempDir)).Should(BeNil())
 			})
 
+			It("should default to the standard blob and directory modes", func() {
+				Ω(config.BlobMode).Should(Equal("0644"))
+				Ω(config.DirMode).Should(Equal("0755"))
+				Ω(config.BlobPerm()).Should(Equal(os.FileMode(ModeBlob)))
+				Ω(config.DirPerm()).Should(Equal(os.FileMode(ModeStorageDir)))
+			})
+
+			It("should allow stricter blob and directory modes", func() {
+				config.BlobMode = "0640"
+				config.DirMode = "0750"
+				Ω(config.Validate()).Should(Succeed())
+				Ω(config.BlobPerm()).Should(Equal(os.FileMode(0640)))
+				Ω(config.DirPerm()).Should(Equal(os.FileMode(0750)))
+			})
+
+			It("should not allow illegal blob and directory modes", func() {
+				for _, mode := range []string{"rw-r--r--", "0999", "01644", "0444", "0200"} {
+					config.BlobMode = mode
+					Ω(config.Validate()).Should(MatchError(ContainSubstring("is not a valid blob mode")), mode)
+				}
+
+				config.BlobMode = "0600"
+				for _, mode := range []string{"0644", "0600", "2755", "x"} {
+					config.DirMode = mode
+					Ω(config.Validate()).ShouldNot(Succeed(), mode)
+				}
+			})
+
 			It("should not allow zero storage paths", func() {
 				config.Path = ""
 				Ω(config.Validate()).Should(MatchError("Improperly configured: a path to the storage directory is required."))
@@ -412,7 +623,7 @@ var _ = Describe("Config", func() {
 
 			It("should allow good hashing alogrithms", func() {
 				var chunkNames = []string{
-					"md5", "sha1", "sha224", "sha256", "murmur",
+					"md5", "sha1", "sha224", "sha256", "murmur", "murmur128",
 				}
 
 				for _, chunks := range chunkNames {
@@ -450,4 +661,126 @@ var _ = Describe("Config", func() {
 		})
 
 	})
+
+	Describe("mount configuration interface", func() {
+
+		It("should load defaults when called", func() {
+			config := new(MountConfig)
+
+			// Assert that config has zero values
+			Ω(config.Retries).Should(BeZero())
+			Ω(config.Backoff).Should(BeZero())
+			Ω(config.Timeout).Should(BeZero())
+			Ω(config.MaxRequests).Should(BeZero())
+
+			// Call defaults and assert default values
+			config.Defaults()
+			Ω(config.Retries).ShouldNot(BeZero())
+			Ω(config.Backoff).ShouldNot(BeZero())
+			Ω(config.Timeout).ShouldNot(BeZero())
+			Ω(config.MaxRequests).ShouldNot(BeZero())
+		})
+
+		Context("validation after defaults", func() {
+
+			var config *MountConfig
+
+			BeforeEach(func() {
+				config = new(MountConfig)
+				config.Defaults()
+			})
+
+			It("should allow zero retries and no timeout", func() {
+				config.Retries = 0
+				config.Timeout = 0
+				err := config.Validate()
+				Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+			})
+
+			It("should not allow negative retries", func() {
+				config.Retries = -1
+				err := config.Validate()
+				Ω(err).Should(MatchError("Improperly configured: mount retries cannot be negative."))
+			})
+
+			It("should not allow a negative backoff", func() {
+				config.Backoff = -1 * time.Second
+				err := config.Validate()
+				Ω(err).Should(MatchError("Improperly configured: mount backoff cannot be negative."))
+			})
+
+			It("should not allow a negative timeout", func() {
+				config.Timeout = -1 * time.Second
+				err := config.Validate()
+				Ω(err).Should(MatchError("Improperly configured: mount timeout cannot be negative."))
+			})
+
+			It("should not allow a negative maximum number of requests", func() {
+				config.MaxRequests = -1
+				err := config.Validate()
+				Ω(err).Should(MatchError("Improperly configured: maximum mount requests cannot be negative."))
+			})
+
+		})
+
+	})
+
+	Describe("path expansion", func() {
+
+		var tempDir string
+		var err error
+
+		BeforeEach(func() {
+			tempDir, err = ioutil.TempDir("", TempDirPrefix)
+			Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+			Ω(os.Setenv("FLUIDFS_TEST_DATA", tempDir)).Should(Succeed())
+		})
+
+		AfterEach(func() {
+			Ω(os.Unsetenv("FLUIDFS_TEST_DATA")).Should(Succeed())
+			Ω(os.RemoveAll(tempDir)).Should(BeNil())
+		})
+
+		It("should expand environment variables in paths on validation", func() {
+			config := new(Config)
+			config.Defaults()
+
+			config.FStab = "$FLUIDFS_TEST_DATA/fstab"
+			config.Logging.Path = "${FLUIDFS_TEST_DATA}/fluid.log"
+			config.Database.Path = "$FLUIDFS_TEST_DATA/cache.bdb"
+			config.Storage.Path = "${FLUIDFS_TEST_DATA}/data"
+
+			err := config.Validate()
+			Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+
+			Ω(config.FStab).Should(Equal(filepath.Join(tempDir, "fstab")))
+			Ω(config.Logging.Path).Should(Equal(filepath.Join(tempDir, "fluid.log")))
+			Ω(config.Database.Path).Should(Equal(filepath.Join(tempDir, "cache.bdb")))
+			Ω(config.Storage.Path).Should(Equal(filepath.Join(tempDir, "data")))
+			Ω(pathExists(config.Storage.Path)).Should(BeTrue())
+		})
+
+		It("should expand the home directory in paths on validation", func() {
+			usr, err := user.Current()
+			Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+
+			config := new(DatabaseConfig)
+			config.Defaults()
+			config.Path = "~/.fluidfs/test.bdb"
+
+			Ω(config.Validate()).Should(Succeed())
+			Ω(config.Path).Should(Equal(filepath.Join(usr.HomeDir, ".fluidfs", "test.bdb")))
+		})
+
+		It("should expand paths read from a YAML file", func() {
+			path := filepath.Join(tempDir, "config.yml")
+			fixture := "storage:\n  path: $FLUIDFS_TEST_DATA/blobs\n"
+			Ω(ioutil.WriteFile(path, []byte(fixture), 0644)).Should(Succeed())
+
+			config, err := LoadConfig(path)
+			Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+			Ω(config.Storage.Path).Should(Equal(filepath.Join(tempDir, "blobs")))
+		})
+
+	})
 })
@@ -0,0 +1,82 @@
+// Cross-origin resource sharing (CORS) middleware for the C2S API.
+
+package fluid
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// CORS preflight cache duration in seconds.
+const corsMaxAge = 600
+
+//===========================================================================
+// CORS Middleware
+//===========================================================================
+
+// CORS wraps a handler so that browser-based clients served from the origins
+// allowed by the configuration can call it. Requests without an Origin
+// header or from the same origin as the API are passed through unchanged.
+// Preflight OPTIONS requests are answered directly, and requests from
+// origins that are not allowed are rejected with 403 Forbidden.
+func CORS(conf *CORSConfig, inner http.Handler) http.Handler {
+	methods := strings.Join(conf.AllowedMethods, ", ")
+	headers := strings.Join(conf.AllowedHeaders, ", ")
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		if origin == "" || sameOrigin(origin, r) {
+			inner.ServeHTTP(w, r)
+			return
+		}
+
+		// The response varies by origin, so caches must not share it.
+		w.Header().Add("Vary", "Origin")
+
+		if !conf.AllowsOrigin(origin) {
+			http.Error(w, "origin not allowed", http.StatusForbidden)
+			return
+		}
+
+		// Handle a preflight request for a cross-origin request.
+		preflight := r.Header.Get("Access-Control-Request-Method")
+		if r.Method == http.MethodOptions && preflight != "" {
+			if !ListContains(preflight, conf.AllowedMethods) {
+				http.Error(w, "method not allowed", http.StatusForbidden)
+				return
+			}
+
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+			w.Header().Set("Access-Control-Allow-Methods", methods)
+			w.Header().Set("Access-Control-Allow-Headers", headers)
+			w.Header().Set("Access-Control-Max-Age", strconv.Itoa(corsMaxAge))
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		w.Header().Set("Access-Control-Allow-Origin", origin)
+		w.Header().Set("Access-Control-Expose-Headers", HeaderRequestIDKey)
+		inner.ServeHTTP(w, r)
+	})
+}
+
+// AllowsOrigin returns true if the origin may make cross-origin requests.
+func (conf *CORSConfig) AllowsOrigin(origin string) bool {
+	for _, allowed := range conf.AllowedOrigins {
+		if allowed == "*" || strings.TrimSuffix(allowed, "/") == origin {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns true if the origin is the host the request was made to.
+func sameOrigin(origin string, r *http.Request) bool {
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	return u.Host == r.Host
+}
@@ -0,0 +1,131 @@
+package fluid_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+
+	. "github.com/bbengfort/fluidfs/fluid"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("CORS", func() {
+
+	var conf *CORSConfig
+	var handler http.Handler
+
+	BeforeEach(func() {
+		conf = new(CORSConfig)
+		conf.Defaults()
+
+		api := new(C2SAPI)
+		Ω(api.Init()).Should(Succeed())
+		handler = CORS(conf, api.Router)
+	})
+
+	// Serve a request with the origin to the CORS handler.
+	serve := func(method, origin string, headers ...string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "http://localhost:4157"+HealthEndpoint, nil)
+		if origin != "" {
+			req.Header.Set("Origin", origin)
+		}
+
+		for i := 0; i+1 < len(headers); i += 2 {
+			req.Header.Set(headers[i], headers[i+1])
+		}
+
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+
+	It("should pass through requests without an origin", func() {
+		w := serve(http.MethodGet, "")
+		Ω(w.Code).Should(Equal(http.StatusOK))
+		Ω(w.Header().Get("Access-Control-Allow-Origin")).Should(BeEmpty())
+	})
+
+	It("should allow same origin requests by default", func() {
+		w := serve(http.MethodGet, "http://localhost:4157")
+		Ω(w.Code).Should(Equal(http.StatusOK))
+		Ω(w.Header().Get("Access-Control-Allow-Origin")).Should(BeEmpty())
+	})
+
+	It("should reject cross-origin requests by default", func() {
+		w := serve(http.MethodGet, "http://example.com")
+		Ω(w.Code).Should(Equal(http.StatusForbidden))
+		Ω(w.Header().Get("Access-Control-Allow-Origin")).Should(BeEmpty())
+
+		w = serve(http.MethodOptions, "http://example.com", "Access-Control-Request-Method", "GET")
+		Ω(w.Code).Should(Equal(http.StatusForbidden))
+	})
+
+	Context("with allowed origins", func() {
+
+		BeforeEach(func() {
+			conf.AllowedOrigins = []string{"http://example.com/"}
+			Ω(conf.Validate()).Should(Succeed())
+		})
+
+		It("should respond to preflight requests", func() {
+			w := serve(http.MethodOptions, "http://example.com",
+				"Access-Control-Request-Method", "POST",
+				"Access-Control-Request-Headers", "Content-Type",
+			)
+
+			Ω(w.Code).Should(Equal(http.StatusNoContent))
+			Ω(w.Header().Get("Access-Control-Allow-Origin")).Should(Equal("http://example.com"))
+			Ω(w.Header().Get("Access-Control-Allow-Methods")).Should(Equal("GET, POST"))
+			Ω(w.Header().Get("Access-Control-Allow-Headers")).Should(ContainSubstring("Content-Type"))
+			Ω(w.Header().Get("Access-Control-Max-Age")).ShouldNot(BeEmpty())
+		})
+
+		It("should reject preflight requests for methods that are not allowed", func() {
+			w := serve(http.MethodOptions, "http://example.com", "Access-Control-Request-Method", "DELETE")
+			Ω(w.Code).Should(Equal(http.StatusForbidden))
+		})
+
+		It("should set the allowed origin on cross-origin requests", func() {
+			w := serve(http.MethodGet, "http://example.com")
+			Ω(w.Code).Should(Equal(http.StatusOK))
+			Ω(w.Header().Get("Access-Control-Allow-Origin")).Should(Equal("http://example.com"))
+			Ω(w.Header().Get("Vary")).Should(Equal("Origin"))
+		})
+
+		It("should reject origins that are not allowed", func() {
+			w := serve(http.MethodGet, "https://example.com")
+			Ω(w.Code).Should(Equal(http.StatusForbidden))
+
+			w = serve(http.MethodGet, "http://evil.example.com")
+			Ω(w.Code).Should(Equal(http.StatusForbidden))
+		})
+
+		It("should allow any origin with a wildcard", func() {
+			conf.AllowedOrigins = []string{"*"}
+			w := serve(http.MethodGet, "http://evil.example.com")
+			Ω(w.Code).Should(Equal(http.StatusOK))
+			Ω(w.Header().Get("Access-Control-Allow-Origin")).Should(Equal("http://evil.example.com"))
+		})
+
+	})
+
+	Describe("configuration", func() {
+
+		It("should not allow invalid origins", func() {
+			conf.AllowedOrigins = []string{"example.com"}
+			Ω(conf.Validate()).Should(MatchError("Improperly configured: 'example.com' is not a valid origin"))
+
+			conf.AllowedOrigins = []string{"http://example.com/path"}
+			Ω(conf.Validate()).Should(HaveOccurred())
+		})
+
+		It("should regularize allowed methods", func() {
+			conf.AllowedMethods = []string{" get", "Post "}
+			Ω(conf.Validate()).Should(Succeed())
+			Ω(conf.AllowedMethods).Should(Equal([]string{"GET", "POST"}))
+		})
+
+	})
+
+})
@@ -3,6 +3,7 @@
 package db
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
 	"time"
@@ -16,7 +17,8 @@ import (
 
 // BoltDB implements the Database interface, wrapping the BoltDB library.
 type BoltDB struct {
-	db *bolt.DB
+	db      *bolt.DB
+	Timeout time.Duration // How long to wait for the file lock, 0 waits forever
 }
 
 // Init opens a BoltDB file (creating the file if it doesn't already exist)
@@ -25,16 +27,17 @@ func (bdb *BoltDB) Init(path string) error {
 	var err error
 
 	// Open the bolt database
-	bdb.db, err = bolt.Open(path, 0644, &bolt.Options{Timeout: 15 * time.Second})
+	bdb.db, err = bolt.Open(path, 0644, &bolt.Options{Timeout: bdb.Timeout})
 	if err != nil {
-		return err
+		if err == bolt.ErrTimeout {
+			return lockedError(path, bdb.Timeout)
+		}
+		return fmt.Errorf("could not open database at %s: %s", path, err.Error())
 	}
 
 	// Create the buckets if they don't already exist
 	err = bdb.db.Update(func(tx *bolt.Tx) error {
-		buckets := []string{NamesBucket, VersionsBucket, PrefixesBucket}
-
-		for _, name := range buckets {
+		for _, name := range FluidBuckets {
 			_, err := tx.CreateBucketIfNotExists([]byte(name))
 			if err != nil {
 				return fmt.Errorf("could not create %s bucket: %s", name, err)
@@ -52,6 +55,20 @@ func (bdb *BoltDB) Close() error {
 	return bdb.db.Close()
 }
 
+// CreateBucket creates a BoltDB bucket if it doesn't already exist.
+func (bdb *BoltDB) CreateBucket(name string) error {
+	if err := validBucket(name); err != nil {
+		return err
+	}
+
+	return bdb.db.Update(func(tx *bolt.Tx) error {
+		if _, err := tx.CreateBucketIfNotExists([]byte(name)); err != nil {
+			return fmt.Errorf("could not create %s bucket: %s", name, err)
+		}
+		return nil
+	})
+}
+
 //===========================================================================
 // BoltDB interaction methods
 //===========================================================================
@@ -65,7 +82,11 @@ func (bdb *BoltDB) Get(key []byte, bucket string) ([]byte, error) {
 	// Create the transaction
 	err := bdb.db.View(func(tx *bolt.Tx) error {
 		// Get a reference to the bucket
-		bkt := tx.Bucket([]byte(bucket))
+		bkt, err := boltBucket(tx, bucket)
+		if err != nil {
+			return err
+		}
+
 		val = bkt.Get(key)
 		return nil
 	})
@@ -79,11 +100,54 @@ func (bdb *BoltDB) Get(key []byte, bucket string) ([]byte, error) {
 	return val, nil
 }
 
+// Exists checks if a key is in a bucket by seeking a BoltDB cursor to the
+// key, which does not copy the value out of the transaction.
+func (bdb *BoltDB) Exists(key []byte, bucket string) (bool, error) {
+
+	// Store whether or not the key was found
+	var found bool
+
+	// Create the transaction
+	err := bdb.db.View(func(tx *bolt.Tx) error {
+		bkt, err := boltBucket(tx, bucket)
+		if err != nil {
+			return err
+		}
+		ckey, _ := bkt.Cursor().Seek(key)
+		found = ckey != nil && bytes.Equal(ckey, key)
+		return nil
+	})
+
+	return found, err
+}
+
+// Stats counts the keys in every bucket in a single BoltDB view transaction
+// so that the counts are consistent with each other.
+func (bdb *BoltDB) Stats() (map[string]uint64, error) {
+	counts := make(map[string]uint64)
+
+	err := bdb.db.View(func(tx *bolt.Tx) error {
+		return tx.ForEach(func(name []byte, bkt *bolt.Bucket) error {
+			counts[string(name)] = uint64(bkt.Stats().KeyN)
+			return nil
+		})
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return counts, nil
+}
+
 // Put a key/value pair into the bucket using BoltDB transactions
 func (bdb *BoltDB) Put(key []byte, value []byte, bucket string) error {
 	// Create the transaction
 	return bdb.db.Update(func(tx *bolt.Tx) error {
-		bkt := tx.Bucket([]byte(bucket))
+		bkt, err := boltBucket(tx, bucket)
+		if err != nil {
+			return err
+		}
 		return bkt.Put(key, value)
 	})
 }
@@ -92,11 +156,74 @@ func (bdb *BoltDB) Put(key []byte, value []byte, bucket string) error {
 func (bdb *BoltDB) Delete(key []byte, bucket string) error {
 	// Create the transaction
 	return bdb.db.Update(func(tx *bolt.Tx) error {
-		bkt := tx.Bucket([]byte(bucket))
+		bkt, err := boltBucket(tx, bucket)
+		if err != nil {
+			return err
+		}
 		return bkt.Delete(key)
 	})
 }
 
+//===========================================================================
+// BoltDB transactions
+//===========================================================================
+
+// Update executes the function in a BoltDB read-write transaction, which is
+// committed if the function returns nil and rolled back otherwise.
+func (bdb *BoltDB) Update(fn func(Tx) error) error {
+	return bdb.db.Update(func(tx *bolt.Tx) error {
+		return fn(&boltTx{tx: tx})
+	})
+}
+
+// Implements the Tx interface by wrapping a BoltDB transaction.
+type boltTx struct {
+	tx *bolt.Tx
+}
+
+// Get a value for a key from a bucket in the transaction. The value is copied
+// since BoltDB values are only valid for the life of the transaction.
+func (t *boltTx) Get(key []byte, bucket string) ([]byte, error) {
+	bkt, err := boltBucket(t.tx, bucket)
+	if err != nil {
+		return nil, err
+	}
+
+	val := bkt.Get(key)
+	if val == nil {
+		return nil, nil
+	}
+
+	return append([]byte(nil), val...), nil
+}
+
+// Put a key/value pair into a bucket in the transaction.
+func (t *boltTx) Put(key []byte, value []byte, bucket string) error {
+	bkt, err := boltBucket(t.tx, bucket)
+	if err != nil {
+		return err
+	}
+	return bkt.Put(key, value)
+}
+
+// Delete a key from a bucket in the transaction.
+func (t *boltTx) Delete(key []byte, bucket string) error {
+	bkt, err := boltBucket(t.tx, bucket)
+	if err != nil {
+		return err
+	}
+	return bkt.Delete(key)
+}
+
+// Returns the bucket or an error rather than a nil bucket that panics.
+func boltBucket(tx *bolt.Tx, name string) (*bolt.Bucket, error) {
+	bkt := tx.Bucket([]byte(name))
+	if bkt == nil {
+		return nil, fmt.Errorf("unknown bucket '%s'", name)
+	}
+	return bkt, nil
+}
+
 //===========================================================================
 // BoltDB cursor interaction methods
 //===========================================================================
@@ -110,7 +237,10 @@ func (bdb *BoltDB) Batch(keys [][]byte, values [][]byte, bucket string) error {
 
 	return bdb.db.Batch(func(tx *bolt.Tx) error {
 
-		bkt := tx.Bucket([]byte(bucket))
+		bkt, err := boltBucket(tx, bucket)
+		if err != nil {
+			return err
+		}
 
 		for i := 0; i < len(keys); i++ {
 			if err := bkt.Put(keys[i], values[i]); err != nil {
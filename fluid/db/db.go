@@ -3,7 +3,12 @@
 // provides driver implementations for BoltDB and LevelDB.
 package db
 
-import "fmt"
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
 
 // Bucket names or prefixes used in the FluidFS application
 const (
@@ -12,6 +17,10 @@ const (
 	PrefixesBucket = "prefixes"
 )
 
+// FluidBuckets are created when the database is opened. Other subsystems can
+// add their own buckets with Database.CreateBucket.
+var FluidBuckets = []string{NamesBucket, VersionsBucket, PrefixesBucket}
+
 // Driver names for quick lookups and references
 const (
 	BoltDBDriver  = "boltdb"
@@ -30,19 +39,33 @@ var DriverNames = []string{BoltDBDriver, LevelDBDriver}
 type Database interface {
 	Init(path string) error                                    // Open a connection to the database and configure
 	Close() error                                              // Close the connection to the database
+	CreateBucket(name string) error                            // Create a bucket if it doesn't already exist
 	Get(key []byte, bucket string) ([]byte, error)             // Get a value for a key from a bucket
+	Exists(key []byte, bucket string) (bool, error)            // Check if a key is in a bucket without its value
 	Put(key []byte, value []byte, bucket string) error         // Put a key/value pair into the bucket
 	Delete(key []byte, bucket string) error                    // Delete a key from a bucket
 	Batch(keys [][]byte, values [][]byte, bucket string) error // Batch insert key/value pairs into a bucket
 	Scan(prefix []byte, bucket string) (*Cursor, error)        // Scan a group of keys with a particular prefix
 	Keys(bucket string) (*Cursor, error)                       // Returns all the keys for a bucket
+	Update(fn func(Tx) error) error                            // Atomically apply the writes in the function
+	Stats() (map[string]uint64, error)                         // Count the keys in every bucket in one pass
+}
+
+// Tx is a transaction passed to Database.Update that can read and write
+// across buckets. Writes made with the transaction are applied atomically
+// when the update function returns nil, and discarded if it returns an error.
+type Tx interface {
+	Get(key []byte, bucket string) ([]byte, error)     // Get a value for a key, including writes in the transaction
+	Put(key []byte, value []byte, bucket string) error // Put a key/value pair into the bucket
+	Delete(key []byte, bucket string) error            // Delete a key from a bucket
 }
 
 // Config defines a methods that a struct should provide to be considered a
 // database configuration, and to pass options to initialization.
 type Config interface {
-	GetDriver() string // Return a string representing a driver
-	GetPath() string   // Return the path to the database on disk
+	GetDriver() string         // Return a string representing a driver
+	GetPath() string           // Return the path to the database on disk
+	GetTimeout() time.Duration // Return how long to wait for the database lock
 }
 
 // Cursor is an interator interface that enables iteration/search over
@@ -64,9 +87,9 @@ func InitDatabase(config Config) (Database, error) {
 
 	switch config.GetDriver() {
 	case BoltDBDriver:
-		db = new(BoltDB)
+		db = &BoltDB{Timeout: config.GetTimeout()}
 	case LevelDBDriver:
-		db = new(LevelDB)
+		db = &LevelDB{Timeout: config.GetTimeout()}
 	default:
 		return nil, fmt.Errorf("unknown database driver: '%s'", config.GetDriver())
 	}
@@ -75,3 +98,23 @@ func InitDatabase(config Config) (Database, error) {
 	err := db.Init(config.GetPath())
 	return db, err
 }
+
+// Returns an error if the name cannot be used as a bucket. Bucket names may
+// not contain a slash since LevelDB separates the bucket from the key with it.
+func validBucket(name string) error {
+	if name == "" {
+		return errors.New("bucket name cannot be empty")
+	}
+
+	if strings.Contains(name, "/") {
+		return fmt.Errorf("bucket name '%s' cannot contain '/'", name)
+	}
+
+	return nil
+}
+
+// Returns the error for a database whose lock is held by another process,
+// e.g. the fluidfs daemon when the database is opened by another command.
+func lockedError(path string, timeout time.Duration) error {
+	return fmt.Errorf("could not open database at %s: locked by another process (waited %s)", path, timeout)
+}
@@ -1,10 +1,12 @@
 package db_test
 
 import (
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"time"
 
 	"github.com/bbengfort/fluidfs/fluid"
 	. "github.com/bbengfort/fluidfs/fluid/db"
@@ -116,6 +118,35 @@ var _ = Describe("Database", func() {
 			Ω(dval).Should(BeNil())
 		})
 
+		It("should be able to check if a key exists in the names bucket", func() {
+			// Fixtures
+			key := []byte("shape")
+			val := []byte("square")
+
+			// Check before the Put
+			ok, err := db.Exists(key, NamesBucket)
+			Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+			Ω(ok).Should(BeFalse())
+
+			// Do the Put
+			err = db.Put(key, val, NamesBucket)
+			Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+
+			// Check after the Put
+			ok, err = db.Exists(key, NamesBucket)
+			Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+			Ω(ok).Should(BeTrue())
+
+			// Keys that are a prefix of or in another bucket do not exist
+			ok, err = db.Exists([]byte("sha"), NamesBucket)
+			Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+			Ω(ok).Should(BeFalse())
+
+			ok, err = db.Exists(key, VersionsBucket)
+			Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+			Ω(ok).Should(BeFalse())
+		})
+
 		It("should be able to batch insert key/values", func() {
 			// Fixtures
 			keys := [][]byte{
@@ -138,6 +169,130 @@ var _ = Describe("Database", func() {
 			}
 		})
 
+		It("should atomically apply the writes in a transaction", func() {
+			err := db.Update(func(tx Tx) error {
+				if err := tx.Put([]byte("foo"), []byte("v1"), VersionsBucket); err != nil {
+					return err
+				}
+
+				// Writes are visible to reads in the transaction
+				val, err := tx.Get([]byte("foo"), VersionsBucket)
+				Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+				Ω(val).Should(Equal([]byte("v1")))
+
+				return tx.Put([]byte("foo"), []byte("bar"), NamesBucket)
+			})
+			Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+
+			val, err := db.Get([]byte("foo"), VersionsBucket)
+			Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+			Ω(val).Should(Equal([]byte("v1")))
+
+			val, err = db.Get([]byte("foo"), NamesBucket)
+			Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+			Ω(val).Should(Equal([]byte("bar")))
+		})
+
+		It("should apply none of the writes in a failed transaction", func() {
+			err := db.Put([]byte("color"), []byte("purple"), NamesBucket)
+			Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+
+			err = db.Update(func(tx Tx) error {
+				if err := tx.Put([]byte("color"), []byte("v2"), VersionsBucket); err != nil {
+					return err
+				}
+
+				if err := tx.Delete([]byte("color"), NamesBucket); err != nil {
+					return err
+				}
+
+				// Deletes are visible to reads in the transaction
+				val, err := tx.Get([]byte("color"), NamesBucket)
+				Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+				Ω(val).Should(BeNil())
+
+				return errors.New("something went wrong")
+			})
+			Ω(err).Should(MatchError("something went wrong"))
+
+			val, err := db.Get([]byte("color"), VersionsBucket)
+			Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+			Ω(val).Should(BeNil())
+
+			val, err = db.Get([]byte("color"), NamesBucket)
+			Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+			Ω(val).Should(Equal([]byte("purple")))
+		})
+
+		It("should time out if another handle holds the lock", func() {
+			config.Timeout = 100 * time.Millisecond
+			_, err := InitDatabase(config)
+			Ω(err).ShouldNot(BeNil())
+			Ω(err.Error()).Should(ContainSubstring("locked by another process"))
+		})
+
+		It("should wait for another handle to release the lock", func() {
+			other := db
+			go func() {
+				time.Sleep(100 * time.Millisecond)
+				other.Close()
+			}()
+
+			config.Timeout = 5 * time.Second
+			db, err = InitDatabase(config)
+			Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+		})
+
+		It("should count the keys in every bucket", func() {
+			keys := [][]byte{
+				[]byte("foo"), []byte("bar"), []byte("baz"),
+			}
+			vals := [][]byte{
+				[]byte("purple"), []byte("green"), []byte("orange"),
+			}
+
+			err := db.Batch(keys, vals, NamesBucket)
+			Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+
+			err = db.Put([]byte("foo"), []byte("v1"), VersionsBucket)
+			Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+
+			counts, err := db.Stats()
+			Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+			Ω(counts).Should(Equal(map[string]uint64{
+				NamesBucket: 3, VersionsBucket: 1, PrefixesBucket: 0,
+			}))
+		})
+
+		It("should create and use a custom bucket", func() {
+			// Creating a bucket more than once is not an error
+			for i := 0; i < 2; i++ {
+				err := db.CreateBucket("refcounts")
+				Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+			}
+
+			err := db.Put([]byte("foo"), []byte("2"), "refcounts")
+			Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+
+			val, err := db.Get([]byte("foo"), "refcounts")
+			Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+			Ω(val).Should(Equal([]byte("2")))
+
+			val, err = db.Get([]byte("foo"), NamesBucket)
+			Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+			Ω(val).Should(BeNil())
+
+			counts, err := db.Stats()
+			Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+			Ω(counts).Should(HaveKeyWithValue("refcounts", uint64(1)))
+			Ω(counts).Should(HaveKeyWithValue(NamesBucket, uint64(0)))
+		})
+
+		It("should not create buckets with invalid names", func() {
+			Ω(db.CreateBucket("")).Should(MatchError("bucket name cannot be empty"))
+			Ω(db.CreateBucket("ref/counts")).Should(MatchError("bucket name 'ref/counts' cannot contain '/'"))
+		})
+
 		It("should error on batch insert with mismatched key/val lengths", func() {
 			// Fixtures
 			keys := [][]byte{
@@ -151,6 +306,14 @@ var _ = Describe("Database", func() {
 			Ω(err).ShouldNot(BeNil())
 		})
 
+		It("should error on buckets that have not been created", func() {
+			err := db.Put([]byte("foo"), []byte("bar"), "refcounts")
+			Ω(err).Should(MatchError("unknown bucket 'refcounts'"))
+
+			_, err = db.Get([]byte("foo"), "refcounts")
+			Ω(err).Should(MatchError("unknown bucket 'refcounts'"))
+		})
+
 	})
 
 	Describe("LevelDB Driver", func() {
@@ -207,6 +370,35 @@ var _ = Describe("Database", func() {
 			Ω(dval).Should(BeNil())
 		})
 
+		It("should be able to check if a key exists in the names bucket", func() {
+			// Fixtures
+			key := []byte("shape")
+			val := []byte("square")
+
+			// Check before the Put
+			ok, err := db.Exists(key, NamesBucket)
+			Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+			Ω(ok).Should(BeFalse())
+
+			// Do the Put
+			err = db.Put(key, val, NamesBucket)
+			Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+
+			// Check after the Put
+			ok, err = db.Exists(key, NamesBucket)
+			Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+			Ω(ok).Should(BeTrue())
+
+			// Keys that are a prefix of or in another bucket do not exist
+			ok, err = db.Exists([]byte("sha"), NamesBucket)
+			Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+			Ω(ok).Should(BeFalse())
+
+			ok, err = db.Exists(key, VersionsBucket)
+			Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+			Ω(ok).Should(BeFalse())
+		})
+
 		It("should be able to batch insert key/values", func() {
 			// Fixtures
 			keys := [][]byte{
@@ -229,6 +421,130 @@ var _ = Describe("Database", func() {
 			}
 		})
 
+		It("should atomically apply the writes in a transaction", func() {
+			err := db.Update(func(tx Tx) error {
+				if err := tx.Put([]byte("foo"), []byte("v1"), VersionsBucket); err != nil {
+					return err
+				}
+
+				// Writes are visible to reads in the transaction
+				val, err := tx.Get([]byte("foo"), VersionsBucket)
+				Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+				Ω(val).Should(Equal([]byte("v1")))
+
+				return tx.Put([]byte("foo"), []byte("bar"), NamesBucket)
+			})
+			Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+
+			val, err := db.Get([]byte("foo"), VersionsBucket)
+			Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+			Ω(val).Should(Equal([]byte("v1")))
+
+			val, err = db.Get([]byte("foo"), NamesBucket)
+			Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+			Ω(val).Should(Equal([]byte("bar")))
+		})
+
+		It("should apply none of the writes in a failed transaction", func() {
+			err := db.Put([]byte("color"), []byte("purple"), NamesBucket)
+			Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+
+			err = db.Update(func(tx Tx) error {
+				if err := tx.Put([]byte("color"), []byte("v2"), VersionsBucket); err != nil {
+					return err
+				}
+
+				if err := tx.Delete([]byte("color"), NamesBucket); err != nil {
+					return err
+				}
+
+				// Deletes are visible to reads in the transaction
+				val, err := tx.Get([]byte("color"), NamesBucket)
+				Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+				Ω(val).Should(BeNil())
+
+				return errors.New("something went wrong")
+			})
+			Ω(err).Should(MatchError("something went wrong"))
+
+			val, err := db.Get([]byte("color"), VersionsBucket)
+			Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+			Ω(val).Should(BeNil())
+
+			val, err = db.Get([]byte("color"), NamesBucket)
+			Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+			Ω(val).Should(Equal([]byte("purple")))
+		})
+
+		It("should time out if another handle holds the lock", func() {
+			config.Timeout = 100 * time.Millisecond
+			_, err := InitDatabase(config)
+			Ω(err).ShouldNot(BeNil())
+			Ω(err.Error()).Should(ContainSubstring("locked by another process"))
+		})
+
+		It("should wait for another handle to release the lock", func() {
+			other := db
+			go func() {
+				time.Sleep(100 * time.Millisecond)
+				other.Close()
+			}()
+
+			config.Timeout = 5 * time.Second
+			db, err = InitDatabase(config)
+			Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+		})
+
+		It("should count the keys in every bucket", func() {
+			keys := [][]byte{
+				[]byte("foo"), []byte("bar"), []byte("baz"),
+			}
+			vals := [][]byte{
+				[]byte("purple"), []byte("green"), []byte("orange"),
+			}
+
+			err := db.Batch(keys, vals, NamesBucket)
+			Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+
+			err = db.Put([]byte("foo"), []byte("v1"), VersionsBucket)
+			Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+
+			counts, err := db.Stats()
+			Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+			Ω(counts).Should(Equal(map[string]uint64{
+				NamesBucket: 3, VersionsBucket: 1, PrefixesBucket: 0,
+			}))
+		})
+
+		It("should create and use a custom bucket", func() {
+			// Creating a bucket more than once is not an error
+			for i := 0; i < 2; i++ {
+				err := db.CreateBucket("refcounts")
+				Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+			}
+
+			err := db.Put([]byte("foo"), []byte("2"), "refcounts")
+			Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+
+			val, err := db.Get([]byte("foo"), "refcounts")
+			Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+			Ω(val).Should(Equal([]byte("2")))
+
+			val, err = db.Get([]byte("foo"), NamesBucket)
+			Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+			Ω(val).Should(BeNil())
+
+			counts, err := db.Stats()
+			Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+			Ω(counts).Should(HaveKeyWithValue("refcounts", uint64(1)))
+			Ω(counts).Should(HaveKeyWithValue(NamesBucket, uint64(0)))
+		})
+
+		It("should not create buckets with invalid names", func() {
+			Ω(db.CreateBucket("")).Should(MatchError("bucket name cannot be empty"))
+			Ω(db.CreateBucket("ref/counts")).Should(MatchError("bucket name 'ref/counts' cannot contain '/'"))
+		})
+
 		It("should error on batch insert with mismatched key/val lengths", func() {
 			// Fixtures
 			keys := [][]byte{
@@ -3,27 +3,61 @@
 package db
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
+	"sync"
+	"syscall"
+	"time"
 
 	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/storage"
 )
 
+// Interval between attempts to open a LevelDB that is locked.
+const lockRetryInterval = 50 * time.Millisecond
+
 //===========================================================================
 // Wrapper for LevelDB and management methods
 //===========================================================================
 
 // LevelDB implements the Database interface, wrapping the LevelDB library.
 type LevelDB struct {
-	db *leveldb.DB
+	sync.RWMutex
+	db      *leveldb.DB
+	buckets map[string]struct{} // Buckets that have been created
+	Timeout time.Duration       // How long to wait for the file lock, 0 waits forever
 }
 
 // Init opens a LevelDB file (creating the file if it doesn't already exist)
-// and initializes the buckets if they haven't already been created.
+// and initializes the buckets if they haven't already been created. LevelDB
+// fails immediately if another process holds the lock, so the open is
+// retried until the timeout like BoltDB.
 func (ldb *LevelDB) Init(path string) error {
 	var err error
-	ldb.db, err = leveldb.OpenFile(path, nil)
-	return err
+	deadline := time.Now().Add(ldb.Timeout)
+
+	ldb.buckets = make(map[string]struct{})
+	for _, name := range FluidBuckets {
+		ldb.buckets[name] = struct{}{}
+	}
+
+	for {
+		ldb.db, err = leveldb.OpenFile(path, nil)
+		if err == nil {
+			return nil
+		}
+
+		if err != syscall.EWOULDBLOCK && err != storage.ErrLocked {
+			return fmt.Errorf("could not open database at %s: %s", path, err.Error())
+		}
+
+		if ldb.Timeout > 0 && time.Now().After(deadline) {
+			return lockedError(path, ldb.Timeout)
+		}
+
+		time.Sleep(lockRetryInterval)
+	}
 }
 
 // Close the connection to the LevelDB
@@ -31,8 +65,21 @@ func (ldb *LevelDB) Close() error {
 	return ldb.db.Close()
 }
 
-// CreateBucket modifies a key using the bucket name as a prefix.
-func (ldb *LevelDB) CreateBucket(bucket string, key []byte) []byte {
+// CreateBucket registers a bucket so that it is included in the stats. Keys
+// are prefixed with their bucket name, so no other setup is required.
+func (ldb *LevelDB) CreateBucket(name string) error {
+	if err := validBucket(name); err != nil {
+		return err
+	}
+
+	ldb.Lock()
+	defer ldb.Unlock()
+	ldb.buckets[name] = struct{}{}
+	return nil
+}
+
+// PrefixKey modifies a key using the bucket name as a prefix.
+func (ldb *LevelDB) PrefixKey(bucket string, key []byte) []byte {
 	prefixed := fmt.Sprintf("%s/%s", bucket, key)
 	return []byte(prefixed)
 }
@@ -45,7 +92,7 @@ func (ldb *LevelDB) CreateBucket(bucket string, key []byte) []byte {
 // NOTE: To maintain compatibility with the BoltDB API this function does not
 // return an error on NotFound but rather returns nil value and nil error.
 func (ldb *LevelDB) Get(key []byte, bucket string) ([]byte, error) {
-	pkey := ldb.CreateBucket(bucket, key)
+	pkey := ldb.PrefixKey(bucket, key)
 	val, err := ldb.db.Get(pkey, nil)
 
 	if err == leveldb.ErrNotFound {
@@ -55,18 +102,110 @@ func (ldb *LevelDB) Get(key []byte, bucket string) ([]byte, error) {
 	return val, err
 }
 
+// Exists checks if a key is in a bucket using the LevelDB Has API.
+func (ldb *LevelDB) Exists(key []byte, bucket string) (bool, error) {
+	pkey := ldb.PrefixKey(bucket, key)
+	return ldb.db.Has(pkey, nil)
+}
+
+// Stats counts the keys in every bucket by iterating over a LevelDB snapshot
+// once and grouping the keys by their bucket prefix. The FluidFS buckets and other
+// created buckets are always included, even if they are empty, to match
+// BoltDB.
+func (ldb *LevelDB) Stats() (map[string]uint64, error) {
+	counts := make(map[string]uint64)
+
+	ldb.RLock()
+	for name := range ldb.buckets {
+		counts[name] = 0
+	}
+	ldb.RUnlock()
+
+	snap, err := ldb.db.GetSnapshot()
+	if err != nil {
+		return nil, err
+	}
+	defer snap.Release()
+
+	iter := snap.NewIterator(nil, nil)
+	defer iter.Release()
+
+	for iter.Next() {
+		key := iter.Key()
+		if idx := bytes.IndexByte(key, '/'); idx >= 0 {
+			counts[string(key[:idx])]++
+		}
+	}
+
+	return counts, iter.Error()
+}
+
 // Put a key/value pair into the bucket using the LevelDB API
 func (ldb *LevelDB) Put(key []byte, value []byte, bucket string) error {
-	pkey := ldb.CreateBucket(bucket, key)
+	pkey := ldb.PrefixKey(bucket, key)
 	return ldb.db.Put(pkey, value, nil)
 }
 
 // Delete a key from a bucket using the LevelDB API
 func (ldb *LevelDB) Delete(key []byte, bucket string) error {
-	pkey := ldb.CreateBucket(bucket, key)
+	pkey := ldb.PrefixKey(bucket, key)
 	return ldb.db.Delete(pkey, nil)
 }
 
+//===========================================================================
+// LevelDB transactions
+//===========================================================================
+
+// Update collects the writes made by the function in a LevelDB write batch,
+// which is written atomically if the function returns nil and discarded
+// otherwise. Note that reads are not isolated from other writers.
+func (ldb *LevelDB) Update(fn func(Tx) error) error {
+	tx := &levelTx{
+		ldb:     ldb,
+		batch:   new(leveldb.Batch),
+		pending: make(map[string][]byte),
+	}
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+
+	return ldb.db.Write(tx.batch, nil)
+}
+
+// Implements the Tx interface by collecting writes in a LevelDB batch.
+type levelTx struct {
+	ldb     *LevelDB
+	batch   *leveldb.Batch
+	pending map[string][]byte // Values written in the batch, nil if deleted
+}
+
+// Get a value for a key from a bucket, checking the writes in the batch
+// before reading from the database.
+func (t *levelTx) Get(key []byte, bucket string) ([]byte, error) {
+	pkey := t.ldb.PrefixKey(bucket, key)
+	if val, ok := t.pending[string(pkey)]; ok {
+		return val, nil
+	}
+	return t.ldb.Get(key, bucket)
+}
+
+// Put a key/value pair into a bucket in the batch.
+func (t *levelTx) Put(key []byte, value []byte, bucket string) error {
+	pkey := t.ldb.PrefixKey(bucket, key)
+	t.pending[string(pkey)] = value
+	t.batch.Put(pkey, value)
+	return nil
+}
+
+// Delete a key from a bucket in the batch.
+func (t *levelTx) Delete(key []byte, bucket string) error {
+	pkey := t.ldb.PrefixKey(bucket, key)
+	t.pending[string(pkey)] = nil
+	t.batch.Delete(pkey)
+	return nil
+}
+
 //===========================================================================
 // LevelDB cursor interaction methods
 //===========================================================================
@@ -83,7 +222,7 @@ func (ldb *LevelDB) Batch(keys [][]byte, values [][]byte, bucket string) error {
 	batch := new(leveldb.Batch)
 
 	for i := 0; i < len(keys); i++ {
-		pkey = ldb.CreateBucket(bucket, keys[i])
+		pkey = ldb.PrefixKey(bucket, keys[i])
 		batch.Put(pkey, values[i])
 	}
 
@@ -4,7 +4,10 @@ package fluid
 
 import (
 	"os"
+	"path/filepath"
+	"strings"
 	"time"
+	"unicode"
 
 	"bazil.org/fuse"
 	"bazil.org/fuse/fs"
@@ -22,16 +25,23 @@ import (
 type Dir struct {
 	Node
 	Children map[string]Entity // Contents of the directory
+	folded   map[string]string // Keys of Children by folded name, if casefold
 }
 
 // Init the directory with the required properties for the directory.
-func (d *Dir) Init(name string, mode os.FileMode, parent *Dir, memfs *FileSystem) {
+func (d *Dir) Init(name string, mode os.FileMode, parent *Dir, memfs *FileSystem) error {
 	// Make sure the mode is a directory, then init the node.
 	mode = os.ModeDir | mode
-	d.Node.Init(name, mode, parent, memfs)
+	if err := d.Node.Init(name, mode, parent, memfs); err != nil {
+		return err
+	}
 
-	// Make the children mapping
+	// Make the children mapping and the index of folded names
 	d.Children = make(map[string]Entity)
+	if memfs.casefold {
+		d.folded = make(map[string]string)
+	}
+	return nil
 }
 
 //===========================================================================
@@ -43,6 +53,58 @@ func (d *Dir) GetNode() *Node {
 	return &d.Node
 }
 
+// Find the child entity with the name, returning the name it is stored under
+// in the Children map. If the file system folds case, names that differ only
+// in case match, though an exact match is always preferred; names are stored
+// with the case they were created with. Must be called with the fs locked.
+func (d *Dir) entry(name string) (string, Entity, bool) {
+	if ent, ok := d.Children[name]; ok {
+		return name, ent, true
+	}
+
+	if d.folded != nil {
+		if key, ok := d.folded[foldName(name)]; ok {
+			return key, d.Children[key], true
+		}
+	}
+
+	return "", nil, false
+}
+
+// Add the entity to the Children under the name, indexing its folded name if
+// the file system folds case. Callers must ensure that no entry matches the
+// name before inserting it. Must be called with the fs locked.
+func (d *Dir) insert(name string, ent Entity) {
+	d.Children[name] = ent
+	if d.folded != nil {
+		d.folded[foldName(name)] = name
+	}
+}
+
+// Delete the entity stored under the key in the Children and its folded name
+// from the index. Must be called with the fs locked.
+func (d *Dir) remove(key string) {
+	delete(d.Children, key)
+	if d.folded != nil {
+		delete(d.folded, foldName(key))
+	}
+}
+
+// Returns the name with every character replaced by the smallest character it
+// is equivalent to under Unicode simple case folding, so that two names have
+// the same folded name exactly when strings.EqualFold reports them equal.
+func foldName(name string) string {
+	return strings.Map(func(r rune) rune {
+		min := r
+		for f := unicode.SimpleFold(r); f != r; f = unicode.SimpleFold(f) {
+			if f < min {
+				min = f
+			}
+		}
+		return min
+	}, name)
+}
+
 //===========================================================================
 // Dir fuse.Node* Interface
 //===========================================================================
@@ -53,6 +115,8 @@ func (d *Dir) GetNode() *Node {
 //
 // https://godoc.org/bazil.org/fuse/fs#NodeCreater
 func (d *Dir) Create(ctx context.Context, req *fuse.CreateRequest, resp *fuse.CreateResponse) (fs.Node, fs.Handle, error) {
+	defer d.fs.acquire()()
+
 	// if d.IsArchive() || d.fs.readonly {
 	// 	return nil, nil, fuse.EPERM
 	// }
@@ -60,19 +124,47 @@ func (d *Dir) Create(ctx context.Context, req *fuse.CreateRequest, resp *fuse.Cr
 	d.fs.Lock()
 	defer d.fs.Unlock()
 
+	// Reject modifications while the file system is in maintenance mode
+	if err := d.fs.writable(); err != nil {
+		return nil, nil, err
+	}
+
 	// Update the directory Atime
-	d.Attrs.Atime = time.Now()
+	d.access()
+
+	// Do not overwrite an existing entry, e.g. one differing only in case.
+	// The check and the creation are atomic under the lock, so of concurrent
+	// creates of the same name only one creates the file; the others open it
+	// unless the create is exclusive (O_EXCL) or the entry is not a file.
+	if key, ent, ok := d.entry(req.Name); ok {
+		f, isFile := ent.(*File)
+		if !isFile || req.Flags&fuse.OpenExclusive != 0 {
+			logger.Debug("(error) cannot create %q in %q, %q exists", req.Name, d.Path(), key)
+			return nil, nil, fuse.EEXIST
+		}
+
+		// Truncate the existing file if requested, as open(2) would.
+		if req.Flags&fuse.OpenTruncate != 0 {
+			f.truncate()
+		}
+
+		logger.Debug("create %q in %q opened existing file %q", req.Name, d.Path(), key)
+		return f, f, nil
+	}
 
-	// Create the file
+	// Create the file, clearing the umask bits from the mode
 	f := new(File)
-	f.Init(req.Name, req.Mode, d, d.fs)
+	if err := f.Init(req.Name, req.Mode&^d.fs.umask, d, d.fs); err != nil {
+		logger.Error("could not create %q in %q: %s", req.Name, d.Path(), err)
+		return nil, nil, fuse.EIO
+	}
 
 	// Set the file's UID and GID to that of the caller
 	f.Attrs.Uid = req.Header.Uid
 	f.Attrs.Gid = req.Header.Gid
 
 	// Add the file to the directory
-	d.Children[f.Name] = f
+	d.insert(f.Name, f)
 
 	// Update the directory Mtime
 	d.Attrs.Mtime = time.Now()
@@ -81,6 +173,7 @@ func (d *Dir) Create(ctx context.Context, req *fuse.CreateRequest, resp *fuse.Cr
 	d.fs.nfiles++
 
 	// Log the file creation and return the file, which is both node and handle.
+	d.fs.publish(EventCreate, f.Path(), "")
 	logger.Info("create %q in %q, mode %v", f.Name, d.Path(), req.Mode)
 	return f, f, nil
 }
@@ -91,16 +184,60 @@ func (d *Dir) Create(ctx context.Context, req *fuse.CreateRequest, resp *fuse.Cr
 // A LinkRequest is a request to create a hard link and contains the old node
 // ID and the NewName (a string), the old node is supplied to the server.
 //
+// Hard links to directories or any other node that is not a regular file
+// are forbidden as in Unix, returning EPERM.
+//
 // https://godoc.org/bazil.org/fuse/fs#NodeLinker
-// TODO: Implement
-// func (d *Dir) Link(ctx context.Context, req *fuse.LinkRequest, old Node) (fs.Node, error) {
-// 	return nil, nil
-// }
+func (d *Dir) Link(ctx context.Context, req *fuse.LinkRequest, old fs.Node) (fs.Node, error) {
+	defer d.fs.acquire()()
+
+	if d.IsArchive() || d.fs.readonly {
+		return nil, fuse.EPERM
+	}
+
+	// Only regular files can be hard linked.
+	f, ok := old.(*File)
+	if !ok {
+		logger.Debug("(error) will not hard link a non-file as %q in %q", req.NewName, d.Path())
+		return nil, fuse.EPERM
+	}
+
+	d.fs.Lock()
+	defer d.fs.Unlock()
+
+	// Reject modifications while the file system is in maintenance mode
+	if err := d.fs.writable(); err != nil {
+		return nil, err
+	}
+
+	// Update the directory Atime
+	d.access()
+
+	// Do not overwrite an existing entry
+	if key, _, ok := d.entry(req.NewName); ok {
+		logger.Debug("(error) cannot link %q in %q, %q exists", req.NewName, d.Path(), key)
+		return nil, fuse.EEXIST
+	}
+
+	// Add the file to the directory and update the link count
+	d.insert(req.NewName, f)
+	f.Attrs.Nlink++
+	f.Attrs.Ctime = time.Now()
+
+	// Update the directory Mtime
+	d.Attrs.Mtime = time.Now()
+
+	// Log the link and return the linked file
+	logger.Info("linked %q in %q to file %d", req.NewName, d.Path(), f.ID)
+	return f, nil
+}
 
 // Mkdir creates (but not opens) a directory in the given directory.
 //
 // https://godoc.org/bazil.org/fuse/fs#NodeMkdirer
 func (d *Dir) Mkdir(ctx context.Context, req *fuse.MkdirRequest) (fs.Node, error) {
+	defer d.fs.acquire()()
+
 	if d.IsArchive() || d.fs.readonly {
 		return nil, fuse.EPERM
 	}
@@ -108,21 +245,35 @@ func (d *Dir) Mkdir(ctx context.Context, req *fuse.MkdirRequest) (fs.Node, error
 	d.fs.Lock()
 	defer d.fs.Unlock()
 
+	// Reject modifications while the file system is in maintenance mode
+	if err := d.fs.writable(); err != nil {
+		return nil, err
+	}
+
 	// Update the directory Atime
-	d.Attrs.Atime = time.Now()
+	d.access()
 
 	// TODO: Allow for the creation of archive directories
 
-	// Create the child directory
+	// Do not overwrite an existing entry, e.g. one differing only in case
+	if key, _, ok := d.entry(req.Name); ok {
+		logger.Debug("(error) cannot mkdir %q in %q, %q exists", req.Name, d.Path(), key)
+		return nil, fuse.EEXIST
+	}
+
+	// Create the child directory, clearing the umask bits from the mode
 	c := new(Dir)
-	c.Init(req.Name, req.Mode, d, d.fs)
+	if err := c.Init(req.Name, req.Mode&^d.fs.umask, d, d.fs); err != nil {
+		logger.Error("could not mkdir %q in %q: %s", req.Name, d.Path(), err)
+		return nil, fuse.EIO
+	}
 
 	// Set the directory's UID and GID to that of the caller
 	c.Attrs.Uid = req.Header.Uid
 	c.Attrs.Gid = req.Header.Gid
 
 	// Add the directory to the directory
-	d.Children[c.Name] = c
+	d.insert(c.Name, c)
 
 	// Update the directory Mtime
 	d.Attrs.Mtime = time.Now()
@@ -131,6 +282,7 @@ func (d *Dir) Mkdir(ctx context.Context, req *fuse.MkdirRequest) (fs.Node, error
 	d.fs.ndirs++
 
 	// Log the directory creation and return the dir node
+	d.fs.publish(EventMkdir, c.Path(), "")
 	logger.Info("mkdir %q in %q, mode %v", c.Name, d.Path(), req.Mode)
 	return c, nil
 }
@@ -149,6 +301,8 @@ func (d *Dir) Mkdir(ctx context.Context, req *fuse.MkdirRequest) (fs.Node, error
 //
 // https://godoc.org/bazil.org/fuse/fs#NodeRemover
 func (d *Dir) Remove(ctx context.Context, req *fuse.RemoveRequest) error {
+	defer d.fs.acquire()()
+
 	if d.IsArchive() || d.fs.readonly {
 		return fuse.EPERM
 	}
@@ -156,14 +310,17 @@ func (d *Dir) Remove(ctx context.Context, req *fuse.RemoveRequest) error {
 	d.fs.Lock()
 	defer d.fs.Unlock()
 
-	// Update the directory Atime
-	d.Attrs.Atime = time.Now()
+	// Reject modifications while the file system is in maintenance mode
+	if err := d.fs.writable(); err != nil {
+		return err
+	}
 
-	var ent Entity
-	var ok bool
+	// Update the directory Atime
+	d.access()
 
 	// Get the node from the directory by name.
-	if ent, ok = d.Children[req.Name]; !ok {
+	key, ent, ok := d.entry(req.Name)
+	if !ok {
 		logger.Debug("(error) could not find node to remove named %q in %q", req.Name, d.Path())
 		return fuse.EEXIST
 	}
@@ -175,19 +332,23 @@ func (d *Dir) Remove(ctx context.Context, req *fuse.RemoveRequest) error {
 	}
 
 	// Delete the entry from the directory Children
-	delete(d.Children, req.Name)
+	d.remove(key)
 
 	// Update the directory Mtime
 	d.Attrs.Mtime = time.Now()
 
-	// Update the file system state
+	// Update the file system state, files are only removed with the last link
 	if ent.IsDir() {
 		d.fs.ndirs--
 	} else {
-		d.fs.nfiles--
+		f := ent.(*File)
+		if f.Attrs.Nlink--; f.Attrs.Nlink == 0 {
+			d.fs.nfiles--
+		}
 	}
 
 	// Log the directory removal and return no error
+	d.fs.publish(EventRemove, filepath.Join(d.Path(), key), "")
 	logger.Info("removed %q from %q", req.Name, d.Path())
 	return nil
 }
@@ -197,6 +358,8 @@ func (d *Dir) Remove(ctx context.Context, req *fuse.RemoveRequest) error {
 //
 // https://godoc.org/bazil.org/fuse/fs#NodeRenamer
 func (d *Dir) Rename(ctx context.Context, req *fuse.RenameRequest, newDir fs.Node) error {
+	defer d.fs.acquire()()
+
 	if d.IsArchive() || d.fs.readonly {
 		return fuse.EPERM
 	}
@@ -204,11 +367,17 @@ func (d *Dir) Rename(ctx context.Context, req *fuse.RenameRequest, newDir fs.Nod
 	d.fs.Lock()
 	defer d.fs.Unlock()
 
+	// Reject modifications while the file system is in maintenance mode
+	if err := d.fs.writable(); err != nil {
+		return err
+	}
+
 	// Update the directory Atime
-	d.Attrs.Atime = time.Now()
+	d.access()
 
 	var dst *Dir
 	var ok bool
+	var key string
 	var ent Entity
 	var node *Node
 
@@ -219,29 +388,52 @@ func (d *Dir) Rename(ctx context.Context, req *fuse.RenameRequest, newDir fs.Nod
 	}
 
 	// Update the dst directory Atime
-	dst.Attrs.Atime = time.Now()
+	dst.access()
 
 	// Get the child entity from the directory
-	if ent, ok = d.Children[req.OldName]; !ok {
+	if key, ent, ok = d.entry(req.OldName); !ok {
 		logger.Debug("(error) could not find %q in %q to move", req.OldName, d.Path())
 		return fuse.EEXIST
 	}
 
 	// Get the node from the entity and update attrs.
+	oldpath := ent.Path()
 	node = ent.GetNode()
 	node.Name = req.NewName
 	node.Attrs.Mtime = time.Now()
 
-	dst.Children[req.NewName] = ent // Add the entity to the new directory
-	dst.Attrs.Mtime = time.Now()
-
-	delete(dst.Children, req.OldName) // Delete the entity from the old directory
+	d.remove(key) // Delete the entity from the old directory
 	d.Attrs.Mtime = time.Now()
 
+	// Replace any existing entry, including one that differs only in case.
+	if key, _, ok = dst.entry(req.NewName); ok {
+		dst.remove(key)
+	}
+
+	dst.insert(req.NewName, ent) // Add the entity to the new directory
+	dst.Attrs.Mtime = time.Now()
+	node.Parent = dst
+
+	d.fs.publish(EventRename, ent.Path(), oldpath)
 	logger.Info("moved %q from %q to %q", req.OldName, d.Path(), ent.Path())
 	return nil
 }
 
+// Fsync is called when an application syncs a directory, e.g. to ensure a
+// rename is durable. Without it, FUSE returns EIO to the application. The
+// namespace is currently held in memory, so there is nothing to flush.
+//
+// https://godoc.org/bazil.org/fuse/fs#NodeFsyncer
+func (d *Dir) Fsync(ctx context.Context, req *fuse.FsyncRequest) error {
+	defer d.fs.acquire()()
+
+	d.fs.Lock()
+	defer d.fs.Unlock()
+
+	logger.Debug("fsync on dir %d", d.ID)
+	return nil
+}
+
 // Lookup looks up a specific entry in the receiver,
 // which must be a directory.  Lookup should return a Node
 // corresponding to the entry.  If the name does not exist in
@@ -253,14 +445,15 @@ func (d *Dir) Rename(ctx context.Context, req *fuse.RenameRequest, newDir fs.Nod
 // NOTE: implemented NodeStringLookuper rather than NodeRequestLookuper
 // https://godoc.org/bazil.org/fuse/fs#NodeRequestLookuper
 func (d *Dir) Lookup(ctx context.Context, name string) (fs.Node, error) {
+	defer d.fs.acquire()()
 
 	d.fs.Lock()
 	defer d.fs.Unlock()
 
 	// Update the directory Atime
-	d.Attrs.Atime = time.Now()
+	d.access()
 
-	if ent, ok := d.Children[name]; ok {
+	if _, ent, ok := d.entry(name); ok {
 		logger.Debug("lookup %s in %s", name, d.Path())
 
 		if ent.IsDir() {
@@ -292,13 +485,15 @@ func (d *Dir) Lookup(ctx context.Context, name string) (fs.Node, error) {
 //
 // https://godoc.org/bazil.org/fuse/fs#HandleReadDirAller
 func (d *Dir) ReadDirAll(ctx context.Context) ([]fuse.Dirent, error) {
+	defer d.fs.acquire()()
+
 	contents := make([]fuse.Dirent, 0, len(d.Children))
 
 	d.fs.Lock()
 	defer d.fs.Unlock()
 
 	// Set the access time
-	d.Attrs.Atime = time.Now()
+	d.access()
 
 	// Create the Dirent response
 	for _, entity := range d.Children {
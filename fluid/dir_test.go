@@ -0,0 +1,354 @@
+package fluid_test
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+
+	"bazil.org/fuse"
+	"golang.org/x/net/context"
+
+	. "github.com/bbengfort/fluidfs/fluid"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Dir", func() {
+
+	var ctx context.Context
+	var root *Dir
+
+	BeforeEach(func() {
+		ctx = context.Background()
+
+		node, err := newFileSystem().Root()
+		Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+		root = node.(*Dir)
+	})
+
+	It("should fsync a directory after a create", func() {
+		req := &fuse.CreateRequest{Name: "test.txt", Mode: 0644}
+		_, _, err := root.Create(ctx, req, new(fuse.CreateResponse))
+		Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+
+		fsync := &fuse.FsyncRequest{Dir: true}
+		Ω(root.Fsync(ctx, fsync)).Should(Succeed())
+
+		node, err := root.Lookup(ctx, "test.txt")
+		Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+		Ω(node.(*File).Name).Should(Equal("test.txt"))
+	})
+
+	Describe("creating existing names", func() {
+
+		// Create a file in the root directory with the open flags.
+		create := func(name string, flags fuse.OpenFlags) (*File, error) {
+			req := &fuse.CreateRequest{Name: name, Mode: 0644, Flags: flags}
+			node, _, err := root.Create(ctx, req, new(fuse.CreateResponse))
+			if err != nil {
+				return nil, err
+			}
+			return node.(*File), nil
+		}
+
+		It("should only create a file once with concurrent exclusive creates", func() {
+			var wg sync.WaitGroup
+			var created, exists int64
+
+			for i := 0; i < 50; i++ {
+				wg.Add(1)
+				go func() {
+					defer GinkgoRecover()
+					defer wg.Done()
+
+					_, err := create("test.txt", fuse.OpenReadWrite|fuse.OpenCreate|fuse.OpenExclusive)
+					switch err {
+					case nil:
+						atomic.AddInt64(&created, 1)
+					case fuse.EEXIST:
+						atomic.AddInt64(&exists, 1)
+					default:
+						Fail(fmt.Sprintf("unexpected error: %s", err))
+					}
+				}()
+			}
+
+			wg.Wait()
+			Ω(created).Should(Equal(int64(1)))
+			Ω(exists).Should(Equal(int64(49)))
+			Ω(root.Children).Should(HaveLen(1))
+		})
+
+		It("should open the existing file with concurrent non-exclusive creates", func() {
+			var wg sync.WaitGroup
+			files := make(chan *File, 50)
+
+			for i := 0; i < 50; i++ {
+				wg.Add(1)
+				go func() {
+					defer GinkgoRecover()
+					defer wg.Done()
+
+					file, err := create("test.txt", fuse.OpenReadWrite|fuse.OpenCreate)
+					Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+					files <- file
+				}()
+			}
+
+			wg.Wait()
+			close(files)
+
+			first := <-files
+			for file := range files {
+				Ω(file).Should(BeIdenticalTo(first))
+			}
+			Ω(root.Children).Should(HaveLen(1))
+		})
+
+		It("should truncate an existing file with O_TRUNC", func() {
+			file, err := create("test.txt", fuse.OpenExclusive)
+			Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+
+			wreq := &fuse.WriteRequest{Data: []byte("hello world")}
+			Ω(file.Write(ctx, wreq, new(fuse.WriteResponse))).Should(Succeed())
+
+			same, err := create("test.txt", 0)
+			Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+			Ω(same.Attrs.Size).Should(Equal(uint64(11)))
+
+			same, err = create("test.txt", fuse.OpenTruncate)
+			Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+			Ω(same).Should(BeIdenticalTo(file))
+			Ω(file.Attrs.Size).Should(BeZero())
+			Ω(file.Data).Should(BeEmpty())
+			Ω(file.Consistent()).Should(Succeed())
+		})
+
+		It("should not create a file over a directory", func() {
+			_, err := root.Mkdir(ctx, &fuse.MkdirRequest{Name: "sub", Mode: 0755})
+			Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+
+			_, err = create("sub", 0)
+			Ω(err).Should(Equal(fuse.EEXIST))
+		})
+
+	})
+
+	It("should not hard link a directory", func() {
+		node, err := root.Mkdir(ctx, &fuse.MkdirRequest{Name: "sub", Mode: 0755})
+		Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+
+		req := &fuse.LinkRequest{NewName: "link"}
+		_, err = root.Link(ctx, req, node)
+		Ω(err).Should(Equal(fuse.EPERM))
+
+		_, err = root.Lookup(ctx, "link")
+		Ω(err).Should(Equal(fuse.ENOENT))
+	})
+
+	It("should hard link a file", func() {
+		req := &fuse.CreateRequest{Name: "test.txt", Mode: 0644}
+		node, _, err := root.Create(ctx, req, new(fuse.CreateResponse))
+		Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+
+		link, err := root.Link(ctx, &fuse.LinkRequest{NewName: "link.txt"}, node)
+		Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+		Ω(link).Should(BeIdenticalTo(node))
+		Ω(node.(*File).Attrs.Nlink).Should(Equal(uint32(2)))
+
+		_, err = root.Link(ctx, &fuse.LinkRequest{NewName: "link.txt"}, node)
+		Ω(err).Should(Equal(fuse.EEXIST))
+
+		Ω(root.Remove(ctx, &fuse.RemoveRequest{Name: "test.txt"})).Should(Succeed())
+		Ω(node.(*File).Attrs.Nlink).Should(Equal(uint32(1)))
+
+		found, err := root.Lookup(ctx, "link.txt")
+		Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+		Ω(found).Should(BeIdenticalTo(node))
+	})
+
+	It("should apply the mount umask to created files and directories", func() {
+		node, err := newFileSystem("umask=027").Root()
+		Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+		root = node.(*Dir)
+
+		req := &fuse.CreateRequest{Name: "test.txt", Mode: 0666}
+		file, _, err := root.Create(ctx, req, new(fuse.CreateResponse))
+		Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+		Ω(file.(*File).Attrs.Mode).Should(Equal(os.FileMode(0640)))
+
+		dir, err := root.Mkdir(ctx, &fuse.MkdirRequest{Name: "sub", Mode: 0777})
+		Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+		Ω(dir.(*Dir).Attrs.Mode).Should(Equal(os.ModeDir | 0750))
+	})
+
+	It("should not create a file system with an invalid umask", func() {
+		fs := new(FileSystem)
+		err := fs.Init(&MountPoint{Prefix: "testing", Options: []string{"umask=999"}})
+		Ω(err).Should(HaveOccurred())
+	})
+
+	Describe("case folding", func() {
+
+		// Create a file in the root directory.
+		create := func(name string) (*File, error) {
+			req := &fuse.CreateRequest{Name: name, Mode: 0644}
+			node, _, err := root.Create(ctx, req, new(fuse.CreateResponse))
+			if err != nil {
+				return nil, err
+			}
+			return node.(*File), nil
+		}
+
+		It("should be case sensitive by default", func() {
+			_, err := create("file.txt")
+			Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+
+			_, err = root.Lookup(ctx, "FILE.TXT")
+			Ω(err).Should(Equal(fuse.ENOENT))
+
+			// Names differing only in case are different files.
+			_, err = create("FILE.TXT")
+			Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+			Ω(root.Children).Should(HaveLen(2))
+		})
+
+		Context("with the casefold option", func() {
+
+			BeforeEach(func() {
+				node, err := newFileSystem("casefold").Root()
+				Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+				root = node.(*Dir)
+			})
+
+			It("should lookup names regardless of case", func() {
+				file, err := create("file.txt")
+				Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+
+				for _, name := range []string{"file.txt", "FILE.TXT", "File.Txt"} {
+					node, err := root.Lookup(ctx, name)
+					Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+					Ω(node).Should(BeIdenticalTo(file))
+				}
+			})
+
+			It("should preserve the case of names", func() {
+				_, err := create("File.txt")
+				Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+
+				dirents, err := root.ReadDirAll(ctx)
+				Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+				Ω(dirents).Should(HaveLen(1))
+				Ω(dirents[0].Name).Should(Equal("File.txt"))
+			})
+
+			It("should not create names that differ only in case", func() {
+				file, err := create("file.txt")
+				Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+
+				// A non-exclusive create opens the existing file
+				node, err := create("FILE.TXT")
+				Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+				Ω(node).Should(BeIdenticalTo(file))
+
+				req := &fuse.CreateRequest{Name: "FILE.TXT", Mode: 0644, Flags: fuse.OpenExclusive}
+				_, _, err = root.Create(ctx, req, new(fuse.CreateResponse))
+				Ω(err).Should(Equal(fuse.EEXIST))
+
+				_, err = root.Mkdir(ctx, &fuse.MkdirRequest{Name: "File.Txt", Mode: 0755})
+				Ω(err).Should(Equal(fuse.EEXIST))
+				Ω(root.Children).Should(HaveLen(1))
+			})
+
+			It("should remove names regardless of case", func() {
+				_, err := create("file.txt")
+				Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+
+				Ω(root.Remove(ctx, &fuse.RemoveRequest{Name: "FILE.TXT"})).Should(Succeed())
+				Ω(root.Children).Should(BeEmpty())
+			})
+
+			It("should rename a file to change its case", func() {
+				file, err := create("file.txt")
+				Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+
+				req := &fuse.RenameRequest{OldName: "file.txt", NewName: "FILE.txt"}
+				Ω(root.Rename(ctx, req, root)).Should(Succeed())
+				Ω(root.Children).Should(HaveLen(1))
+				Ω(root.Children).Should(HaveKey("FILE.txt"))
+				Ω(file.Name).Should(Equal("FILE.txt"))
+			})
+
+			It("should replace an entry differing in case when renaming", func() {
+				_, err := create("a.txt")
+				Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+				file, err := create("b.txt")
+				Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+
+				req := &fuse.RenameRequest{OldName: "B.TXT", NewName: "A.txt"}
+				Ω(root.Rename(ctx, req, root)).Should(Succeed())
+				Ω(root.Children).Should(HaveLen(1))
+
+				node, err := root.Lookup(ctx, "a.txt")
+				Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+				Ω(node).Should(BeIdenticalTo(file))
+			})
+
+			It("should not find names that were removed or renamed", func() {
+				_, err := create("a.txt")
+				Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+				_, err = create("b.txt")
+				Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+
+				Ω(root.Remove(ctx, &fuse.RemoveRequest{Name: "A.TXT"})).Should(Succeed())
+				_, err = root.Lookup(ctx, "A.txt")
+				Ω(err).Should(Equal(fuse.ENOENT))
+
+				req := &fuse.RenameRequest{OldName: "b.txt", NewName: "c.txt"}
+				Ω(root.Rename(ctx, req, root)).Should(Succeed())
+				_, err = root.Lookup(ctx, "B.TXT")
+				Ω(err).Should(Equal(fuse.ENOENT))
+				_, err = root.Lookup(ctx, "C.TXT")
+				Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+
+				// A removed name can be created again with a different case.
+				_, err = create("A.TXT")
+				Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+				Ω(root.Children).Should(HaveKey("A.TXT"))
+			})
+
+			It("should fold names as strings.EqualFold does", func() {
+				file, err := create("straße-\u212a.txt")
+				Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+
+				// The Kelvin sign folds to K, though ß does not fold to ss.
+				node, err := root.Lookup(ctx, "STRAẞE-k.TXT")
+				Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+				Ω(node).Should(BeIdenticalTo(file))
+
+				_, err = root.Lookup(ctx, "strasse-k.txt")
+				Ω(err).Should(Equal(fuse.ENOENT))
+			})
+
+		})
+
+	})
+
+	It("should move an entry between directories", func() {
+		node, err := root.Mkdir(ctx, &fuse.MkdirRequest{Name: "sub", Mode: 0755})
+		Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+		sub := node.(*Dir)
+
+		req := &fuse.CreateRequest{Name: "test.txt", Mode: 0644}
+		_, _, err = root.Create(ctx, req, new(fuse.CreateResponse))
+		Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+
+		rename := &fuse.RenameRequest{OldName: "test.txt", NewName: "moved.txt"}
+		Ω(root.Rename(ctx, rename, sub)).Should(Succeed())
+		Ω(root.Children).ShouldNot(HaveKey("test.txt"))
+		Ω(sub.Children).Should(HaveKey("moved.txt"))
+	})
+
+})
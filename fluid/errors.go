@@ -1,14 +1,111 @@
 package fluid
 
-import "fmt"
+import (
+	"fmt"
+	"net/http"
+)
+
+// Error codes for the errors returned by the fluid package.
+const (
+	ErrUnknown              = iota // An unclassified error
+	ErrImproperlyConfigured        // The configuration is missing or invalid
+	ErrDatabase                    // The database could not be read or written
+	ErrInvalidReplica              // The replica is not known or is misconfigured
+	ErrInvalidRequest              // A request is missing arguments or is malformed
+	ErrNotFound                    // A mount point, file or directory does not exist
+	ErrUnavailable                 // The replica is not ready to handle the request
+)
+
+// ErrorCode describes an error code for reference and for responding to API
+// requests with the appropriate HTTP status.
+type ErrorCode struct {
+	Code        int    // The internal fluid error code
+	Name        string // The symbolic name of the code
+	Description string // What the code means
+	Status      int    // The HTTP status code for the error
+}
+
+// The error codes, indexed by code.
+var errorCodes = []ErrorCode{
+	{ErrUnknown, "ErrUnknown", "an unclassified error", http.StatusInternalServerError},
+	{ErrImproperlyConfigured, "ErrImproperlyConfigured", "the configuration is missing or invalid", http.StatusInternalServerError},
+	{ErrDatabase, "ErrDatabase", "the database could not be read or written", http.StatusInternalServerError},
+	{ErrInvalidReplica, "ErrInvalidReplica", "the replica is not known or is misconfigured", http.StatusBadRequest},
+	{ErrInvalidRequest, "ErrInvalidRequest", "a request is missing arguments or is malformed", http.StatusBadRequest},
+	{ErrNotFound, "ErrNotFound", "a mount point, file or directory does not exist", http.StatusNotFound},
+	{ErrUnavailable, "ErrUnavailable", "the replica is not ready to handle the request", http.StatusServiceUnavailable},
+}
+
+// ErrorCodes returns the reference of all error codes in order.
+func ErrorCodes() []ErrorCode {
+	codes := make([]ErrorCode, len(errorCodes))
+	copy(codes, errorCodes)
+	return codes
+}
+
+// Returns the reference for the code, or for unknown errors if the code is
+// not defined.
+func lookupErrorCode(code int) ErrorCode {
+	if code < 0 || code >= len(errorCodes) {
+		return errorCodes[ErrUnknown]
+	}
+	return errorCodes[code]
+}
 
 // Error defines custom error handling for the fluid package.
 type Error struct {
 	Code    int    // The internal fluid error code
 	Message string // The string description of the error
+	err     error  // The underlying error, if any
 }
 
-// Error implements the errors.Error interface.
+// NewError creates an error with the code and a formatted message.
+func NewError(code int, format string, args ...interface{}) *Error {
+	return &Error{Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+// WrapError creates an error with the code and a formatted message that
+// wraps the underlying error, which is included in the error string.
+func WrapError(code int, err error, format string, args ...interface{}) *Error {
+	return &Error{Code: code, Message: fmt.Sprintf(format, args...), err: err}
+}
+
+// Error implements the errors.Error interface, prefixing the message with
+// the symbolic name of the code, e.g. "[ErrDatabase] could not open".
 func (err *Error) Error() string {
-	return fmt.Sprintf("Error %d: %s", err.Code, err.Message)
+	if err.err != nil {
+		return fmt.Sprintf("[%s] %s: %s", err.CodeName(), err.Message, err.err.Error())
+	}
+	return fmt.Sprintf("[%s] %s", err.CodeName(), err.Message)
+}
+
+// String returns the error message with the symbolic name of the code.
+func (err *Error) String() string {
+	return err.Error()
+}
+
+// CodeName returns the symbolic name of the error code.
+func (err *Error) CodeName() string {
+	return lookupErrorCode(err.Code).Name
+}
+
+// Unwrap returns the underlying error so that errors.Is and errors.As can
+// traverse the chain of wrapped errors.
+func (err *Error) Unwrap() error {
+	return err.err
+}
+
+// Is matches any fluid error with the same code, so that a code can be
+// checked with a sentinel, e.g. errors.Is(err, &Error{Code: ErrDatabase}).
+func (err *Error) Is(target error) bool {
+	if t, ok := target.(*Error); ok {
+		return t.Code == err.Code
+	}
+	return false
+}
+
+// Status returns the HTTP status code for the error code, defaulting to an
+// internal server error for unknown codes.
+func (err *Error) Status() int {
+	return lookupErrorCode(err.Code).Status
 }
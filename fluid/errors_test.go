@@ -0,0 +1,89 @@
+package fluid_test
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	. "github.com/bbengfort/fluidfs/fluid"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Errors", func() {
+
+	It("should format the error with its code name", func() {
+		err := NewError(ErrNotFound, "no mount point at %s", "/data")
+		Ω(err.Code).Should(Equal(ErrNotFound))
+		Ω(err.CodeName()).Should(Equal("ErrNotFound"))
+		Ω(err.Message).Should(Equal("no mount point at /data"))
+		Ω(err.Error()).Should(Equal("[ErrNotFound] no mount point at /data"))
+		Ω(err.String()).Should(Equal(err.Error()))
+
+		err = NewError(42, "oops")
+		Ω(err.Error()).Should(Equal("[ErrUnknown] oops"))
+	})
+
+	It("should list all of the error codes in order", func() {
+		codes := []int{
+			ErrUnknown, ErrImproperlyConfigured, ErrDatabase, ErrInvalidReplica,
+			ErrInvalidRequest, ErrNotFound, ErrUnavailable,
+		}
+
+		reference := ErrorCodes()
+		Ω(reference).Should(HaveLen(len(codes)))
+		for i, code := range codes {
+			Ω(reference[i].Code).Should(Equal(code))
+			Ω(reference[i].Name).Should(Equal(NewError(code, "").CodeName()))
+			Ω(reference[i].Description).ShouldNot(BeEmpty())
+		}
+	})
+
+	It("should map error codes to http status codes", func() {
+		expected := map[int]int{
+			ErrUnknown:              http.StatusInternalServerError,
+			ErrImproperlyConfigured: http.StatusInternalServerError,
+			ErrDatabase:             http.StatusInternalServerError,
+			ErrInvalidReplica:       http.StatusBadRequest,
+			ErrInvalidRequest:       http.StatusBadRequest,
+			ErrNotFound:             http.StatusNotFound,
+			ErrUnavailable:          http.StatusServiceUnavailable,
+			42:                      http.StatusInternalServerError,
+		}
+
+		for code, status := range expected {
+			Ω(NewError(code, "oops").Status()).Should(Equal(status), "error code %d", code)
+		}
+	})
+
+	Describe("wrapping", func() {
+
+		var inner error
+		var err error
+
+		BeforeEach(func() {
+			inner = errors.New("file is locked")
+			err = fmt.Errorf("could not start: %w", WrapError(ErrDatabase, inner, "could not open database"))
+		})
+
+		It("should include the wrapped error in the message", func() {
+			var ferr *Error
+			Ω(errors.As(err, &ferr)).Should(BeTrue())
+			Ω(ferr.Error()).Should(Equal("[ErrDatabase] could not open database: file is locked"))
+			Ω(ferr.Unwrap()).Should(Equal(inner))
+		})
+
+		It("should match the wrapped error", func() {
+			Ω(errors.Is(err, inner)).Should(BeTrue())
+		})
+
+		It("should match errors by code", func() {
+			Ω(errors.Is(err, &Error{Code: ErrDatabase})).Should(BeTrue())
+			Ω(errors.Is(err, &Error{Code: ErrNotFound})).Should(BeFalse())
+			Ω(errors.Is(NewError(ErrNotFound, "no such file"), &Error{Code: ErrNotFound})).Should(BeTrue())
+		})
+
+	})
+
+})
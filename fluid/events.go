@@ -0,0 +1,199 @@
+// Publishes file system change events to subscribers such as the web UI.
+
+package fluid
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// Operations that are published as change events.
+const (
+	EventCreate = "create"
+	EventMkdir  = "mkdir"
+	EventWrite  = "write"
+	EventRemove = "remove"
+	EventRename = "rename"
+)
+
+// EventBuffer is the number of events buffered for each subscriber; events
+// are dropped for subscribers that fall further behind than the buffer.
+const EventBuffer = 256
+
+// EventKeepAlive is the interval at which a comment is written to idle event
+// streams so that proxies and clients do not close the connection.
+const EventKeepAlive = 15 * time.Second
+
+// The event broker shared by all of the file systems in the process.
+var events = NewEventBroker()
+
+//===========================================================================
+// Change Events
+//===========================================================================
+
+// ChangeEvent describes a change to the namespace or the data of a file. The
+// version is assigned by the broker and increases with every event, so that
+// clients can order events and detect those that were dropped.
+type ChangeEvent struct {
+	Version   uint64 `json:"version" yaml:"version"`
+	Op        string `json:"op" yaml:"op"`
+	Prefix    string `json:"prefix" yaml:"prefix"`
+	Path      string `json:"path" yaml:"path"`
+	OldPath   string `json:"old_path,omitempty" yaml:"old_path,omitempty"`
+	Timestamp string `json:"timestamp" yaml:"timestamp"`
+}
+
+// EventBroker fans out change events published by the file systems to every
+// subscriber. Publishing never blocks so that it can be called while the file
+// system is locked; if a subscriber is not keeping up its events are dropped.
+type EventBroker struct {
+	sync.Mutex
+	version     uint64                         // The version of the last event
+	subscribers map[chan *ChangeEvent]struct{} // Channels of the subscribers
+}
+
+// NewEventBroker creates a broker without any subscribers.
+func NewEventBroker() *EventBroker {
+	return &EventBroker{subscribers: make(map[chan *ChangeEvent]struct{})}
+}
+
+// Subscribe returns a channel that receives every event published after the
+// call until the channel is unsubscribed.
+func (b *EventBroker) Subscribe() chan *ChangeEvent {
+	b.Lock()
+	defer b.Unlock()
+
+	ch := make(chan *ChangeEvent, EventBuffer)
+	b.subscribers[ch] = struct{}{}
+	return ch
+}
+
+// Unsubscribe stops publishing events to the channel and closes it.
+func (b *EventBroker) Unsubscribe(ch chan *ChangeEvent) {
+	b.Lock()
+	defer b.Unlock()
+
+	if _, ok := b.subscribers[ch]; ok {
+		delete(b.subscribers, ch)
+		close(ch)
+	}
+}
+
+// Publish an event for the operation on the path in the mount point with the
+// prefix. The old path is only required for renames.
+func (b *EventBroker) Publish(op, prefix, path, oldpath string) {
+	b.Lock()
+	defer b.Unlock()
+
+	b.version++
+	event := &ChangeEvent{
+		Version:   b.version,
+		Op:        op,
+		Prefix:    prefix,
+		Path:      path,
+		OldPath:   oldpath,
+		Timestamp: time.Now().Format(JSONDateTime),
+	}
+
+	for ch := range b.subscribers {
+		select {
+		case ch <- event:
+		default:
+			logger.Debug("dropped %s event %d for a slow subscriber", op, event.Version)
+		}
+	}
+}
+
+// Publish an event for an operation on the file system. Must be called with
+// the fs locked so that the events are published in the order of the changes.
+func (fs *FileSystem) publish(op, path, oldpath string) {
+	if fs.Events != nil {
+		fs.Events.Publish(op, fs.mount.Prefix, path, oldpath)
+	}
+}
+
+//===========================================================================
+// Server-Sent Events
+//===========================================================================
+
+// EventStream streams change events to a web client as Server-Sent Events
+// until the client disconnects. If a prefix is specified, only the events of
+// that mount point are streamed.
+type EventStream struct {
+	Prefix    string          // Only stream events of this mount point if set
+	KeepAlive time.Duration   // Interval of keepalive comments on idle streams
+	ctx       context.Context // Done when the client disconnects
+	broker    *EventBroker    // The broker the stream is subscribed to
+	events    chan *ChangeEvent
+}
+
+// NewEventStream subscribes to the broker, streaming events until the context
+// is done. The subscription starts immediately so that no events are missed
+// between the request and the start of the stream.
+func NewEventStream(ctx context.Context, broker *EventBroker, prefix string) *EventStream {
+	return &EventStream{
+		Prefix:    prefix,
+		KeepAlive: EventKeepAlive,
+		ctx:       ctx,
+		broker:    broker,
+		events:    broker.Subscribe(),
+	}
+}
+
+// Header sets the content type of the event stream and disables caching.
+func (s *EventStream) Header(h http.Header) {
+	h.Set(HeaderContentTypeKey, "text/event-stream")
+	h.Set("Cache-Control", "no-cache")
+}
+
+// Stream writes every event to w as it is published, flushing each event to
+// the client, until the context is done or the client cannot be written to.
+// A comment is written if no events are streamed for the keepalive interval.
+func (s *EventStream) Stream(w io.Writer) error {
+	defer s.broker.Unsubscribe(s.events)
+
+	keepalive := time.NewTicker(s.KeepAlive)
+	defer keepalive.Stop()
+
+	flush := func() {
+		if f, ok := w.(http.Flusher); ok {
+			f.Flush()
+		}
+	}
+
+	// Send the headers to the client before the first event is published
+	flush()
+
+	for {
+		select {
+		case <-s.ctx.Done():
+			return nil
+		case <-keepalive.C:
+			if _, err := io.WriteString(w, ": keepalive\n\n"); err != nil {
+				return err
+			}
+			flush()
+		case event := <-s.events:
+			if s.Prefix != "" && event.Prefix != s.Prefix {
+				continue
+			}
+
+			data, err := json.Marshal(event)
+			if err != nil {
+				return err
+			}
+
+			if _, err := fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.Version, event.Op, data); err != nil {
+				return err
+			}
+			flush()
+			keepalive.Reset(s.KeepAlive)
+		}
+	}
+}
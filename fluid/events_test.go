@@ -0,0 +1,254 @@
+package fluid_test
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"bazil.org/fuse"
+	"golang.org/x/net/context"
+
+	. "github.com/bbengfort/fluidfs/fluid"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Events", func() {
+
+	var ctx context.Context
+	var fs *FileSystem
+	var root *Dir
+	var sub chan *ChangeEvent
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		fs = newFileSystem()
+		node, err := fs.Root()
+		Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+		root = node.(*Dir)
+		sub = fs.Events.Subscribe()
+	})
+
+	AfterEach(func() {
+		fs.Events.Unsubscribe(sub)
+	})
+
+	// Receive the next event published to the subscription.
+	next := func() *ChangeEvent {
+		var event *ChangeEvent
+		Eventually(sub).Should(Receive(&event))
+		return event
+	}
+
+	It("should publish events for changes to the file system", func() {
+		dir, err := root.Mkdir(ctx, &fuse.MkdirRequest{Name: "docs", Mode: 0755})
+		Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+		docs := dir.(*Dir)
+
+		node, _, err := docs.Create(ctx, &fuse.CreateRequest{Name: "a.txt", Mode: 0644}, new(fuse.CreateResponse))
+		Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+
+		wreq := &fuse.WriteRequest{Data: []byte("hello")}
+		Ω(node.(*File).Write(ctx, wreq, new(fuse.WriteResponse))).Should(Succeed())
+
+		Ω(docs.Rename(ctx, &fuse.RenameRequest{OldName: "a.txt", NewName: "b.txt"}, root)).Should(Succeed())
+		Ω(root.Remove(ctx, &fuse.RemoveRequest{Name: "b.txt"})).Should(Succeed())
+
+		expected := []struct {
+			op      string
+			path    string
+			oldpath string
+		}{
+			{EventMkdir, "/docs", ""},
+			{EventCreate, "/docs/a.txt", ""},
+			{EventWrite, "/docs/a.txt", ""},
+			{EventRename, "/b.txt", "/docs/a.txt"},
+			{EventRemove, "/b.txt", ""},
+		}
+
+		var version uint64
+		for _, tt := range expected {
+			event := next()
+			Ω(event.Op).Should(Equal(tt.op))
+			Ω(event.Prefix).Should(Equal("testing"))
+			Ω(event.Path).Should(Equal(tt.path))
+			Ω(event.OldPath).Should(Equal(tt.oldpath))
+			Ω(event.Version).Should(BeNumerically(">", version))
+			version = event.Version
+		}
+
+		Consistently(sub).ShouldNot(Receive())
+	})
+
+	It("should publish events for uploads", func() {
+		_, err := fs.Upload("", "a.txt", strings.NewReader("hello"))
+		Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+
+		_, err = fs.Upload("", "a.txt", strings.NewReader("world"))
+		Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+
+		for _, op := range []string{EventCreate, EventWrite, EventWrite} {
+			event := next()
+			Ω(event.Op).Should(Equal(op))
+			Ω(event.Path).Should(Equal("/a.txt"))
+		}
+
+		Consistently(sub).ShouldNot(Receive())
+	})
+
+	It("should publish events for imports", func() {
+		src, err := ioutil.TempDir("", "fluid-import")
+		Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+		defer os.RemoveAll(src)
+
+		Ω(os.Mkdir(filepath.Join(src, "docs"), 0755)).Should(Succeed())
+		Ω(ioutil.WriteFile(filepath.Join(src, "docs", "a.txt"), []byte("hello"), 0644)).Should(Succeed())
+
+		_, err = fs.ImportTree(src)
+		Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+
+		expected := []struct {
+			op   string
+			path string
+		}{
+			{EventMkdir, "/docs"},
+			{EventCreate, "/docs/a.txt"},
+			{EventWrite, "/docs/a.txt"},
+		}
+
+		for _, tt := range expected {
+			event := next()
+			Ω(event.Op).Should(Equal(tt.op))
+			Ω(event.Path).Should(Equal(tt.path))
+		}
+
+		// Importing the unchanged tree again does not publish any events
+		_, err = fs.ImportTree(src)
+		Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+		Consistently(sub).ShouldNot(Receive())
+	})
+
+	It("should not publish events for failed operations", func() {
+		Ω(root.Remove(ctx, &fuse.RemoveRequest{Name: "missing"})).ShouldNot(Succeed())
+		Consistently(sub).ShouldNot(Receive())
+	})
+
+	It("should drop events for slow subscribers without blocking", func() {
+		broker := NewEventBroker()
+		slow := broker.Subscribe()
+
+		for i := 0; i < EventBuffer+10; i++ {
+			broker.Publish(EventWrite, "testing", "/a.txt", "")
+		}
+
+		broker.Unsubscribe(slow)
+		received := 0
+		for range slow {
+			received++
+		}
+		Ω(received).Should(Equal(EventBuffer))
+	})
+
+	It("should stream events as server-sent events", func() {
+		api := new(C2SAPI)
+		Ω(api.Init()).Should(Succeed())
+
+		cctx, cancel := context.WithCancel(context.Background())
+		req := httptest.NewRequest(http.MethodGet, EventsEndpoint, nil).WithContext(cctx)
+
+		code, data, err := api.EventsHandler(req)
+		Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+		Ω(code).Should(Equal(http.StatusOK))
+
+		stream, ok := data.(Streamer)
+		Ω(ok).Should(BeTrue())
+
+		header := make(http.Header)
+		stream.Header(header)
+		Ω(header.Get("Content-Type")).Should(Equal("text/event-stream"))
+
+		pr, pw := io.Pipe()
+		done := make(chan error, 1)
+		go func() {
+			done <- stream.Stream(pw)
+			pw.Close()
+		}()
+
+		_, err = root.Mkdir(ctx, &fuse.MkdirRequest{Name: "docs", Mode: 0755})
+		Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+
+		lines := make([]string, 0, 3)
+		scanner := bufio.NewScanner(pr)
+		for len(lines) < 3 && scanner.Scan() {
+			lines = append(lines, scanner.Text())
+		}
+
+		Ω(lines[0]).Should(HavePrefix("id: "))
+		Ω(lines[1]).Should(Equal("event: mkdir"))
+		Ω(lines[2]).Should(HavePrefix("data: "))
+
+		event := new(ChangeEvent)
+		Ω(json.Unmarshal([]byte(strings.TrimPrefix(lines[2], "data: ")), event)).Should(Succeed())
+		Ω(event.Path).Should(Equal("/docs"))
+		Ω(lines[0]).Should(Equal(fmt.Sprintf("id: %d", event.Version)))
+
+		cancel()
+		Eventually(done).Should(Receive(BeNil()))
+	})
+
+	It("should keep idle streams open past the server write timeout", func() {
+		api := new(C2SAPI)
+		Ω(api.Init()).Should(Succeed())
+		api.AddHandler("/idle", func(r *http.Request) (int, interface{}, error) {
+			stream := NewEventStream(r.Context(), fs.Events, "")
+			stream.KeepAlive = 25 * time.Millisecond
+			return http.StatusOK, stream, nil
+		})
+
+		srv := httptest.NewUnstartedServer(api.Router)
+		srv.Config.WriteTimeout = 100 * time.Millisecond
+		srv.Start()
+		defer srv.Close()
+
+		rep, err := http.Get(srv.URL + "/idle")
+		Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+		defer rep.Body.Close()
+
+		scanner := bufio.NewScanner(rep.Body)
+		for keepalives := 0; keepalives < 6; {
+			Ω(scanner.Scan()).Should(BeTrue(), fmt.Sprintf("%s", scanner.Err()))
+			if scanner.Text() == ": keepalive" {
+				keepalives++
+			}
+		}
+
+		_, err = root.Mkdir(ctx, &fuse.MkdirRequest{Name: "docs", Mode: 0755})
+		Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+
+		for scanner.Scan() {
+			if scanner.Text() == "event: mkdir" {
+				break
+			}
+		}
+		Ω(scanner.Text()).Should(Equal("event: mkdir"))
+	})
+
+	It("should only stream events with GET", func() {
+		api := new(C2SAPI)
+		Ω(api.Init()).Should(Succeed())
+
+		code, _, err := api.EventsHandler(httptest.NewRequest(http.MethodPost, EventsEndpoint, nil))
+		Ω(err).Should(HaveOccurred())
+		Ω(code).Should(Equal(http.StatusMethodNotAllowed))
+	})
+
+})
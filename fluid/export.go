@@ -0,0 +1,158 @@
+// Mechanisms for exporting a file system to a local directory tree.
+
+package fluid
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+//===========================================================================
+// Directory Tree Export
+//===========================================================================
+
+// ExportReport describes the result of exporting a file system.
+type ExportReport struct {
+	Dirs  int    // The number of directories created
+	Files int    // The number of files written
+	Bytes uint64 // The number of bytes of file data written
+}
+
+// String returns a pretty representation of the export.
+func (r *ExportReport) String() string {
+	return fmt.Sprintf("exported %d files (%d bytes) and %d directories", r.Files, r.Bytes, r.Dirs)
+}
+
+// ExportTree traverses the file system, recreating its directories and files
+// in the local directory at dst, which is created if it does not exist. The
+// data, permissions and modification times of the entities are preserved.
+// Existing local files are replaced, so an export can be run again to
+// refresh a backup. Files with multiple hard links are only written once, at
+// the path they were created with.
+//
+// The entities and their data are copied while holding the fs lock, then the
+// copies are written to disk with the lock released so that the file system
+// continues to serve requests during a long export. The target cannot be
+// inside of the mount point and existing symlinks in it are not followed.
+func (fs *FileSystem) ExportTree(dst string) (*ExportReport, error) {
+	// Writing to the mount point would export the file system into itself.
+	if pathWithin(resolvePath(fs.mount.Path), resolvePath(dst)) {
+		return nil, fmt.Errorf("could not export to %s: it is in fluidfs://%s", dst, fs.mount.Prefix)
+	}
+
+	if err := os.MkdirAll(dst, 0755); err != nil {
+		return nil, fmt.Errorf("could not export to %s: %s", dst, err.Error())
+	}
+
+	// Copy the entities so that they can be written without the lock.
+	entries := make([]*exportEntry, 0)
+	fs.Traverse(func(ent Entity) error {
+		node := ent.GetNode()
+		entry := &exportEntry{
+			path:  filepath.Join(dst, ent.Path()),
+			dir:   ent.IsDir(),
+			root:  node.Parent == nil,
+			mode:  node.Attrs.Mode.Perm(),
+			atime: node.Attrs.Atime,
+			mtime: node.Attrs.Mtime,
+		}
+
+		if file, ok := ent.(*File); ok {
+			entry.data = make([]byte, len(file.Data))
+			copy(entry.data, file.Data)
+		}
+
+		entries = append(entries, entry)
+		return nil
+	})
+
+	report := new(ExportReport)
+	dirs := make([]*exportEntry, 0)
+
+	// Directories are created writable so that their children can be written,
+	// their permissions and times are applied once the traversal is complete.
+	for _, entry := range entries {
+		if entry.dir {
+			if !entry.root {
+				if err := exportDir(entry.path); err != nil {
+					return report, fmt.Errorf("could not export to %s: %s", dst, err.Error())
+				}
+				report.Dirs++
+			}
+			dirs = append(dirs, entry)
+			continue
+		}
+
+		if err := os.Remove(entry.path); err != nil && !os.IsNotExist(err) {
+			return report, fmt.Errorf("could not export to %s: %s", dst, err.Error())
+		}
+
+		if err := ioutil.WriteFile(entry.path, entry.data, 0600); err != nil {
+			return report, fmt.Errorf("could not export to %s: %s", dst, err.Error())
+		}
+
+		if err := entry.attrs(); err != nil {
+			return report, fmt.Errorf("could not export to %s: %s", dst, err.Error())
+		}
+
+		report.Files++
+		report.Bytes += uint64(len(entry.data))
+	}
+
+	// Apply directory attributes deepest first, since writing a child changes
+	// the modification time of its parent. The root keeps the local attrs.
+	for i := len(dirs) - 1; i >= 0; i-- {
+		if dirs[i].root {
+			continue
+		}
+
+		if err := dirs[i].attrs(); err != nil {
+			return report, fmt.Errorf("could not export to %s: %s", dst, err.Error())
+		}
+	}
+
+	logger.Info("%s from fluidfs://%s to %s", report, fs.mount.Prefix, dst)
+	return report, nil
+}
+
+// A copy of an entity to export, taken while holding the fs lock.
+type exportEntry struct {
+	path  string      // The local path the entity is exported to
+	dir   bool        // If the entity is a directory
+	root  bool        // If the entity is the root of the file system
+	mode  os.FileMode // The permissions of the entity
+	atime time.Time   // The access time of the entity
+	mtime time.Time   // The modification time of the entity
+	data  []byte      // A copy of the data if the entity is a file
+}
+
+// Set the permissions and times of the local path to those of the entity.
+func (e *exportEntry) attrs() error {
+	if err := os.Chmod(e.path, e.mode); err != nil {
+		return err
+	}
+	return os.Chtimes(e.path, e.atime, e.mtime)
+}
+
+// Create the directory at path unless a directory already exists there. An
+// existing symlink is an error rather than followed, so that an export cannot
+// be redirected outside of the target.
+func exportDir(path string) error {
+	err := os.Mkdir(path, 0700)
+	if err == nil || !os.IsExist(err) {
+		return err
+	}
+
+	info, err := os.Lstat(path)
+	if err != nil {
+		return err
+	}
+
+	if !info.IsDir() {
+		return fmt.Errorf("%s exists and is not a directory", path)
+	}
+	return nil
+}
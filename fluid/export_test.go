@@ -0,0 +1,164 @@
+package fluid_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"bazil.org/fuse"
+	"golang.org/x/net/context"
+
+	. "github.com/bbengfort/fluidfs/fluid"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Export", func() {
+
+	var ctx context.Context
+	var fs *FileSystem
+	var root *Dir
+	var dst string
+
+	BeforeEach(func() {
+		var err error
+		dst, err = ioutil.TempDir("", "fluid-export")
+		Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+
+		ctx = context.Background()
+		fs = newFileSystem()
+		node, err := fs.Root()
+		Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+		root = node.(*Dir)
+	})
+
+	AfterEach(func() {
+		Ω(os.RemoveAll(dst)).Should(Succeed())
+	})
+
+	It("should write the file system byte for byte", func() {
+		docs := mkdir(root, "docs", 0750)
+		notes := mkdir(docs, "notes", 0700)
+		mkdir(root, "empty", 0755)
+
+		files := map[string]*File{
+			"a.txt":              createFile(root, "a.txt", 0644, []byte("the quick brown fox")),
+			"docs/b.txt":         createFile(docs, "b.txt", 0600, []byte(randString(8192))),
+			"docs/notes/c.txt":   createFile(notes, "c.txt", 0640, []byte("jumped over the lazy dog")),
+			"docs/notes/run.sh":  createFile(notes, "run.sh", 0755, []byte("#!/bin/sh")),
+			"docs/notes/empty.m": createFile(notes, "empty.m", 0644, nil),
+		}
+
+		mtime := time.Date(2017, 4, 1, 12, 0, 0, 0, time.UTC)
+		files["a.txt"].Attrs.Mtime = mtime
+		docs.Attrs.Mtime = mtime
+
+		report, err := fs.ExportTree(dst)
+		Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+		Ω(report.Files).Should(Equal(len(files)))
+		Ω(report.Dirs).Should(Equal(3))
+
+		nbytes := uint64(0)
+		for name, file := range files {
+			path := filepath.Join(dst, name)
+			data, err := ioutil.ReadFile(path)
+			Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+			Ω(data).Should(Equal(file.Data), name)
+
+			info, err := os.Stat(path)
+			Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+			Ω(info.Mode()).Should(Equal(file.Attrs.Mode), name)
+			nbytes += uint64(len(file.Data))
+		}
+		Ω(report.Bytes).Should(Equal(nbytes))
+
+		info, err := os.Stat(filepath.Join(dst, "a.txt"))
+		Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+		Ω(info.ModTime().Equal(mtime)).Should(BeTrue(), "mtime is %s", info.ModTime())
+
+		info, err = os.Stat(filepath.Join(dst, "docs"))
+		Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+		Ω(info.Mode()).Should(Equal(os.ModeDir | 0750))
+		Ω(info.ModTime().Equal(mtime)).Should(BeTrue(), "mtime is %s", info.ModTime())
+
+		info, err = os.Stat(filepath.Join(dst, "docs", "notes"))
+		Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+		Ω(info.Mode()).Should(Equal(os.ModeDir | 0700))
+
+		entries, err := ioutil.ReadDir(filepath.Join(dst, "empty"))
+		Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+		Ω(entries).Should(BeEmpty())
+	})
+
+	It("should replace the files of a previous export", func() {
+		file := createFile(root, "a.txt", 0400, []byte("the quick brown fox"))
+		_, err := fs.ExportTree(dst)
+		Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+
+		wreq := &fuse.WriteRequest{Data: []byte("a slow green turtle")}
+		Ω(file.Write(ctx, wreq, new(fuse.WriteResponse))).Should(Succeed())
+		_, err = fs.ExportTree(dst)
+		Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+
+		data, err := ioutil.ReadFile(filepath.Join(dst, "a.txt"))
+		Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+		Ω(string(data)).Should(Equal("a slow green turtle"))
+	})
+
+	It("should write hard linked files once", func() {
+		file := createFile(root, "a.txt", 0644, []byte("the quick brown fox"))
+		_, err := root.Link(ctx, &fuse.LinkRequest{NewName: "b.txt"}, file)
+		Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+
+		report, err := fs.ExportTree(dst)
+		Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+		Ω(report.Files).Should(Equal(1))
+		Ω(filepath.Join(dst, "a.txt")).Should(BeARegularFile())
+	})
+
+	It("should not export into the mount point", func() {
+		createFile(root, "a.txt", 0644, []byte("the quick brown fox"))
+		defer os.RemoveAll(filepath.Join(suiteDir, "mnt"))
+
+		_, err := fs.ExportTree(filepath.Join(suiteDir, "mnt", "backup"))
+		Ω(err).Should(MatchError(ContainSubstring("it is in fluidfs://testing")))
+		Ω(filepath.Join(suiteDir, "mnt", "backup")).ShouldNot(BeADirectory())
+	})
+
+	It("should not follow symlinks in the target", func() {
+		docs := mkdir(root, "docs", 0755)
+		createFile(docs, "b.txt", 0644, []byte("jumped over the lazy dog"))
+
+		outside, err := ioutil.TempDir("", "fluid-outside")
+		Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+		defer os.RemoveAll(outside)
+		Ω(os.Symlink(outside, filepath.Join(dst, "docs"))).Should(Succeed())
+
+		_, err = fs.ExportTree(dst)
+		Ω(err).Should(MatchError(ContainSubstring("exists and is not a directory")))
+		Ω(filepath.Join(outside, "b.txt")).ShouldNot(BeAnExistingFile())
+	})
+
+	It("should round trip an imported directory tree", func() {
+		src, err := ioutil.TempDir("", "fluid-import")
+		Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+		defer os.RemoveAll(src)
+
+		data := []byte(randString(4096))
+		Ω(os.MkdirAll(filepath.Join(src, "a", "b"), 0755)).Should(Succeed())
+		Ω(ioutil.WriteFile(filepath.Join(src, "a", "b", "c.txt"), data, 0644)).Should(Succeed())
+
+		_, err = fs.ImportTree(src)
+		Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+		_, err = fs.ExportTree(dst)
+		Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+
+		exported, err := ioutil.ReadFile(filepath.Join(dst, "a", "b", "c.txt"))
+		Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+		Ω(exported).Should(Equal(data))
+	})
+
+})
@@ -3,6 +3,7 @@
 package fluid
 
 import (
+	"fmt"
 	"os"
 	"time"
 
@@ -14,6 +15,11 @@ import (
 // Files
 //===========================================================================
 
+// AssertInvariants causes violations of the file invariants, e.g. a size
+// attribute that doesn't match the length of the data, to panic rather than
+// just log an error. It is off by default and intended for use in tests.
+var AssertInvariants = false
+
 // File implements Node and Handler interfaces for file (data containing)
 // objects in MemFs. Data is allocated directly in the file object, and is
 // not chunked or broken up until transport.
@@ -24,12 +30,15 @@ type File struct {
 }
 
 // Init the file and create the data array
-func (f *File) Init(name string, mode os.FileMode, parent *Dir, memfs *FileSystem) {
+func (f *File) Init(name string, mode os.FileMode, parent *Dir, memfs *FileSystem) error {
 	// Init the embedded node.
-	f.Node.Init(name, mode, parent, memfs)
+	if err := f.Node.Init(name, mode, parent, memfs); err != nil {
+		return err
+	}
 
 	// Make the data array
 	f.Data = make([]byte, 0, 0)
+	return nil
 }
 
 //===========================================================================
@@ -41,6 +50,83 @@ func (f *File) GetNode() *Node {
 	return &f.Node
 }
 
+// Consistent returns an error if the size and blocks attributes of the file
+// do not match the length of the data stored in the file.
+func (f *File) Consistent() error {
+	if uint64(len(f.Data)) != f.Attrs.Size {
+		return fmt.Errorf("bad size match on file %d: %d bytes of data vs size %d", f.ID, len(f.Data), f.Attrs.Size)
+	}
+
+	if f.Attrs.Blocks != Blocks(f.Attrs.Size) {
+		return fmt.Errorf("bad blocks match on file %d: %d blocks vs %d bytes", f.ID, f.Attrs.Blocks, f.Attrs.Size)
+	}
+
+	return nil
+}
+
+// Mark the file data as flushed and update the access and modification
+// times. Must be called while holding the fs lock.
+func (f *File) flush() {
+	f.Attrs.Mtime = time.Now()
+	f.access()
+	f.dirty = false
+}
+
+// Resize the data of the file to the given size, either truncating the data
+// or extending it with zeros, and update the size attributes of the file and
+// the file system state to match. Must be called while holding the fs lock.
+func (f *File) resize(size uint64) {
+	olen := uint64(len(f.Data))
+
+	switch {
+	case size < olen:
+		f.Data = f.Data[:size]
+		f.fs.nbytes -= olen - size
+	case size > olen:
+		buf := make([]byte, size)
+		copy(buf, f.Data)
+		f.Data = buf
+		f.fs.nbytes += size - olen
+	}
+
+	f.Attrs.Size = size
+	f.Attrs.Blocks = Blocks(size)
+}
+
+// Truncate the data of the file when it is created with O_TRUNC, updating the
+// modification time and marking the file dirty so that the empty file is
+// flushed. Must be called while holding the fs lock.
+func (f *File) truncate() {
+	f.resize(0)
+	f.Attrs.Mtime = time.Now()
+	f.dirty = true
+}
+
+// Replace the data of the file, updating the size attributes and the file
+// system state to match. The file takes ownership of data rather than copying
+// it, so the caller must not modify it afterward. Must be called while holding
+// the fs lock.
+func (f *File) replace(data []byte) {
+	olen, size := uint64(len(f.Data)), uint64(len(data))
+	f.Data = data
+	f.fs.nbytes = f.fs.nbytes - olen + size
+
+	f.Attrs.Size = size
+	f.Attrs.Blocks = Blocks(size)
+}
+
+// Check the file invariants, logging an error (or panicking if assertions
+// are enabled) if they have been violated.
+func (f *File) checkInvariants() {
+	if err := f.Consistent(); err != nil {
+		if AssertInvariants {
+			panic(err)
+		}
+
+		logger.Error(err.Error())
+	}
+}
+
 //===========================================================================
 // File fuse.Node* Interface
 //===========================================================================
@@ -56,6 +142,8 @@ func (f *File) GetNode() *Node {
 //
 // https://godoc.org/bazil.org/fuse/fs#NodeSetattrer
 func (f *File) Setattr(ctx context.Context, req *fuse.SetattrRequest, resp *fuse.SetattrResponse) error {
+	defer f.fs.acquire()()
+
 	if f.IsArchive() || f.fs.readonly {
 		return fuse.EPERM
 	}
@@ -64,16 +152,22 @@ func (f *File) Setattr(ctx context.Context, req *fuse.SetattrRequest, resp *fuse
 	if req.Valid.Size() {
 		f.fs.Lock() // Only lock if we're going to change the size.
 
-		f.Attrs.Size = req.Size
-		f.Attrs.Blocks = Blocks(f.Attrs.Size)
-		f.Data = f.Data[:req.Size] // If size > len(f.Data) then panic!
+		// Reject modifications while the file system is in maintenance mode
+		if err := f.fs.writable(); err != nil {
+			f.fs.Unlock()
+			return err
+		}
+
 		logger.Debug("truncate size from %d to %d on file %d", f.Attrs.Size, req.Size, f.ID)
+		f.resize(req.Size)
+		f.dirty = true
+		f.checkInvariants()
 
-		f.fs.Unlock() // Must unlock before Node.Setattr is called!
+		f.fs.Unlock() // Must unlock before Node.setattr is called!
 	}
 
 	// Now use the embedded Node's Setattr method.
-	return f.Node.Setattr(ctx, req, resp)
+	return f.Node.setattr(req, resp)
 }
 
 // Fsync must be defined or edting with vim or emacs fails.
@@ -81,6 +175,8 @@ func (f *File) Setattr(ctx context.Context, req *fuse.SetattrRequest, resp *fuse
 //
 // https://godoc.org/bazil.org/fuse/fs#NodeFsyncer
 func (f *File) Fsync(ctx context.Context, req *fuse.FsyncRequest) error {
+	defer f.fs.acquire()()
+
 	f.fs.Lock()
 	defer f.fs.Unlock()
 
@@ -100,6 +196,8 @@ func (f *File) Fsync(ctx context.Context, req *fuse.FsyncRequest) error {
 //
 // https://godoc.org/bazil.org/fuse/fs#HandleFlusher
 func (f *File) Flush(ctx context.Context, req *fuse.FlushRequest) error {
+	defer f.fs.acquire()()
+
 	logger.Info("flush file %d (dirty: %t, contains %d bytes with size %d)", f.ID, f.dirty, len(f.Data), f.Attrs.Size)
 
 	if f.IsArchive() || f.fs.readonly {
@@ -113,10 +211,7 @@ func (f *File) Flush(ctx context.Context, req *fuse.FlushRequest) error {
 		return nil
 	}
 
-	f.Attrs.Atime = time.Now()
-	f.Attrs.Mtime = f.Attrs.Atime
-	f.dirty = false
-
+	f.flush()
 	return nil
 }
 
@@ -153,6 +248,8 @@ func (f *File) Flush(ctx context.Context, req *fuse.FlushRequest) error {
 //
 // https://godoc.org/bazil.org/fuse/fs#HandleReader
 func (f *File) Read(ctx context.Context, req *fuse.ReadRequest, resp *fuse.ReadResponse) error {
+	defer f.fs.acquire()()
+
 	f.fs.Lock()
 	defer f.fs.Unlock()
 
@@ -163,7 +260,7 @@ func (f *File) Read(ctx context.Context, req *fuse.ReadRequest, resp *fuse.ReadR
 	}
 
 	// Set the access time on the file.
-	f.Attrs.Atime = time.Now()
+	f.access()
 
 	// Set the data on the response object.
 	resp.Data = f.Data[req.Offset:to]
@@ -194,6 +291,8 @@ func (f *File) Read(ctx context.Context, req *fuse.ReadRequest, resp *fuse.ReadR
 //
 // https://godoc.org/bazil.org/fuse/fs#HandleWriter
 func (f *File) Write(ctx context.Context, req *fuse.WriteRequest, resp *fuse.WriteResponse) error {
+	defer f.fs.acquire()()
+
 	if f.IsArchive() || f.fs.readonly {
 		return fuse.EPERM
 	}
@@ -201,43 +300,28 @@ func (f *File) Write(ctx context.Context, req *fuse.WriteRequest, resp *fuse.Wri
 	f.fs.Lock()
 	defer f.fs.Unlock()
 
+	// Reject modifications while the file system is in maintenance mode
+	if err := f.fs.writable(); err != nil {
+		return err
+	}
+
 	olen := uint64(len(f.Data))   // original data length
 	wlen := uint64(len(req.Data)) // data write length
 	off := uint64(req.Offset)     // offset of the write
 	lim := off + wlen             // The final length of the data
 
 	// Ensure the original size is the same as the set size (debugging)
-	if olen != f.Attrs.Size {
-		msg := "bad size match: %d vs %d"
-		logger.Error(msg, olen, f.Attrs.Size)
-	}
+	f.checkInvariants()
 
 	// If the amount of data being written is greater than the amount of data
-	// currently being stored, allocate a new array with sufficient size and
-	// copy the original data to that buffer.
+	// currently being stored, grow the data and update the size attributes.
 	if lim > olen {
-		buf := make([]byte, lim)
-
-		var to uint64
-		if off < olen {
-			to = off
-		} else {
-			to = olen
-		}
-
-		copy(buf[0:to], f.Data[0:to])
-		f.Data = buf
-
-		// Update the size attributes of the file
-		f.Attrs.Size = lim
-		f.Attrs.Blocks = Blocks(f.Attrs.Size)
-
-		// Update the file system state
-		f.fs.nbytes += lim - olen
+		f.resize(lim)
 	}
 
 	// Copy the data from the request into our data buffer
 	copy(f.Data[off:lim], req.Data[:])
+	f.checkInvariants()
 
 	// Set the attributes on the response
 	resp.Size = int(wlen)
@@ -245,6 +329,7 @@ func (f *File) Write(ctx context.Context, req *fuse.WriteRequest, resp *fuse.Wri
 	// Mark the file as dirty
 	f.dirty = true
 
+	f.fs.publish(EventWrite, f.Path(), "")
 	logger.Debug("wrote %d bytes offset by %d to file %d", wlen, off, f.ID)
 	return nil
 }
@@ -0,0 +1,188 @@
+package fluid_test
+
+import (
+	"bytes"
+	"fmt"
+	"time"
+
+	"bazil.org/fuse"
+	"golang.org/x/net/context"
+
+	. "github.com/bbengfort/fluidfs/fluid"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("File", func() {
+
+	var err error
+	var ctx context.Context
+	var file *File
+	var fsys *FileSystem
+
+	// Create a file in a new file system with the mount options.
+	create := func(options ...string) *File {
+		fsys = newFileSystem(options...)
+		root, err := fsys.Root()
+		Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+
+		req := &fuse.CreateRequest{Name: "test.txt", Mode: 0644}
+		node, _, err := root.(*Dir).Create(ctx, req, new(fuse.CreateResponse))
+		Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+
+		return node.(*File)
+	}
+
+	BeforeEach(func() {
+		AssertInvariants = true
+		ctx = context.Background()
+		file = create()
+	})
+
+	AfterEach(func() {
+		AssertInvariants = false
+	})
+
+	// Write data to the file at the specified offset.
+	write := func(data []byte, offset int64) {
+		req := &fuse.WriteRequest{Data: data, Offset: offset}
+		resp := new(fuse.WriteResponse)
+		Ω(file.Write(ctx, req, resp)).Should(Succeed())
+		Ω(resp.Size).Should(Equal(len(data)))
+	}
+
+	// Truncate or extend the file to the specified size.
+	truncate := func(size uint64) {
+		req := &fuse.SetattrRequest{Valid: fuse.SetattrSize, Size: size}
+		Ω(file.Setattr(ctx, req, new(fuse.SetattrResponse))).Should(Succeed())
+	}
+
+	It("should be consistent when created", func() {
+		Ω(file.Consistent()).Should(Succeed())
+		Ω(file.Attrs.Size).Should(BeZero())
+	})
+
+	It("should be consistent after writes", func() {
+		write([]byte("hello world"), 0)
+		Ω(file.Consistent()).Should(Succeed())
+		Ω(file.Attrs.Size).Should(Equal(uint64(11)))
+
+		// Overwrite in the middle without growing the file.
+		write([]byte("WORLD"), 6)
+		Ω(file.Consistent()).Should(Succeed())
+		Ω(file.Data).Should(Equal([]byte("hello WORLD")))
+
+		// Write past the end of the file, leaving a hole of zeros.
+		write([]byte("!"), 1024)
+		Ω(file.Consistent()).Should(Succeed())
+		Ω(file.Attrs.Size).Should(Equal(uint64(1025)))
+		Ω(file.Data[11:1024]).Should(Equal(make([]byte, 1013)))
+	})
+
+	It("should be consistent after truncation", func() {
+		write([]byte(randString(4096)), 0)
+
+		truncate(100)
+		Ω(file.Consistent()).Should(Succeed())
+		Ω(file.Data).Should(HaveLen(100))
+
+		truncate(0)
+		Ω(file.Consistent()).Should(Succeed())
+		Ω(file.Data).Should(BeEmpty())
+	})
+
+	It("should zero extend the file when the size is increased", func() {
+		write([]byte("hello"), 0)
+
+		truncate(2048)
+		Ω(file.Consistent()).Should(Succeed())
+		Ω(file.Attrs.Size).Should(Equal(uint64(2048)))
+		Ω(file.Data[:5]).Should(Equal([]byte("hello")))
+		Ω(bytes.Count(file.Data[5:], []byte{0})).Should(Equal(2043))
+	})
+
+	It("should empty the file when opened with O_TRUNC", func() {
+		write([]byte("hello world"), 0)
+		Ω(file.Flush(ctx, new(fuse.FlushRequest))).Should(Succeed())
+		Ω(fsys.Dirty()).Should(BeZero())
+
+		// The kernel removes O_TRUNC from the open flags and follows the open
+		// with a Setattr of the size and modification time instead.
+		req := &fuse.SetattrRequest{Valid: fuse.SetattrSize | fuse.SetattrHandle | fuse.SetattrMtimeNow, Size: 0}
+		Ω(file.Setattr(ctx, req, new(fuse.SetattrResponse))).Should(Succeed())
+		Ω(file.Consistent()).Should(Succeed())
+		Ω(file.Data).Should(BeEmpty())
+		Ω(file.Attrs.Size).Should(BeZero())
+
+		// The emptied file is flushed when it is closed
+		Ω(fsys.Dirty()).Should(Equal(1))
+		Ω(file.Flush(ctx, new(fuse.FlushRequest))).Should(Succeed())
+		Ω(fsys.Dirty()).Should(BeZero())
+	})
+
+	It("should detect drift between the size and the data", func() {
+		write([]byte("hello world"), 0)
+
+		file.Attrs.Size = 42
+		err = file.Consistent()
+		Ω(err).Should(HaveOccurred())
+		Ω(func() { write([]byte("x"), 0) }).Should(Panic())
+
+		file.Attrs.Size = uint64(len(file.Data))
+		file.Attrs.Blocks = 0
+		Ω(file.Consistent()).ShouldNot(Succeed())
+	})
+
+	Describe("access times", func() {
+
+		// Write, flush and then read the file, returning the access time before
+		// and after the read.
+		read := func() (time.Time, time.Time) {
+			write([]byte("hello world"), 0)
+			Ω(file.Flush(ctx, new(fuse.FlushRequest))).Should(Succeed())
+
+			before := file.Attrs.Atime
+			time.Sleep(10 * time.Millisecond)
+
+			req := &fuse.ReadRequest{Offset: 0, Size: 5}
+			resp := new(fuse.ReadResponse)
+			Ω(file.Read(ctx, req, resp)).Should(Succeed())
+			Ω(resp.Data).Should(Equal([]byte("hello")))
+
+			return before, file.Attrs.Atime
+		}
+
+		It("should update the access time on every read by default", func() {
+			before, after := read()
+			Ω(after).Should(BeTemporally(">", before))
+		})
+
+		It("should not update the access time with noatime", func() {
+			file = create(NoAtime)
+			before, after := read()
+			Ω(after).Should(Equal(before))
+			Ω(fsys.Dirty()).Should(BeZero())
+		})
+
+		It("should update the access time once after a write with relatime", func() {
+			file = create(RelAtime)
+			write([]byte("hello world"), 0)
+			Ω(file.Flush(ctx, new(fuse.FlushRequest))).Should(Succeed())
+
+			// The access time is updated if it is older than the modification
+			file.Attrs.Atime = file.Attrs.Mtime.Add(-1 * time.Minute)
+			req := &fuse.ReadRequest{Offset: 0, Size: 5}
+			Ω(file.Read(ctx, req, new(fuse.ReadResponse))).Should(Succeed())
+			Ω(file.Attrs.Atime).Should(BeTemporally(">", file.Attrs.Mtime))
+
+			// But not again until the next modification
+			atime := file.Attrs.Atime
+			time.Sleep(10 * time.Millisecond)
+			Ω(file.Read(ctx, req, new(fuse.ReadResponse))).Should(Succeed())
+			Ω(file.Attrs.Atime).Should(Equal(atime))
+		})
+
+	})
+
+})
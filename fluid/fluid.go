@@ -4,7 +4,10 @@
 package fluid
 
 import (
+	"errors"
 	"fmt"
+	"net"
+	"os"
 
 	kvdb "github.com/bbengfort/fluidfs/fluid/db"
 )
@@ -84,6 +87,11 @@ func Init(conf string) error {
 		logger.Info("loaded configuration from %s", path)
 	}
 
+	// Warn if blob hashes depend on the architecture of the replica.
+	if config.Storage.ArchitectureDependent() {
+		logger.Warn("the %s hashing algorithm is architecture dependent, use %s if replicas have mixed architectures", config.Storage.Hashing, Murmur128)
+	}
+
 	// Initialize the FSTable from the fstab path
 	fstab = new(FuseFSTable)
 	if err = fstab.Load(config.FStab); err != nil {
@@ -99,6 +107,30 @@ func Init(conf string) error {
 	return nil
 }
 
+// SetVerbosity overrides the configured log level after Init, e.g. from the
+// verbose and quiet command line flags. Verbose logs debug messages and quiet
+// only logs warnings and errors; if neither is set the configured level is
+// kept. Returns the effective log level.
+func SetVerbosity(verbose, quiet bool) (LogLevel, error) {
+	if verbose && quiet {
+		return 0, errors.New("cannot be both verbose and quiet")
+	}
+
+	if logger == nil {
+		return 0, errors.New("fluidfs has not been initialized")
+	}
+
+	switch {
+	case verbose:
+		logger.Level = LevelDebug
+	case quiet:
+		logger.Level = LevelWarn
+	}
+
+	config.Logging.Level = logger.Level.String()
+	return logger.Level, nil
+}
+
 // Run the replica by creating a PID file, listening for command and control,
 // opening connections to databases, mounting the FUSE directories, and
 // listening for remote connections.
@@ -110,9 +142,16 @@ func Run() error {
 
 	// Create X-Thread and X-Process Resources
 
+	// Bind the C2S API so that its address can be written to the PID file
+	ln, err := net.Listen("tcp", config.APIAddr())
+	if err != nil {
+		return fmt.Errorf("could not bind the C2S API to %s: %s", config.APIAddr(), err.Error())
+	}
+
 	// Create a PID file
-	pid = new(PID)
+	pid = &PID{Host: config.APIHost, Port: ln.Addr().(*net.TCPAddr).Port}
 	if err = pid.Save(); err != nil {
+		ln.Close()
 		return fmt.Errorf("could not write PID file: %s", err.Error())
 	}
 
@@ -139,7 +178,7 @@ func Run() error {
 	}
 
 	// Run the C2S API and web interface
-	go web.Run(pid.Addr(), echan)
+	go web.Serve(ln, echan)
 
 	// Listen for an error from any of the go routines (also blocks)
 	// Log the error and shutdown gracefully (returning only shutdown errors).
@@ -179,3 +218,33 @@ func Shutdown() error {
 func ShowConfig() string {
 	return config.String()
 }
+
+// InitConfig writes the configuration loaded from the defaults, the
+// configuration files and the optional configuration at confPath to the
+// specified path, or to the user's configuration path if no path is given,
+// as a starter configuration that can be edited. The configuration is not
+// validated so that Init is not required, e.g. on a machine without an fstab.
+// It will not overwrite an existing configuration file and returns the path
+// that was written to.
+func InitConfig(path, confPath string) (string, error) {
+	config, err := ReadConfig(confPath)
+	if err != nil {
+		return "", err
+	}
+
+	if path == "" {
+		if path, err = config.UserPath(); err != nil {
+			return "", err
+		}
+	}
+
+	if _, err = os.Stat(path); err == nil {
+		return "", fmt.Errorf("configuration already exists at %s", path)
+	}
+
+	if err = config.Write(path); err != nil {
+		return "", err
+	}
+
+	return path, nil
+}
@@ -1,8 +1,16 @@
 package fluid_test
 
 import (
+	"fmt"
+	"io/ioutil"
 	"math/rand"
 	"os"
+	"path/filepath"
+
+	"bazil.org/fuse"
+	"golang.org/x/net/context"
+
+	. "github.com/bbengfort/fluidfs/fluid"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
@@ -12,11 +20,49 @@ import (
 
 const TempDirPrefix = "com.fluidfs."
 
+// The directory holding the configuration, logs and data for the suite.
+var suiteDir string
+
 func TestFluid(t *testing.T) {
 	RegisterFailHandler(Fail)
 	RunSpecs(t, "Fluid Suite")
 }
 
+// Initialize the package with a temporary configuration so that the global
+// logger is available to the file system nodes and logs are written to disk.
+var _ = BeforeSuite(func() {
+	var err error
+	suiteDir, err = ioutil.TempDir("", TempDirPrefix)
+	Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+
+	fixture := "pid: 1\n" +
+		"name: testing\n" +
+		"fstab: %s\n" +
+		"logging:\n" +
+		"  level: DEBUG\n" +
+		"  path: %s\n" +
+		"database:\n" +
+		"  path: %s\n" +
+		"storage:\n" +
+		"  path: %s\n"
+
+	fixture = fmt.Sprintf(
+		fixture,
+		filepath.Join(suiteDir, "fstab"),
+		filepath.Join(suiteDir, "fluidfs.log"),
+		filepath.Join(suiteDir, "db"),
+		filepath.Join(suiteDir, "storage"),
+	)
+
+	path := filepath.Join(suiteDir, "config.yml")
+	Ω(ioutil.WriteFile(path, []byte(fixture), 0644)).Should(Succeed())
+	Ω(Init(path)).Should(Succeed())
+})
+
+var _ = AfterSuite(func() {
+	Ω(os.RemoveAll(suiteDir)).Should(Succeed())
+})
+
 //===========================================================================
 // Testing Helper Functions
 //===========================================================================
@@ -62,3 +108,34 @@ func pathExists(path string) (bool, error) {
 
 	return true, nil
 }
+
+// Create an in-memory file system for testing nodes, requires Init.
+func newFileSystem(options ...string) *FileSystem {
+	mp := &MountPoint{Path: filepath.Join(suiteDir, "mnt"), Prefix: "testing", Options: options}
+	fs := new(FileSystem)
+	Ω(fs.Init(mp)).Should(Succeed())
+	return fs
+}
+
+// Create a directory with the mode in the parent directory.
+func mkdir(parent *Dir, name string, mode os.FileMode) *Dir {
+	req := &fuse.MkdirRequest{Name: name, Mode: mode}
+	node, err := parent.Mkdir(context.Background(), req)
+	Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+	return node.(*Dir)
+}
+
+// Create a file with the mode in the directory and write data to it, if any.
+func createFile(dir *Dir, name string, mode os.FileMode, data []byte) *File {
+	ctx := context.Background()
+	req := &fuse.CreateRequest{Name: name, Mode: mode}
+	node, _, err := dir.Create(ctx, req, new(fuse.CreateResponse))
+	Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+
+	file := node.(*File)
+	if len(data) > 0 {
+		wreq := &fuse.WriteRequest{Data: data}
+		Ω(file.Write(ctx, wreq, new(fuse.WriteResponse))).Should(Succeed())
+	}
+	return file
+}
@@ -21,4 +21,32 @@ var _ = Describe("Core", func() {
 
 	})
 
+	Describe("Verbosity", func() {
+
+		AfterEach(func() {
+			// Restore the level of the suite configuration
+			_, err := SetVerbosity(true, false)
+			Ω(err).ShouldNot(HaveOccurred())
+		})
+
+		It("should log debug messages when verbose", func() {
+			Ω(SetVerbosity(false, true)).Should(Equal(LevelWarn))
+			Ω(SetVerbosity(true, false)).Should(Equal(LevelDebug))
+		})
+
+		It("should only log warnings when quiet", func() {
+			Ω(SetVerbosity(false, true)).Should(Equal(LevelWarn))
+		})
+
+		It("should keep the configured level by default", func() {
+			Ω(SetVerbosity(false, false)).Should(Equal(LevelDebug))
+		})
+
+		It("should not be both verbose and quiet", func() {
+			_, err := SetVerbosity(true, true)
+			Ω(err).Should(MatchError("cannot be both verbose and quiet"))
+		})
+
+	})
+
 })
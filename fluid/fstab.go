@@ -11,9 +11,11 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"regexp"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"bazil.org/fuse"
@@ -28,6 +30,13 @@ const (
 	fstabUpdateDate = "Monday, 02 Jan 2006 at 15:04:05 -0700"
 )
 
+// Access time update modes that can be specified as mount options.
+const (
+	StrictAtime = "strictatime" // Update the access time on every access
+	RelAtime    = "relatime"    // Update the access time if not newer than the modification time
+	NoAtime     = "noatime"     // Never update the access time
+)
+
 //===========================================================================
 // FS Table Structs and Interfaces
 //===========================================================================
@@ -91,7 +100,19 @@ type FSTable struct {
 // FileSystem objects and is primarily used by FluidFS
 type FuseFSTable struct {
 	FSTable
-	FuseFS []*FileSystem // A list of connected fuse.FS interface objects
+	FuseFS      []*FileSystem // A list of connected fuse.FS interface objects
+	mu          sync.RWMutex  // Guards the file systems while they are reloaded
+	echan       chan error    // Reports errors of running file systems
+	maintenance bool          // If the file systems are in maintenance mode
+}
+
+// ReloadReport describes how the mounts were reconciled with a new fstab.
+type ReloadReport struct {
+	Path      string   // The path of the fstab that was loaded
+	Mounted   []string // The prefixes of the mount points that were added
+	Unmounted []string // The prefixes of the mount points that were removed
+	Unchanged []string // The prefixes of the mount points left running
+	Failed    []string // Errors of mount points that could not be reconciled
 }
 
 //===========================================================================
@@ -140,6 +161,11 @@ func (mp *MountPoint) Parse(line string) error {
 	opts := strings.ToLower(fields[5])
 	mp.Options = strings.Split(opts, ",")
 
+	// Validate the umask option if it is specified.
+	if _, err = mp.Umask(); err != nil {
+		return err
+	}
+
 	// Parse the Store and Replicate Boolean values
 	if mp.Store, err = strconv.ParseBool(fields[6]); err != nil {
 		return fmt.Errorf("could not parse Store field: %s", err.Error())
@@ -175,6 +201,96 @@ func (mp *MountPoint) String() string {
 	return strings.Join(fields, " ")
 }
 
+// Umask returns the permission bits to clear from the mode of files and
+// directories created in the mount point, specified by the "umask=022" option
+// as an octal value. If the option is not specified, no bits are cleared.
+func (mp *MountPoint) Umask() (os.FileMode, error) {
+	for _, opt := range mp.Options {
+		if !strings.HasPrefix(opt, "umask=") {
+			continue
+		}
+
+		umask, err := strconv.ParseUint(strings.TrimPrefix(opt, "umask="), 8, 32)
+		if err != nil || umask > 0777 {
+			return 0, fmt.Errorf("could not parse umask option: %q is not an octal permission", opt)
+		}
+
+		return os.FileMode(umask), nil
+	}
+
+	return 0, nil
+}
+
+// CaseFold returns true if the "casefold" option is specified, in which case
+// names in the mount point are matched regardless of case, as on the macOS
+// native file system, while preserving the case names were created with.
+func (mp *MountPoint) CaseFold() bool {
+	return ListContains("casefold", mp.Options)
+}
+
+// AtimeMode returns how access times are updated in the mount point. Access
+// time updates can be reduced with the "relatime" option or suppressed with
+// the "noatime" option for read heavy workloads, otherwise access times are
+// updated on every access. If both are specified then noatime wins.
+func (mp *MountPoint) AtimeMode() string {
+	if ListContains(NoAtime, mp.Options) {
+		return NoAtime
+	}
+
+	if ListContains(RelAtime, mp.Options) {
+		return RelAtime
+	}
+
+	return StrictAtime
+}
+
+// Check returns an error if the prefix is not a legal namespace component or
+// if the path is empty, without checking the path on disk, so that an fstab
+// can be loaded even if the directory of one of its mount points is missing.
+func (mp *MountPoint) Check() error {
+	switch {
+	case mp.Prefix == "":
+		return errors.New("mount point prefix cannot be empty")
+	case strings.HasPrefix(mp.Prefix, "/"):
+		return errors.New("prefix cannot start with '/'")
+	case strings.Contains(mp.Prefix, "/"):
+		return fmt.Errorf("prefix '%s' cannot contain '/'", mp.Prefix)
+	case mp.Prefix == "." || mp.Prefix == "..":
+		return fmt.Errorf("prefix '%s' is not a legal name", mp.Prefix)
+	}
+
+	if mp.Path == "" {
+		return errors.New("mount point path cannot be empty")
+	}
+
+	return nil
+}
+
+// Validate returns an error if the mount point does not pass Check or if the
+// path is not an existing directory. Whether the directory is empty is not
+// checked, since the files of the mount point are listed in it while it is
+// mounted; new mount points are checked when they are added instead.
+func (mp *MountPoint) Validate() error {
+	if err := mp.Check(); err != nil {
+		return err
+	}
+
+	info, err := os.Stat(mp.Path)
+	if os.IsNotExist(err) {
+		return fmt.Errorf("mount path '%s' does not exist", mp.Path)
+	}
+
+	if err != nil {
+		return fmt.Errorf("could not stat mount path '%s': %s", mp.Path, err.Error())
+	}
+
+	if !info.IsDir() {
+		return fmt.Errorf("mount path '%s' is not a directory", mp.Path)
+	}
+
+	return nil
+}
+
 // MountOptions constructs a list of FUSE MountOption flags based on the
 // Options loaded from the mount point string. The currently specified mount
 // options are as follows (also called "defaults"):
@@ -280,7 +396,9 @@ func (fstab *FSTable) Load(path string) error {
 
 	// Create a line scanner to read the fstab file line by line.
 	scanner := bufio.NewScanner(fobj)
+	lineno := 0
 	for scanner.Scan() {
+		lineno++
 		line := scanner.Text()
 		line = strings.TrimSpace(line)
 
@@ -301,7 +419,7 @@ func (fstab *FSTable) Load(path string) error {
 				// Parse the date if possible
 				date, err := time.Parse(fstabUpdateDate, strings.TrimSpace(sub[1]))
 				if err != nil {
-					return fmt.Errorf("could not parse update line: %s", err.Error())
+					return fmt.Errorf("fstab line %d: could not parse update line: %s", lineno, err.Error())
 				}
 
 				// Set the updated time stamp.
@@ -318,7 +436,17 @@ func (fstab *FSTable) Load(path string) error {
 			// Otherwise, this line is a mount point definition (or better be).
 			mp := new(MountPoint)
 			if err := mp.Parse(line); err != nil {
-				return err
+				return fmt.Errorf("fstab line %d: %s", lineno, err.Error())
+			}
+
+			// Check the mount point and that it is unique in the fstab; whether
+			// the path exists is only validated when it is mounted.
+			if err := mp.Check(); err != nil {
+				return fmt.Errorf("fstab line %d: %s", lineno, err.Error())
+			}
+
+			if err := fstab.unique(mp); err != nil {
+				return fmt.Errorf("fstab line %d: %s", lineno, err.Error())
 			}
 
 			// Add the comments to the mount point and reset the comments
@@ -365,18 +493,24 @@ func (fstab *FSTable) Save(path string) error {
 // and may return an error. All MountPoints shoudl be added through this
 // method.
 func (fstab *FSTable) AddMountPoint(mp *MountPoint) error {
-	// Verify MountPoint uniqueness
-	for _, cmp := range fstab.Mounts {
-		if mp.UUID == cmp.UUID {
-			return fmt.Errorf("mount point with uuid '%s' already exists", cmp.UUID.String())
-		}
+	// Verify the MountPoint is valid and unique
+	if err := mp.Validate(); err != nil {
+		return err
+	}
 
-		if mp.Path == cmp.Path {
-			return fmt.Errorf("mount point with path '%s' already exists", cmp.Path)
+	if err := fstab.unique(mp); err != nil {
+		return err
+	}
+
+	// Only mount over files in the directory if the option allows it
+	if !ListContains("nonempty", mp.Options) {
+		names, err := ioutil.ReadDir(mp.Path)
+		if err != nil {
+			return fmt.Errorf("could not read mount path '%s': %s", mp.Path, err.Error())
 		}
 
-		if mp.Prefix == cmp.Prefix {
-			return fmt.Errorf("mount point with prefix '%s' already exists", cmp.Prefix)
+		if len(names) > 0 {
+			return fmt.Errorf("mount path '%s' is not empty, specify the nonempty option to mount over it", mp.Path)
 		}
 	}
 
@@ -391,6 +525,26 @@ func (fstab *FSTable) AddMountPoint(mp *MountPoint) error {
 	return nil
 }
 
+// Returns an error if the UUID, path or prefix of the mount point is already
+// used by a mount point in the fstab.
+func (fstab *FSTable) unique(mp *MountPoint) error {
+	for _, cmp := range fstab.Mounts {
+		if mp.UUID == cmp.UUID {
+			return fmt.Errorf("mount point with uuid '%s' already exists", cmp.UUID.String())
+		}
+
+		if mp.Path == cmp.Path {
+			return fmt.Errorf("mount point with path '%s' already exists", cmp.Path)
+		}
+
+		if mp.Prefix == cmp.Prefix {
+			return fmt.Errorf("mount point with prefix '%s' already exists", cmp.Prefix)
+		}
+	}
+
+	return nil
+}
+
 // Status returns a string that updates the user about the current status of
 // FSTable mount points, indicating number and health.
 func (fstab *FSTable) Status() string {
@@ -403,26 +557,281 @@ func (fstab *FSTable) Status() string {
 
 // Run a FileSystem on all MountPoints
 func (fs *FuseFSTable) Run(echan chan error) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
 	// Make the FuseFS File system list
-	fs.FuseFS = make([]*FileSystem, len(fs.Mounts))
+	fs.FuseFS = make([]*FileSystem, 0, len(fs.Mounts))
+	fs.echan = echan
 
-	for i, mp := range fs.Mounts {
-		// Create and add the fs to the file system list.
-		fs.FuseFS[i] = new(FileSystem)
-		if err := fs.FuseFS[i].Init(mp); err != nil {
+	for _, mp := range fs.Mounts {
+		if err := fs.start(mp); err != nil {
 			return err
 		}
+	}
+
+	return nil
+}
+
+// Reload the fstab from the path, or from the path it was loaded from if the
+// path is empty, and reconcile the running file systems with it: mount points
+// that were added are mounted and those that were removed are unmounted,
+// while mount points whose definition is unchanged keep running undisturbed.
+// A mount point whose definition changed is unmounted and mounted again.
+// File systems are only started if the table is running.
+//
+// The new list of file systems is built before any are stopped and replaces
+// the running list once the fstab is reconciled. A mount point that cannot be
+// unmounted keeps running and one that cannot be mounted is not started; the
+// errors are returned in the report rather than stopping the replica.
+func (fs *FuseFSTable) Reload(path string) (*ReloadReport, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	if path == "" {
+		path = fs.Path
+	}
+
+	// Unlike Load, a missing fstab is an error, since it would unmount all
+	if _, err := os.Stat(path); err != nil {
+		return nil, fmt.Errorf("could not reload the fstab: %s", err.Error())
+	}
+
+	table := new(FSTable)
+	if err := table.Load(path); err != nil {
+		return nil, err
+	}
+
+	// Index the running file systems by their definition
+	running := make(map[string]*FileSystem, len(fs.FuseFS))
+	for _, fsc := range fs.FuseFS {
+		running[fsc.mount.String()] = fsc
+	}
+
+	// Create the file systems of the new mount point definitions before any
+	// running file system is stopped, so that nothing changes on an error.
+	defs := make(map[string]bool, len(table.Mounts))
+	created := make(map[string]*FileSystem)
+	for _, mp := range table.Mounts {
+		def := mp.String()
+		defs[def] = true
+		if _, ok := running[def]; ok {
+			continue
+		}
+
+		fsc, err := fs.create(mp)
+		if err != nil {
+			return nil, err
+		}
+		created[def] = fsc
+	}
+
+	report := &ReloadReport{
+		Path:      path,
+		Mounted:   make([]string, 0),
+		Unmounted: make([]string, 0),
+		Unchanged: make([]string, 0),
+		Failed:    make([]string, 0),
+	}
+
+	// Stop the file systems that are no longer defined, keeping any that
+	// cannot be stopped in the list since they are still running.
+	fuseFS := make([]*FileSystem, 0, len(table.Mounts))
+	for _, fsc := range fs.FuseFS {
+		if defs[fsc.mount.String()] {
+			continue
+		}
+
+		logger.Info("unmounting fluidfs://%s from %s", fsc.mount.Prefix, fsc.mount.Path)
+		if err := fsc.Shutdown(); err != nil {
+			err = fmt.Errorf("could not unmount fluidfs://%s: %s", fsc.mount.Prefix, err.Error())
+			logger.Error(err.Error())
+			report.Failed = append(report.Failed, err.Error())
+			fuseFS = append(fuseFS, fsc)
+			continue
+		}
+		report.Unmounted = append(report.Unmounted, fsc.mount.Prefix)
+	}
+
+	// Keep the running file systems in the order of the new fstab
+	for _, mp := range table.Mounts {
+		if fsc, ok := running[mp.String()]; ok {
+			fuseFS = append(fuseFS, fsc)
+			report.Unchanged = append(report.Unchanged, mp.Prefix)
+			continue
+		}
+
+		fsc := created[mp.String()]
+		if err := fs.mountWait(fsc); err != nil {
+			err = fmt.Errorf("could not mount fluidfs://%s: %s", mp.Prefix, err.Error())
+			logger.Error(err.Error())
+			report.Failed = append(report.Failed, err.Error())
+			continue
+		}
+
+		fuseFS = append(fuseFS, fsc)
+		report.Mounted = append(report.Mounted, mp.Prefix)
+	}
+
+	fs.FuseFS = fuseFS
+	fs.FSTable = *table
+	logger.Info(
+		"reloaded fstab from %s: %d mounted, %d unmounted, %d unchanged, %d failed",
+		path, len(report.Mounted), len(report.Unmounted), len(report.Unchanged), len(report.Failed),
+	)
+	return report, nil
+}
+
+// Create the FileSystem for the mount point, in the maintenance mode of the
+// table. Must be called with the table locked.
+func (fs *FuseFSTable) create(mp *MountPoint) (*FileSystem, error) {
+	fsc := new(FileSystem)
+	if err := fsc.Init(mp); err != nil {
+		return nil, err
+	}
+	fsc.SetMaintenance(fs.maintenance)
+	return fsc, nil
+}
 
-		// Mount and run the file system in a separate go routine
+// Create the FileSystem for the mount point, adding it to the file system
+// list and mounting and running it if the table is running. Must be called
+// with the table locked.
+func (fs *FuseFSTable) start(mp *MountPoint) error {
+	fsc, err := fs.create(mp)
+	if err != nil {
+		return err
+	}
+	fs.FuseFS = append(fs.FuseFS, fsc)
+
+	// Mount and run the file system in a separate go routine
+	if fs.echan != nil {
 		logger.Info("mounting fluidfs://%s on %s", mp.Prefix, mp.Path)
-		go fs.FuseFS[i].Run(echan)
+		go fsc.Run(fs.echan)
 	}
 
 	return nil
 }
 
+// Mount the file system if the table is running and serve it in a separate
+// go routine. Unlike start, the mount is waited for and an error mounting is
+// returned rather than reported to the table's error channel, which is only
+// sent errors that occur while the file system is served. Must be called
+// with the table locked.
+func (fs *FuseFSTable) mountWait(fsc *FileSystem) error {
+	if fs.echan == nil {
+		return nil
+	}
+
+	logger.Info("mounting fluidfs://%s on %s", fsc.mount.Prefix, fsc.mount.Path)
+	if err := fsc.connect(); err != nil {
+		return err
+	}
+
+	go fsc.serve(fs.echan)
+	return nil
+}
+
+// Ready returns an error if any of the mount points is not yet mounted.
+func (fs *FuseFSTable) Ready() error {
+	fs.mu.RLock()
+	defer fs.mu.RUnlock()
+
+	if len(fs.FuseFS) < len(fs.Mounts) {
+		return errors.New("file systems have not been started")
+	}
+
+	for _, fsc := range fs.FuseFS {
+		if !fsc.Mounted() {
+			return fmt.Errorf("fluidfs://%s is not mounted", fsc.mount.Prefix)
+		}
+	}
+
+	return nil
+}
+
+// Dirty returns the number of unflushed files across all FileSystem objects.
+func (fs *FuseFSTable) Dirty() int {
+	fs.mu.RLock()
+	defer fs.mu.RUnlock()
+
+	count := 0
+	for _, fsc := range fs.FuseFS {
+		count += fsc.Dirty()
+	}
+	return count
+}
+
+// Flush all FileSystem objects, returning the number of files flushed.
+func (fs *FuseFSTable) Flush() int {
+	fs.mu.RLock()
+	defer fs.mu.RUnlock()
+
+	count := 0
+	for _, fsc := range fs.FuseFS {
+		count += fsc.Flush()
+	}
+	return count
+}
+
+// SetMaintenance enters or leaves maintenance mode on all FileSystem objects,
+// including those mounted while in maintenance mode, returning the number of
+// files flushed on entering maintenance mode.
+func (fs *FuseFSTable) SetMaintenance(enabled bool) int {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	fs.maintenance = enabled
+	count := 0
+	for _, fsc := range fs.FuseFS {
+		count += fsc.SetMaintenance(enabled)
+	}
+	return count
+}
+
+// Maintenance returns true if the file systems are in maintenance mode.
+func (fs *FuseFSTable) Maintenance() bool {
+	fs.mu.RLock()
+	defer fs.mu.RUnlock()
+	return fs.maintenance
+}
+
+// Prefix returns the FileSystem with the specified fluidfs prefix.
+func (fs *FuseFSTable) Prefix(prefix string) (*FileSystem, error) {
+	fs.mu.RLock()
+	defer fs.mu.RUnlock()
+
+	for _, fsc := range fs.FuseFS {
+		if fsc.mount.Prefix == prefix {
+			return fsc, nil
+		}
+	}
+
+	return nil, fmt.Errorf("no mount point with prefix '%s'", prefix)
+}
+
+// Find returns the FileSystem mounted at the local path along with the path
+// relative to the root of the mount point.
+func (fs *FuseFSTable) Find(path string) (*FileSystem, string, error) {
+	fs.mu.RLock()
+	defer fs.mu.RUnlock()
+
+	path = filepath.Clean(path)
+	for _, fsc := range fs.FuseFS {
+		rel, err := filepath.Rel(fsc.mount.Path, path)
+		if err != nil || rel == ".." || strings.HasPrefix(rel, "../") {
+			continue
+		}
+		return fsc, filepath.ToSlash(rel), nil
+	}
+
+	return nil, "", fmt.Errorf("%s is not in a fluidfs mount point", path)
+}
+
 // Shutdown all FileSystem objects
 func (fs *FuseFSTable) Shutdown() error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
 	errs := make([]error, 0)
 	for _, fsc := range fs.FuseFS {
 		if err := fsc.Shutdown(); err != nil {
@@ -1,6 +1,7 @@
 package fluid_test
 
 import (
+	"bytes"
 	"fmt"
 	"io/ioutil"
 	"os"
@@ -20,6 +21,23 @@ import (
 
 var _ = Describe("fstab", func() {
 
+	// Copy the test fstab into the directory, pointing its mount points at
+	// directories created in the directory so that they validate.
+	fixture := func(dir string) string {
+		data, err := ioutil.ReadFile(filepath.Join("testdata", "fstab"))
+		Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+
+		mnt := filepath.Join(dir, "mnt")
+		for _, name := range []string{"alpha", "bravo", "charlie", "delta"} {
+			Ω(os.MkdirAll(filepath.Join(mnt, name), 0755)).Should(Succeed())
+		}
+
+		path := filepath.Join(dir, "fstab")
+		data = bytes.Replace(data, []byte("/data/mnt"), []byte(mnt), -1)
+		Ω(ioutil.WriteFile(path, data, 0644)).Should(Succeed())
+		return path
+	}
+
 	Describe("FSTable", func() {
 
 		var err error
@@ -81,8 +99,8 @@ var _ = Describe("fstab", func() {
 		})
 
 		It("should be able to load a test fstab file", func() {
-			path := filepath.Join("testdata", "fstab")
-			fstab.Load(path)
+			path := fixture(tmpDir)
+			Ω(fstab.Load(path)).Should(Succeed())
 
 			updated := time.Date(2017, time.January, 11, 22, 14, 25, 0, time.UTC)
 
@@ -101,15 +119,201 @@ var _ = Describe("fstab", func() {
 		})
 
 		It("should be able to save a test fstab file", func() {
-			inpath := filepath.Join("testdata", "fstab")
+			inpath := fixture(tmpDir)
 			err := fstab.Load(inpath)
 			Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
 
-			outpath := filepath.Join(tmpDir, "fstab")
+			outpath := filepath.Join(tmpDir, "fstab.saved")
 			err = fstab.Save(outpath)
 			Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
 		})
 
+		It("should report the line of invalid mount points", func() {
+			fixture(tmpDir)
+			mnt := filepath.Join(tmpDir, "mnt")
+			Ω(ioutil.WriteFile(filepath.Join(mnt, "file"), []byte("file"), 0644)).Should(Succeed())
+
+			cases := map[string]string{
+				"a418369c-54af-4661-a910-ee9b93c9f727 %s/alpha /foo 501 22 defaults 1 1":    "fstab line 3: prefix cannot start with '/'",
+				"a418369c-54af-4661-a910-ee9b93c9f727 %s/alpha foo/bar 501 22 defaults 1 1": "fstab line 3: prefix 'foo/bar' cannot contain '/'",
+				"a418369c-54af-4661-a910-ee9b93c9f727 %s/alpha .. 501 22 defaults 1 1":      "fstab line 3: prefix '..' is not a legal name",
+				"not-a-uuid %s/alpha foo 501 22 defaults 1 1":                               "fstab line 3: could not parse UUID field",
+			}
+
+			for line, msg := range cases {
+				path := filepath.Join(tmpDir, "invalid")
+				data := fmt.Sprintf("# comment\n\n"+line+"\n", mnt)
+				Ω(ioutil.WriteFile(path, []byte(data), 0644)).Should(Succeed())
+
+				err := fstab.Load(path)
+				Ω(err).Should(HaveOccurred(), line)
+				Ω(err.Error()).Should(HavePrefix(strings.Replace(msg, "%s", mnt, -1)), line)
+			}
+		})
+
+		It("should load mount points whose path does not exist", func() {
+			fixture(tmpDir)
+			mnt := filepath.Join(tmpDir, "mnt")
+			Ω(ioutil.WriteFile(filepath.Join(mnt, "file"), []byte("file"), 0644)).Should(Succeed())
+
+			lines := []string{
+				"a418369c-54af-4661-a910-ee9b93c9f727 %[1]s/missing foo 501 22 defaults 1 1",
+				"8859b5c7-d860-11e6-9b0a-28cfe91c6851 %[1]s/file bar 501 22 defaults 1 1",
+			}
+			path := filepath.Join(tmpDir, "missing")
+			data := fmt.Sprintf(strings.Join(lines, "\n"), mnt)
+			Ω(ioutil.WriteFile(path, []byte(data), 0644)).Should(Succeed())
+
+			Ω(fstab.Load(path)).Should(Succeed())
+			Ω(fstab.Mounts).Should(HaveLen(2))
+
+			// The paths are validated when the mount points are mounted
+			Ω(fstab.Mounts[0].Validate()).Should(MatchError(fmt.Sprintf("mount path '%s/missing' does not exist", mnt)))
+			Ω(fstab.Mounts[1].Validate()).Should(MatchError(fmt.Sprintf("mount path '%s/file' is not a directory", mnt)))
+		})
+
+		It("should not load duplicate mount points", func() {
+			fixture(tmpDir)
+			mnt := filepath.Join(tmpDir, "mnt")
+
+			lines := []string{
+				"a418369c-54af-4661-a910-ee9b93c9f727 %[1]s/alpha foo 501 22 defaults 1 1",
+				"8859b5c7-d860-11e6-9b0a-28cfe91c6851 %[1]s/bravo foo 501 22 defaults 1 1",
+			}
+			path := filepath.Join(tmpDir, "duplicate")
+			data := fmt.Sprintf(strings.Join(lines, "\n"), mnt)
+			Ω(ioutil.WriteFile(path, []byte(data), 0644)).Should(Succeed())
+
+			err := fstab.Load(path)
+			Ω(err).Should(MatchError("fstab line 2: mount point with prefix 'foo' already exists"))
+		})
+
+		It("should validate mount points when they are added", func() {
+			Ω(fstab.Load(fixture(tmpDir))).Should(Succeed())
+			mnt := filepath.Join(tmpDir, "mnt")
+
+			mp := &MountPoint{UUID: uuid.New(), Path: filepath.Join(mnt, "delta"), Prefix: "/qux"}
+			Ω(fstab.AddMountPoint(mp)).Should(MatchError("prefix cannot start with '/'"))
+
+			mp.Prefix = "foo"
+			Ω(fstab.AddMountPoint(mp)).Should(MatchError("mount point with prefix 'foo' already exists"))
+
+			mp.Prefix = "qux"
+			Ω(ioutil.WriteFile(filepath.Join(mp.Path, "a.txt"), []byte("a"), 0644)).Should(Succeed())
+			Ω(fstab.AddMountPoint(mp)).Should(MatchError(ContainSubstring("is not empty")))
+
+			mp.Options = []string{"nonempty"}
+			Ω(fstab.AddMountPoint(mp)).Should(Succeed())
+			Ω(fstab.Mounts).Should(HaveLen(4))
+		})
+
+	})
+
+	Describe("FuseFSTable", func() {
+
+		var err error
+		var tmpDir string
+		var table *FuseFSTable
+
+		BeforeEach(func() {
+			tmpDir, err = ioutil.TempDir("", TempDirPrefix)
+			Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+
+			table = new(FuseFSTable)
+			Ω(table.Load(fixture(tmpDir))).Should(Succeed())
+		})
+
+		AfterEach(func() {
+			err = os.RemoveAll(tmpDir)
+			Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+		})
+
+		// Return the prefixes of the live file systems.
+		prefixes := func() []string {
+			names := make([]string, 0)
+			for _, name := range []string{"foo", "bar", "baz", "qux"} {
+				if _, err := table.Prefix(name); err == nil {
+					names = append(names, name)
+				}
+			}
+			return names
+		}
+
+		It("should start the file systems of the fstab on reload", func() {
+			report, err := table.Reload("")
+			Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+			Ω(report.Path).Should(Equal(filepath.Join(tmpDir, "fstab")))
+			Ω(report.Mounted).Should(Equal([]string{"foo", "bar", "baz"}))
+			Ω(report.Unmounted).Should(BeEmpty())
+			Ω(prefixes()).Should(ConsistOf("foo", "bar", "baz"))
+		})
+
+		It("should reconcile the live mounts with a new fstab", func() {
+			_, err := table.Reload("")
+			Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+
+			foo, err := table.Prefix("foo")
+			Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+
+			// Keep foo, remove bar, change the options of baz and add qux
+			lines := []string{
+				"a418369c-54af-4661-a910-ee9b93c9f727 %[1]s/alpha foo 501 22 defaults 1 1",
+				"598c5619-d862-11e6-9360-28cfe91c6851 %[1]s/charlie baz 1002 42 noatime 1 0",
+				"8d9a1fd2-0f5b-4bb5-9c5c-3b8e3f0b3c51 %[1]s/delta qux 501 22 defaults 1 1",
+			}
+			path := filepath.Join(tmpDir, "fstab.reload")
+			data := fmt.Sprintf(strings.Join(lines, "\n"), filepath.Join(tmpDir, "mnt"))
+			Ω(ioutil.WriteFile(path, []byte(data), 0644)).Should(Succeed())
+
+			report, err := table.Reload(path)
+			Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+			Ω(report.Mounted).Should(Equal([]string{"baz", "qux"}))
+			Ω(report.Unmounted).Should(ConsistOf("bar", "baz"))
+			Ω(report.Unchanged).Should(Equal([]string{"foo"}))
+			Ω(report.Failed).Should(BeEmpty())
+
+			Ω(prefixes()).Should(ConsistOf("foo", "baz", "qux"))
+			Ω(table.FuseFS).Should(HaveLen(3))
+			Ω(table.Mounts).Should(HaveLen(3))
+			Ω(table.Path).Should(Equal(path))
+
+			// The unchanged mount point is not disturbed
+			fsc, err := table.Prefix("foo")
+			Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+			Ω(fsc).Should(BeIdenticalTo(foo))
+		})
+
+		It("should not change the running mounts if a file system cannot be created", func() {
+			_, err := table.Reload("")
+			Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+			running := append([]*FileSystem(nil), table.FuseFS...)
+
+			// Remove bar and add qux with an invalid umask
+			lines := []string{
+				"a418369c-54af-4661-a910-ee9b93c9f727 %[1]s/alpha foo 501 22 defaults 1 1",
+				"598c5619-d862-11e6-9360-28cfe91c6851 %[1]s/charlie baz 1002 42 defaults 1 0",
+				"8d9a1fd2-0f5b-4bb5-9c5c-3b8e3f0b3c51 %[1]s/delta qux 501 22 umask=999 1 1",
+			}
+			path := filepath.Join(tmpDir, "fstab.reload")
+			data := fmt.Sprintf(strings.Join(lines, "\n"), filepath.Join(tmpDir, "mnt"))
+			Ω(ioutil.WriteFile(path, []byte(data), 0644)).Should(Succeed())
+
+			_, err = table.Reload(path)
+			Ω(err).Should(HaveOccurred())
+			Ω(table.FuseFS).Should(Equal(running))
+			Ω(table.Mounts).Should(HaveLen(3))
+			Ω(table.Path).Should(Equal(filepath.Join(tmpDir, "fstab")))
+		})
+
+		It("should not reload an fstab that does not exist", func() {
+			_, err := table.Reload("")
+			Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+
+			_, err = table.Reload(filepath.Join(tmpDir, "missing"))
+			Ω(err).Should(HaveOccurred())
+			Ω(prefixes()).Should(ConsistOf("foo", "bar", "baz"))
+		})
+
 	})
 
 	Describe("MountPoint", func() {
@@ -199,6 +403,38 @@ var _ = Describe("fstab", func() {
 
 		})
 
+		It("should parse and validate the umask option", func() {
+			mp := new(MountPoint)
+			err := mp.Parse("8859b5c7-d860-11e6-9b0a-28cfe91c6851 /data/mnt/bravo bar 501 22 auto,umask=027 0 1")
+			Ω(err).ShouldNot(HaveOccurred())
+
+			umask, err := mp.Umask()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(umask).Should(Equal(os.FileMode(0027)))
+
+			mp.Options = []string{"defaults"}
+			umask, err = mp.Umask()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(umask).Should(BeZero())
+
+			for _, opt := range []string{"umask=", "umask=089", "umask=1777", "umask=abc"} {
+				line := fmt.Sprintf("8859b5c7-d860-11e6-9b0a-28cfe91c6851 /data/mnt/bravo bar 501 22 %s 0 1", opt)
+				err = mp.Parse(line)
+				Ω(err).Should(MatchError(MatchRegexp(`could not parse umask option:`)), opt)
+			}
+		})
+
+		It("should parse the access time options", func() {
+			mp := new(MountPoint)
+			Ω(mp.AtimeMode()).Should(Equal(StrictAtime))
+
+			mp.Options = []string{"auto", "relatime"}
+			Ω(mp.AtimeMode()).Should(Equal(RelAtime))
+
+			mp.Options = []string{"relatime", "noatime"}
+			Ω(mp.AtimeMode()).Should(Equal(NoAtime))
+		})
+
 		It("should be able to parse booleans", func() {
 			var lines = []struct {
 				line  string
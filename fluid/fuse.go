@@ -3,10 +3,19 @@
 package fluid
 
 import (
+	"bufio"
+	"bytes"
 	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
 	"sync"
-
-	"github.com/bbengfort/sequence"
+	"syscall"
+	"time"
 
 	"bazil.org/fuse"
 	fusefs "bazil.org/fuse/fs"
@@ -42,21 +51,239 @@ type Entity interface {
 	GetNode() *Node            // Returns the node for the entity type
 }
 
+// MountFunc mounts a FUSE file system at the directory, e.g. fuse.Mount.
+type MountFunc func(dir string, options ...fuse.MountOption) (*fuse.Conn, error)
+
+// MountWithRetry calls the mount function, retrying with exponential backoff
+// as specified by the mount configuration if the mount fails or times out.
+// Returns the error of the last attempt if all of the attempts fail. A mount
+// that completes after it timed out is unmounted with the unmount function,
+// e.g. fuse.Unmount, so that it does not leave a dead mount on the directory.
+func MountWithRetry(mount MountFunc, unmount UnmountFunc, dir string, options []fuse.MountOption, conf *MountConfig) (*fuse.Conn, error) {
+	backoff := conf.Backoff
+
+	for attempt := 0; ; attempt++ {
+		conn, err := mountWithTimeout(mount, unmount, dir, options, conf.Timeout)
+		if err == nil {
+			return conn, nil
+		}
+
+		if attempt >= conf.Retries {
+			return nil, err
+		}
+
+		logger.Warn("could not mount %s (attempt %d of %d), retrying in %s: %s", dir, attempt+1, conf.Retries+1, backoff, err.Error())
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+// Call the mount function, returning an error if it doesn't complete within
+// the timeout. If the mount completes after the timeout, it is unmounted and
+// its connection closed; closing the connection alone would leave the kernel
+// mount behind without a server to answer its requests.
+func mountWithTimeout(mount MountFunc, unmount UnmountFunc, dir string, options []fuse.MountOption, timeout time.Duration) (*fuse.Conn, error) {
+	if timeout == 0 {
+		return mount(dir, options...)
+	}
+
+	type result struct {
+		conn *fuse.Conn
+		err  error
+	}
+
+	results := make(chan result, 1)
+	go func() {
+		conn, err := mount(dir, options...)
+		results <- result{conn, err}
+	}()
+
+	select {
+	case r := <-results:
+		return r.conn, r.err
+	case <-time.After(timeout):
+		go func() {
+			if r := <-results; r.conn != nil {
+				if err := unmount(dir); err != nil {
+					logger.Warn("could not unmount %s after the mount timed out: %s", dir, err.Error())
+				}
+				r.conn.Close()
+			}
+		}()
+		return nil, fmt.Errorf("mount timed out after %s", timeout)
+	}
+}
+
+// MountTablePath is read to find the file systems mounted on Linux; on other
+// systems the output of the mount command is used instead.
+const MountTablePath = "/proc/self/mounts"
+
+// MountInfo describes a file system in the mount table of the host.
+type MountInfo struct {
+	Source string // The device or name of the mounted file system
+	Path   string // The directory the file system is mounted on
+	FSType string // The type of the file system, if known
+	Stale  bool   // If the file system no longer has a server, e.g. FUSE
+}
+
+// IsFluidFS returns true if the mounted file system was mounted by FluidFS.
+func (m *MountInfo) IsFluidFS() bool {
+	return m.Source == "fluidfs" || strings.HasSuffix(m.FSType, ".fluidfs")
+}
+
+// MountLookupFunc returns the file system mounted on the directory or nil if
+// no file system is mounted there, e.g. MountedAt.
+type MountLookupFunc func(dir string) (*MountInfo, error)
+
+// UnmountFunc unmounts the file system mounted on the directory, e.g.
+// fuse.Unmount.
+type UnmountFunc func(dir string) error
+
+// ParseMountTable parses mount table entries either in the format of
+// /proc/self/mounts, e.g. "fluidfs /data/mnt fuse.fluidfs rw 0 0", or in the
+// format of the output of the mount command on macOS and BSD systems, e.g.
+// "fluidfs on /data/mnt (osxfuse, local)". Lines that cannot be parsed are
+// skipped.
+func ParseMountTable(r io.Reader) ([]*MountInfo, error) {
+	mounts := make([]*MountInfo, 0)
+	scanner := bufio.NewScanner(r)
+
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		// The output of the mount command, the type is the first option
+		if idx := strings.Index(line, " on "); idx > 0 && strings.HasSuffix(line, ")") {
+			rest := line[idx+4:]
+			if opt := strings.LastIndex(rest, " ("); opt > 0 {
+				fstype := strings.SplitN(rest[opt+2:len(rest)-1], ",", 2)[0]
+				mounts = append(mounts, &MountInfo{
+					Source: line[:idx],
+					Path:   rest[:opt],
+					FSType: strings.TrimSpace(fstype),
+				})
+				continue
+			}
+		}
+
+		// The mount table, with spaces in the fields escaped as octal
+		fields := strings.Fields(line)
+		if len(fields) < 3 {
+			continue
+		}
+
+		mounts = append(mounts, &MountInfo{
+			Source: unescapeMountField(fields[0]),
+			Path:   unescapeMountField(fields[1]),
+			FSType: fields[2],
+		})
+	}
+
+	return mounts, scanner.Err()
+}
+
+// Replaces the octal escapes of whitespace and backslashes in a mount table.
+func unescapeMountField(field string) string {
+	return strings.NewReplacer(`\040`, " ", `\011`, "\t", `\012`, "\n", `\134`, `\`).Replace(field)
+}
+
+// MountedAt returns the file system mounted on the directory, or nil if no
+// file system is mounted on it, by reading the mount table of the host. The
+// mount is stale if the directory cannot be stat'd because the connection to
+// the server of the file system was lost, as happens when the process serving
+// a FUSE mount exits without unmounting it.
+func MountedAt(dir string) (*MountInfo, error) {
+	var data []byte
+	var err error
+
+	if data, err = ioutil.ReadFile(MountTablePath); os.IsNotExist(err) {
+		data, err = exec.Command("mount").Output()
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	mounts, err := ParseMountTable(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+
+	// The last mount on the directory is the one that is visible
+	dir = filepath.Clean(dir)
+	for i := len(mounts) - 1; i >= 0; i-- {
+		if filepath.Clean(mounts[i].Path) == dir {
+			mounts[i].Stale = isStaleMount(dir)
+			return mounts[i], nil
+		}
+	}
+	return nil, nil
+}
+
+// Returns true if stat fails on the directory because the connection to the
+// server of the file system mounted on it is no longer available.
+func isStaleMount(dir string) bool {
+	_, err := os.Stat(dir)
+	if perr, ok := err.(*os.PathError); ok {
+		return perr.Err == syscall.ENOTCONN || perr.Err == syscall.ECONNABORTED
+	}
+	return false
+}
+
+// UnmountStale unmounts a stale FluidFS mount left on the directory, e.g. by
+// a replica that did not shut down cleanly, so that the directory can be
+// mounted again. Returns an error without unmounting if another file system
+// is mounted on the directory, or if the FluidFS mount is not stale since it
+// is still being served, e.g. by another replica. If the mount table cannot
+// be read nothing is unmounted, and mounting reports an error if the
+// directory is busy.
+func UnmountStale(dir string, lookup MountLookupFunc, unmount UnmountFunc) error {
+	info, err := lookup(dir)
+	if err != nil {
+		logger.Warn("could not check for a stale mount on %s: %s", dir, err.Error())
+		return nil
+	}
+
+	if info == nil {
+		return nil
+	}
+
+	if !info.IsFluidFS() {
+		return fmt.Errorf("%s is busy: %s (%s) is already mounted there", dir, info.Source, info.FSType)
+	}
+
+	if !info.Stale {
+		return fmt.Errorf("%s is busy: fluidfs is already mounted and served there", dir)
+	}
+
+	logger.Warn("unmounting stale fluidfs mount on %s", dir)
+	if err := unmount(dir); err != nil {
+		return fmt.Errorf("could not unmount stale fluidfs mount on %s: %s", dir, err.Error())
+	}
+	return nil
+}
+
 //===========================================================================
 // FileSystem Handling
 //===========================================================================
 
 // FileSystem implements the fuse.FS* interfaces.
 type FileSystem struct {
-	sync.Mutex                    // A file system can be locked
-	Conn       *fuse.Conn         // A connection to the FUSE server
-	Sequence   *sequence.Sequence // iNode sequence object
-	root       *Dir               // The root of the file system
-	mount      *MountPoint        // The location and options of this mount point
-	nfiles     uint64             // The number of files in the file system
-	ndirs      uint64             // The number of directories in the file system
-	nbytes     uint64             // The amount of data in the file system
-	readonly   bool               // If the file system is readonly or not
+	sync.Mutex                 // A file system can be locked
+	Conn       *fuse.Conn      // A connection to the FUSE server
+	Sequence   *InodeSequence  // iNode sequence shared by all mounts
+	Limiter    *RequestLimiter // Concurrent request limit shared by all mounts
+	Events     *EventBroker    // Change events published to all subscribers
+	root       *Dir            // The root of the file system
+	mount      *MountPoint     // The location and options of this mount point
+	nfiles     uint64          // The number of files in the file system
+	ndirs      uint64          // The number of directories in the file system
+	nbytes     uint64          // The amount of data in the file system
+	readonly   bool            // If the file system is readonly or not
+	umask      os.FileMode     // Permission bits cleared on create and mkdir
+	casefold   bool            // If names are matched regardless of case
+	atime      string          // How access times are updated
+	mounted    bool            // If the file system is mounted and ready
+	quiesced   bool            // If modifications are rejected for maintenance
 }
 
 // Init a file system with the replica server and the specified mount point.
@@ -65,34 +292,85 @@ func (fs *FileSystem) Init(mp *MountPoint) error {
 	// Local storage of pointers to system resources
 	fs.mount = mp
 
-	// Handle the Sequence initialization
-	fs.Sequence, _ = sequence.New()
+	// Get the umask from the mount options
+	umask, err := mp.Umask()
+	if err != nil {
+		return err
+	}
+	fs.umask = umask
+	fs.casefold = mp.CaseFold()
+	fs.atime = mp.AtimeMode()
+
+	// Share the inode sequence with all mounts, persisted in the database
+	if inodes == nil {
+		if inodes, err = NewInodeSequence(db); err != nil {
+			return err
+		}
+	}
+	fs.Sequence = inodes
+
+	// Share the concurrent request limit with all mounts
+	if limiter == nil {
+		limiter = NewRequestLimiter(config.Mount.MaxRequests)
+	}
+	fs.Limiter = limiter
+
+	// Publish change events to the subscribers of all mounts
+	fs.Events = events
 
 	// Fetch the root node from the database
 	fs.root = new(Dir)
-	fs.root.Init("/", 0755, nil, fs)
+	if err := fs.root.Init("/", 0755, nil, fs); err != nil {
+		return WrapError(ErrDatabase, err, "could not create the root of %s", fs.mount.Prefix)
+	}
 
 	return nil
 }
 
 // Run connects to FUSE, mounts the mount point and Serves the FUSE FS.
 func (fs *FileSystem) Run(echan chan error) {
+	if err := fs.connect(); err != nil {
+		echan <- fmt.Errorf("could not run FS: %s", err.Error())
+		return
+	}
+
+	fs.serve(echan)
+}
+
+// Connect to FUSE and mount the mount point, but do not serve it yet.
+func (fs *FileSystem) connect() error {
 	var err error
 
-	// Unmount the FS in case it was mounted with errors
-	fuse.Unmount(fs.mount.Path)
+	// Unmount the FS in case it was mounted with errors, but only if it is a
+	// stale FluidFS mount rather than another file system.
+	if err = UnmountStale(fs.mount.Path, MountedAt, fuse.Unmount); err != nil {
+		return err
+	}
 
-	// Mount the FS with the specified options.
-	if fs.Conn, err = fuse.Mount(
-		fs.mount.Path, fs.mount.MountOptions()...,
-	); err != nil {
-		echan <- fmt.Errorf("could not run FS: %s", err.Error())
-		return
+	// The fstab is loaded without checking that the mount paths exist.
+	if err = fs.mount.Validate(); err != nil {
+		return err
 	}
 
+	// Mount the FS with the specified options, retrying on failure.
+	fs.Conn, err = MountWithRetry(
+		fuse.Mount, fuse.Unmount, fs.mount.Path, fs.mount.MountOptions(), config.Mount,
+	)
+	return err
+}
+
+// Serve the mounted FUSE FS until it is unmounted, reporting any errors to
+// the channel.
+func (fs *FileSystem) serve(echan chan error) {
+	var err error
+
 	// Ensure that the connection is closed when done.
 	defer fs.Conn.Close()
 
+	// Mark the file system as mounted once the mount is ready.
+	go fs.ready(fs.Conn)
+	defer fs.setMounted(false)
+
 	// Serve the file system.
 	if err = fusefs.Serve(fs.Conn, fs); err != nil {
 		echan <- fmt.Errorf("could not run FS: %s", err.Error())
@@ -102,7 +380,7 @@ func (fs *FileSystem) Run(echan chan error) {
 	// Check if the mount process has an error to report.
 	<-fs.Conn.Ready
 	if fs.Conn.MountError != nil {
-		echan <- fmt.Errorf("could not run FS: %s", err.Error())
+		echan <- fmt.Errorf("could not run FS: %s", fs.Conn.MountError.Error())
 		return
 	}
 }
@@ -125,6 +403,239 @@ func (fs *FileSystem) Shutdown() error {
 	return nil
 }
 
+// Mounted returns true if the file system is mounted and ready to serve.
+func (fs *FileSystem) Mounted() bool {
+	fs.Lock()
+	defer fs.Unlock()
+	return fs.mounted
+}
+
+// Wait for the connection to be ready and mark the file system as mounted.
+func (fs *FileSystem) ready(conn *fuse.Conn) {
+	<-conn.Ready
+	if conn.MountError == nil {
+		fs.setMounted(true)
+	}
+}
+
+// Set the mounted state of the file system.
+func (fs *FileSystem) setMounted(mounted bool) {
+	fs.Lock()
+	defer fs.Unlock()
+	fs.mounted = mounted
+}
+
+// Traverse the file system depth first from the root, calling visit on each
+// entity. The file system is locked for the duration of the traversal, which
+// stops at the first error returned by visit. Files with multiple hard links
+// are only visited once.
+func (fs *FileSystem) Traverse(visit func(Entity) error) error {
+	fs.Lock()
+	defer fs.Unlock()
+	return traverse(fs.root, visit, make(map[uint64]bool))
+}
+
+// Dirty returns the number of files with data that has not been flushed.
+func (fs *FileSystem) Dirty() int {
+	count := 0
+	fs.Traverse(func(ent Entity) error {
+		if f, ok := ent.(*File); ok && f.dirty {
+			count++
+		}
+		return nil
+	})
+
+	return count
+}
+
+// Flush all dirty files in the file system, returning the number flushed.
+func (fs *FileSystem) Flush() int {
+	fs.Lock()
+	defer fs.Unlock()
+	return fs.flush()
+}
+
+// Flush all dirty files, must be called while holding the fs lock.
+func (fs *FileSystem) flush() int {
+	count := 0
+	traverse(fs.root, func(ent Entity) error {
+		if f, ok := ent.(*File); ok && f.dirty {
+			f.flush()
+			count++
+		}
+		return nil
+	}, make(map[uint64]bool))
+
+	logger.Info("flushed %d files in fluidfs://%s", count, fs.mount.Prefix)
+	return count
+}
+
+// SetMaintenance enters or leaves maintenance mode, e.g. for a backup or a
+// migration. Entering maintenance mode flushes the dirty files, then rejects
+// operations that modify the file system with EAGAIN until maintenance mode
+// is left; reads are still served. Returns the number of files flushed.
+func (fs *FileSystem) SetMaintenance(enabled bool) int {
+	fs.Lock()
+	defer fs.Unlock()
+
+	count := 0
+	if enabled && !fs.quiesced {
+		count = fs.flush()
+	}
+
+	fs.quiesced = enabled
+	logger.Info("fluidfs://%s maintenance mode: %t", fs.mount.Prefix, enabled)
+	return count
+}
+
+// Maintenance returns true if the file system is in maintenance mode.
+func (fs *FileSystem) Maintenance() bool {
+	fs.Lock()
+	defer fs.Unlock()
+	return fs.quiesced
+}
+
+// Returns EAGAIN if the file system is in maintenance mode so that operations
+// that modify the file system are rejected. Must be called while holding the
+// fs lock so that the check is atomic with the modification.
+func (fs *FileSystem) writable() error {
+	if fs.quiesced {
+		return fuse.Errno(syscall.EAGAIN)
+	}
+	return nil
+}
+
+// Usage returns the logical and physical bytes used by the subtree at the
+// path relative to the root of the file system. Files are held in memory, so
+// the physical bytes are an estimate of the space the subtree would use as
+// blobs rather than its usage on disk: the data is chunked with the storage
+// configuration and blobs shared by files are counted once. The data is
+// copied under the lock and chunked after unlocking so that FUSE requests are
+// not blocked while it is hashed.
+func (fs *FileSystem) Usage(path string) (logical, physical uint64, err error) {
+	fs.Lock()
+	ent, err := fs.lookup(path)
+	if err != nil {
+		fs.Unlock()
+		return 0, 0, err
+	}
+
+	files := make([][]byte, 0)
+	traverse(ent, func(ent Entity) error {
+		if f, ok := ent.(*File); ok {
+			files = append(files, append([]byte(nil), f.Data...))
+		}
+		return nil
+	}, make(map[uint64]bool))
+	fs.Unlock()
+
+	counter := newUsageCounter(config.Storage)
+	for _, data := range files {
+		if err = counter.add(data); err != nil {
+			return 0, 0, err
+		}
+	}
+
+	return counter.Logical, counter.Physical, nil
+}
+
+// Find the entity at the path relative to the root of the file system. Must
+// be called with the file system locked.
+func (fs *FileSystem) lookup(path string) (Entity, error) {
+	var ent Entity = fs.root
+	for _, name := range strings.Split(path, "/") {
+		if name == "" || name == "." {
+			continue
+		}
+
+		dir, ok := ent.(*Dir)
+		if !ok {
+			return nil, fmt.Errorf("%s: not a directory", path)
+		}
+
+		if _, ent, ok = dir.entry(name); !ok {
+			return nil, fmt.Errorf("%s: no such file or directory", path)
+		}
+	}
+
+	return ent, nil
+}
+
+// TreeNode is a serializable description of an entity in the file system
+// and its children, used to inspect the in-memory directory tree.
+type TreeNode struct {
+	Name     string      `json:"name" yaml:"name"`
+	Inode    uint64      `json:"inode" yaml:"inode"`
+	Mode     string      `json:"mode" yaml:"mode"`
+	Size     uint64      `json:"size" yaml:"size"`
+	Nlink    uint32      `json:"nlink" yaml:"nlink"`
+	Dirty    bool        `json:"dirty,omitempty" yaml:"dirty,omitempty"`
+	Children []*TreeNode `json:"children,omitempty" yaml:"children,omitempty"`
+}
+
+// Tree returns a description of the directory tree held in memory, with the
+// children of each directory sorted by name.
+func (fs *FileSystem) Tree() *TreeNode {
+	fs.Lock()
+	defer fs.Unlock()
+	return tree(fs.root)
+}
+
+// Recursive helper to describe an entity and its children.
+func tree(ent Entity) *TreeNode {
+	node := ent.GetNode()
+	desc := &TreeNode{
+		Name:  node.Name,
+		Inode: node.Attrs.Inode,
+		Mode:  node.Attrs.Mode.String(),
+		Size:  node.Attrs.Size,
+		Nlink: node.Attrs.Nlink,
+	}
+
+	switch ent := ent.(type) {
+	case *File:
+		desc.Dirty = ent.dirty
+	case *Dir:
+		names := make([]string, 0, len(ent.Children))
+		for name := range ent.Children {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		desc.Children = make([]*TreeNode, 0, len(names))
+		for _, name := range names {
+			child := tree(ent.Children[name])
+			child.Name = name // hard links are listed by their link name
+			desc.Children = append(desc.Children, child)
+		}
+	}
+
+	return desc
+}
+
+// Recursive helper for the depth first traversal of the file system.
+func traverse(ent Entity, visit func(Entity) error, seen map[uint64]bool) error {
+	id := ent.GetNode().ID
+	if seen[id] {
+		return nil
+	}
+	seen[id] = true
+
+	if err := visit(ent); err != nil {
+		return err
+	}
+
+	if dir, ok := ent.(*Dir); ok {
+		for _, child := range dir.Children {
+			if err := traverse(child, visit, seen); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
 //===========================================================================
 // FileSystem implements the fuse.FS* interfaces
 //===========================================================================
@@ -0,0 +1,398 @@
+package fluid_test
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"bazil.org/fuse"
+	"golang.org/x/net/context"
+
+	. "github.com/bbengfort/fluidfs/fluid"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("FileSystem", func() {
+
+	var ctx context.Context
+	var fs *FileSystem
+	var root *Dir
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		fs = newFileSystem()
+
+		node, err := fs.Root()
+		Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+		root = node.(*Dir)
+	})
+
+	It("should not mount a mount point whose path does not exist", func() {
+		Ω(os.RemoveAll(filepath.Join(suiteDir, "mnt"))).Should(Succeed())
+
+		echan := make(chan error, 1)
+		fs.Run(echan)
+		Ω(echan).Should(Receive(MatchError(ContainSubstring("mount path '%s' does not exist", filepath.Join(suiteDir, "mnt")))))
+		Ω(fs.Mounted()).Should(BeFalse())
+	})
+
+	It("should traverse every entity in the file system", func() {
+		node, err := root.Mkdir(ctx, &fuse.MkdirRequest{Name: "sub", Mode: 0755})
+		Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+
+		createFile(root, "a.txt", 0644, nil)
+		createFile(node.(*Dir), "b.txt", 0644, nil)
+
+		names := make([]string, 0)
+		Ω(fs.Traverse(func(ent Entity) error {
+			names = append(names, ent.GetNode().Name)
+			return nil
+		})).Should(Succeed())
+
+		Ω(names).Should(ConsistOf("/", "sub", "a.txt", "b.txt"))
+	})
+
+	It("should count and flush dirty files", func() {
+		node, err := root.Mkdir(ctx, &fuse.MkdirRequest{Name: "sub", Mode: 0755})
+		Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+
+		createFile(root, "clean.txt", 0644, nil)
+		createFile(root, "a.txt", 0644, []byte("hello"))
+		createFile(node.(*Dir), "b.txt", 0644, []byte("world"))
+		Ω(fs.Dirty()).Should(Equal(2))
+
+		Ω(fs.Flush()).Should(Equal(2))
+		Ω(fs.Dirty()).Should(BeZero())
+	})
+
+	It("should count and flush dirty files across mounts", func() {
+		other := newFileSystem()
+		node, err := other.Root()
+		Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+
+		createFile(root, "a.txt", 0644, []byte("hello"))
+		createFile(node.(*Dir), "b.txt", 0644, []byte("world"))
+
+		table := &FuseFSTable{FuseFS: []*FileSystem{fs, other}}
+		Ω(table.Dirty()).Should(Equal(2))
+		Ω(table.Flush()).Should(Equal(2))
+		Ω(table.Dirty()).Should(BeZero())
+	})
+
+	It("should describe the directory tree", func() {
+		node, err := root.Mkdir(ctx, &fuse.MkdirRequest{Name: "sub", Mode: 0755})
+		Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+		sub := node.(*Dir)
+
+		a := createFile(root, "a.txt", 0644, []byte("hello"))
+		b := createFile(sub, "b.txt", 0644, nil)
+
+		tree := fs.Tree()
+		Ω(tree.Name).Should(Equal("/"))
+		Ω(tree.Inode).Should(Equal(root.Attrs.Inode))
+		Ω(tree.Children).Should(HaveLen(2))
+
+		// Children are sorted by name.
+		Ω(tree.Children[0].Name).Should(Equal("a.txt"))
+		Ω(tree.Children[0].Inode).Should(Equal(a.Attrs.Inode))
+		Ω(tree.Children[0].Size).Should(Equal(uint64(5)))
+		Ω(tree.Children[0].Dirty).Should(BeTrue())
+		Ω(tree.Children[0].Children).Should(BeNil())
+
+		Ω(tree.Children[1].Name).Should(Equal("sub"))
+		Ω(tree.Children[1].Mode).Should(HavePrefix("d"))
+		Ω(tree.Children[1].Children).Should(HaveLen(1))
+		Ω(tree.Children[1].Children[0].Inode).Should(Equal(b.Attrs.Inode))
+		Ω(tree.Children[1].Children[0].Dirty).Should(BeFalse())
+
+		// Flushed files are no longer dirty.
+		fs.Flush()
+		Ω(fs.Tree().Children[0].Dirty).Should(BeFalse())
+	})
+
+	It("should reject modifications in maintenance mode", func() {
+		a := createFile(root, "a.txt", 0644, []byte("hello"))
+		Ω(fs.Dirty()).Should(Equal(1))
+
+		Ω(fs.SetMaintenance(true)).Should(Equal(1))
+		Ω(fs.Maintenance()).Should(BeTrue())
+		Ω(fs.Dirty()).Should(BeZero())
+
+		eagain := fuse.Errno(syscall.EAGAIN)
+		wreq := &fuse.WriteRequest{Data: []byte("world")}
+		Ω(a.Write(ctx, wreq, new(fuse.WriteResponse))).Should(Equal(eagain))
+
+		_, _, err := root.Create(ctx, &fuse.CreateRequest{Name: "b.txt", Mode: 0644}, new(fuse.CreateResponse))
+		Ω(err).Should(Equal(eagain))
+
+		_, err = root.Mkdir(ctx, &fuse.MkdirRequest{Name: "sub", Mode: 0755})
+		Ω(err).Should(Equal(eagain))
+
+		Ω(root.Remove(ctx, &fuse.RemoveRequest{Name: "a.txt"})).Should(Equal(eagain))
+		Ω(root.Rename(ctx, &fuse.RenameRequest{OldName: "a.txt", NewName: "c.txt"}, root)).Should(Equal(eagain))
+
+		sreq := &fuse.SetattrRequest{Valid: fuse.SetattrSize, Size: 0}
+		Ω(a.Setattr(ctx, sreq, new(fuse.SetattrResponse))).Should(Equal(eagain))
+
+		// Reads are still served
+		rreq := &fuse.ReadRequest{Size: 5}
+		rresp := new(fuse.ReadResponse)
+		Ω(a.Read(ctx, rreq, rresp)).Should(Succeed())
+		Ω(rresp.Data).Should(Equal([]byte("hello")))
+
+		_, err = root.Lookup(ctx, "a.txt")
+		Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+
+		// Modifications resume when maintenance mode is left
+		Ω(fs.SetMaintenance(false)).Should(BeZero())
+		Ω(fs.Maintenance()).Should(BeFalse())
+		Ω(a.Write(ctx, wreq, new(fuse.WriteResponse))).Should(Succeed())
+		createFile(root, "b.txt", 0644, nil)
+	})
+
+	It("should enter maintenance mode across mounts", func() {
+		other := newFileSystem()
+		node, err := other.Root()
+		Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+
+		createFile(root, "a.txt", 0644, []byte("hello"))
+		createFile(node.(*Dir), "b.txt", 0644, []byte("world"))
+
+		table := &FuseFSTable{FuseFS: []*FileSystem{fs, other}}
+		Ω(table.SetMaintenance(true)).Should(Equal(2))
+		Ω(table.Maintenance()).Should(BeTrue())
+		Ω(fs.Maintenance()).Should(BeTrue())
+		Ω(other.Maintenance()).Should(BeTrue())
+
+		Ω(table.SetMaintenance(false)).Should(BeZero())
+		Ω(fs.Maintenance()).Should(BeFalse())
+		Ω(other.Maintenance()).Should(BeFalse())
+	})
+
+	It("should find a file system by prefix", func() {
+		table := &FuseFSTable{FuseFS: []*FileSystem{fs}}
+
+		fsc, err := table.Prefix("testing")
+		Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+		Ω(fsc).Should(BeIdenticalTo(fs))
+
+		_, err = table.Prefix("missing")
+		Ω(err).Should(MatchError("no mount point with prefix 'missing'"))
+	})
+
+})
+
+var _ = Describe("MountWithRetry", func() {
+
+	var conf *MountConfig
+	var calls int32 // Updated atomically since timed out mounts run in the background
+	var unmounted chan string
+
+	BeforeEach(func() {
+		atomic.StoreInt32(&calls, 0)
+		conf = &MountConfig{Retries: 3, Backoff: time.Millisecond, Timeout: 0}
+		unmounted = make(chan string, 4)
+	})
+
+	// Records the directories that are unmounted.
+	unmount := func(dir string) error {
+		unmounted <- dir
+		return nil
+	}
+
+	// Returns a mount function that fails the specified number of times.
+	failing := func(failures int) MountFunc {
+		return func(dir string, options ...fuse.MountOption) (*fuse.Conn, error) {
+			if atomic.AddInt32(&calls, 1) <= int32(failures) {
+				return nil, errors.New("transient mount failure")
+			}
+			return new(fuse.Conn), nil
+		}
+	}
+
+	It("should mount on the first attempt", func() {
+		conn, err := MountWithRetry(failing(0), unmount, "/mnt", nil, conf)
+		Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+		Ω(conn).ShouldNot(BeNil())
+		Ω(atomic.LoadInt32(&calls)).Should(BeEquivalentTo(1))
+	})
+
+	It("should retry until the mount succeeds", func() {
+		conn, err := MountWithRetry(failing(2), unmount, "/mnt", nil, conf)
+		Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+		Ω(conn).ShouldNot(BeNil())
+		Ω(atomic.LoadInt32(&calls)).Should(BeEquivalentTo(3))
+	})
+
+	It("should give up after the configured number of retries", func() {
+		conn, err := MountWithRetry(failing(10), unmount, "/mnt", nil, conf)
+		Ω(err).Should(MatchError("transient mount failure"))
+		Ω(conn).Should(BeNil())
+		Ω(atomic.LoadInt32(&calls)).Should(BeEquivalentTo(4))
+	})
+
+	It("should not retry if retries are disabled", func() {
+		conf.Retries = 0
+		_, err := MountWithRetry(failing(1), unmount, "/mnt", nil, conf)
+		Ω(err).Should(HaveOccurred())
+		Ω(atomic.LoadInt32(&calls)).Should(BeEquivalentTo(1))
+	})
+
+	It("should time out a mount that does not complete", func() {
+		conf.Retries = 1
+		conf.Timeout = 10 * time.Millisecond
+
+		done := make(chan struct{})
+		defer close(done)
+
+		hanging := func(dir string, options ...fuse.MountOption) (*fuse.Conn, error) {
+			if atomic.AddInt32(&calls, 1) == 1 {
+				<-done
+				return nil, errors.New("too late")
+			}
+			return new(fuse.Conn), nil
+		}
+
+		conn, err := MountWithRetry(hanging, unmount, "/mnt", nil, conf)
+		Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+		Ω(conn).ShouldNot(BeNil())
+		Ω(atomic.LoadInt32(&calls)).Should(BeEquivalentTo(2))
+		Consistently(unmounted).ShouldNot(Receive())
+	})
+
+	It("should unmount a mount that completes after it timed out", func() {
+		conf.Retries = 1
+		conf.Timeout = 10 * time.Millisecond
+
+		late := make(chan struct{})
+		hanging := func(dir string, options ...fuse.MountOption) (*fuse.Conn, error) {
+			if atomic.AddInt32(&calls, 1) == 1 {
+				<-late
+			}
+			return new(fuse.Conn), nil
+		}
+
+		conn, err := MountWithRetry(hanging, unmount, "/mnt", nil, conf)
+		Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+		Ω(conn).ShouldNot(BeNil())
+		Ω(unmounted).ShouldNot(Receive())
+
+		// The first attempt completes after the timeout
+		close(late)
+		Eventually(unmounted).Should(Receive(Equal("/mnt")))
+	})
+
+})
+
+var _ = Describe("UnmountStale", func() {
+
+	var unmounted []string
+
+	BeforeEach(func() {
+		unmounted = make([]string, 0)
+	})
+
+	// Records the directories that are unmounted.
+	unmount := func(dir string) error {
+		unmounted = append(unmounted, dir)
+		return nil
+	}
+
+	// Looks up the mount in a fixed mount table.
+	lookup := func(info *MountInfo, err error) MountLookupFunc {
+		return func(dir string) (*MountInfo, error) {
+			return info, err
+		}
+	}
+
+	It("should parse the mount table formats", func() {
+		table := strings.Join([]string{
+			"proc /proc proc rw,relatime 0 0",
+			`fluidfs /data/my\040mnt fuse.fluidfs rw,nosuid,nodev 0 0`,
+			"fluidfs on /Volumes/fluid (osxfuse, local, synchronous)",
+			"/dev/disk1s1 on / (apfs, local, journaled)",
+			"garbage",
+		}, "\n")
+
+		mounts, err := ParseMountTable(strings.NewReader(table))
+		Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+		Ω(mounts).Should(Equal([]*MountInfo{
+			{Source: "proc", Path: "/proc", FSType: "proc"},
+			{Source: "fluidfs", Path: "/data/my mnt", FSType: "fuse.fluidfs"},
+			{Source: "fluidfs", Path: "/Volumes/fluid", FSType: "osxfuse"},
+			{Source: "/dev/disk1s1", Path: "/", FSType: "apfs"},
+		}))
+
+		Ω(mounts[0].IsFluidFS()).Should(BeFalse())
+		Ω(mounts[1].IsFluidFS()).Should(BeTrue())
+		Ω(mounts[2].IsFluidFS()).Should(BeTrue())
+	})
+
+	It("should not unmount if nothing is mounted", func() {
+		Ω(UnmountStale("/data/mnt", lookup(nil, nil), unmount)).Should(Succeed())
+		Ω(unmounted).Should(BeEmpty())
+	})
+
+	It("should unmount a stale fluidfs mount", func() {
+		info := &MountInfo{Source: "fluidfs", Path: "/data/mnt", FSType: "fuse.fluidfs", Stale: true}
+		Ω(UnmountStale("/data/mnt", lookup(info, nil), unmount)).Should(Succeed())
+		Ω(unmounted).Should(Equal([]string{"/data/mnt"}))
+	})
+
+	It("should refuse to unmount a fluidfs mount that is being served", func() {
+		info := &MountInfo{Source: "fluidfs", Path: "/data/mnt", FSType: "fuse.fluidfs"}
+		err := UnmountStale("/data/mnt", lookup(info, nil), unmount)
+		Ω(err).Should(MatchError("/data/mnt is busy: fluidfs is already mounted and served there"))
+		Ω(unmounted).Should(BeEmpty())
+	})
+
+	It("should refuse to unmount another file system", func() {
+		info := &MountInfo{Source: "/dev/sdb1", Path: "/data/mnt", FSType: "ext4"}
+		err := UnmountStale("/data/mnt", lookup(info, nil), unmount)
+		Ω(err).Should(MatchError("/data/mnt is busy: /dev/sdb1 (ext4) is already mounted there"))
+		Ω(unmounted).Should(BeEmpty())
+	})
+
+	It("should not unmount if the mount table cannot be read", func() {
+		err := UnmountStale("/data/mnt", lookup(nil, errors.New("permission denied")), unmount)
+		Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+		Ω(unmounted).Should(BeEmpty())
+	})
+
+	It("should report an error if the stale mount cannot be unmounted", func() {
+		info := &MountInfo{Source: "fluidfs", Path: "/data/mnt", FSType: "fuse.fluidfs", Stale: true}
+		err := UnmountStale("/data/mnt", lookup(info, nil), func(dir string) error {
+			return errors.New("device busy")
+		})
+		Ω(err).Should(MatchError("could not unmount stale fluidfs mount on /data/mnt: device busy"))
+	})
+
+	It("should find the file system mounted on a directory", func() {
+		if _, err := os.Stat(MountTablePath); err != nil {
+			Skip("no mount table on this system")
+		}
+
+		info, err := MountedAt("/proc/")
+		Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+		Ω(info).ShouldNot(BeNil())
+		Ω(info.FSType).Should(Equal("proc"))
+		Ω(info.Stale).Should(BeFalse())
+
+		tmpDir, err := ioutil.TempDir("", "fluid-mounts")
+		Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+		defer os.RemoveAll(tmpDir)
+
+		info, err = MountedAt(tmpDir)
+		Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+		Ω(info).Should(BeNil())
+	})
+
+})
@@ -0,0 +1,255 @@
+// Mechanisms for importing a local directory tree into a file system.
+
+package fluid
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+//===========================================================================
+// Directory Tree Import
+//===========================================================================
+
+// ImportReport describes the result of importing a local directory tree.
+type ImportReport struct {
+	Dirs    int    // The number of directories created
+	Files   int    // The number of files created or updated
+	Skipped int    // The number of unchanged files that were not imported
+	Ignored int    // The number of symlinks and special files that were ignored
+	Blobs   int    // The number of blobs the imported files were chunked into
+	Bytes   uint64 // The number of bytes of file data imported
+}
+
+// String returns a pretty representation of the import.
+func (r *ImportReport) String() string {
+	return fmt.Sprintf(
+		"imported %d files (%d bytes in %d blobs) and %d directories, skipped %d unchanged files and ignored %d special files",
+		r.Files, r.Bytes, r.Blobs, r.Dirs, r.Skipped, r.Ignored,
+	)
+}
+
+// ImportTree walks the local directory at src, creating its directories and
+// files in the root of the file system and preserving their permissions and
+// modification times. A file that already exists is only updated if its data
+// differs from that of the local file, so an import can be run again to pick
+// up changes; the blobs of each updated file are counted with the storage
+// configuration. Symlinks and other special files are ignored.
+//
+// Local files are read and counted without holding the fs lock, which is only
+// held to insert each directory and file, so the file system continues to
+// serve requests during a long import. The source cannot be inside of the
+// mount point, and the mount point is skipped if it is inside of the source.
+func (fs *FileSystem) ImportTree(src string) (*ImportReport, error) {
+	info, err := os.Stat(src)
+	if err != nil {
+		return nil, fmt.Errorf("could not import %s: %s", src, err.Error())
+	}
+
+	if !info.IsDir() {
+		return nil, fmt.Errorf("could not import %s: not a directory", src)
+	}
+
+	if fs.readonly {
+		return nil, fmt.Errorf("could not import %s: fluidfs://%s is read only", src, fs.mount.Prefix)
+	}
+
+	// Reading the mount point would import the file system into itself.
+	root := resolvePath(src)
+	mount := resolvePath(fs.mount.Path)
+	if pathWithin(mount, root) {
+		return nil, fmt.Errorf("could not import %s: it is in fluidfs://%s", src, fs.mount.Prefix)
+	}
+
+	if fs.Maintenance() {
+		return nil, fmt.Errorf("could not import %s: fluidfs://%s is in maintenance mode", src, fs.mount.Prefix)
+	}
+
+	report := new(ImportReport)
+	dirs := map[string]*Dir{".": fs.root}
+
+	err = filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+
+		// The root of the source is the root of the file system
+		if rel == "." {
+			return nil
+		}
+
+		parent, ok := dirs[filepath.Dir(rel)]
+		if !ok {
+			return fmt.Errorf("%s: parent directory was not imported", rel)
+		}
+
+		switch {
+		case info.IsDir() && path == mount:
+			logger.Debug("ignoring %s, the mount point of fluidfs://%s", path, fs.mount.Prefix)
+			report.Ignored++
+			return filepath.SkipDir
+		case info.IsDir():
+			var dir *Dir
+			err := fs.importLocked(func() (err error) {
+				dir, err = fs.importDir(parent, info, report)
+				return err
+			})
+			if err != nil {
+				return fmt.Errorf("%s: %s", rel, err.Error())
+			}
+			dirs[rel] = dir
+		case info.Mode().IsRegular():
+			data, err := ioutil.ReadFile(path)
+			if err != nil {
+				return fmt.Errorf("%s: %s", rel, err.Error())
+			}
+
+			// Only chunk the data if the file has changed since the last import
+			var unchanged bool
+			err = fs.importLocked(func() error {
+				unchanged = fs.importUnchanged(parent, info, data)
+				return nil
+			})
+			if err != nil {
+				return fmt.Errorf("%s: %s", rel, err.Error())
+			}
+
+			if unchanged {
+				report.Skipped++
+				return nil
+			}
+
+			blobs, err := countBlobs(data, config.Storage)
+			if err != nil {
+				return fmt.Errorf("%s: %s", rel, err.Error())
+			}
+
+			err = fs.importLocked(func() error {
+				return fs.importFile(parent, info, data, blobs, report)
+			})
+			if err != nil {
+				return fmt.Errorf("%s: %s", rel, err.Error())
+			}
+		default:
+			logger.Debug("ignoring %s with mode %s", path, info.Mode())
+			report.Ignored++
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return report, fmt.Errorf("could not import %s: %s", src, err.Error())
+	}
+
+	logger.Info("%s from %s into fluidfs://%s", report, src, fs.mount.Prefix)
+	return report, nil
+}
+
+// Run the import of a single entity with the file system locked, returning an
+// error if the file system was put into maintenance mode during the import.
+func (fs *FileSystem) importLocked(insert func() error) error {
+	fs.Lock()
+	defer fs.Unlock()
+
+	if fs.quiesced {
+		return fmt.Errorf("fluidfs://%s is in maintenance mode", fs.mount.Prefix)
+	}
+	return insert()
+}
+
+// Find or create the directory described by info in the parent. Must be
+// called with the file system locked.
+func (fs *FileSystem) importDir(parent *Dir, info os.FileInfo, report *ImportReport) (*Dir, error) {
+	if _, ent, ok := parent.entry(info.Name()); ok {
+		dir, ok := ent.(*Dir)
+		if !ok {
+			return nil, fmt.Errorf("exists and is not a directory")
+		}
+		return dir, nil
+	}
+
+	dir := new(Dir)
+	if err := dir.Init(info.Name(), info.Mode().Perm(), parent, fs); err != nil {
+		return nil, err
+	}
+	dir.Attrs.Mtime = info.ModTime()
+
+	parent.insert(dir.Name, dir)
+	fs.ndirs++
+	fs.publish(EventMkdir, dir.Path(), "")
+	report.Dirs++
+	return dir, nil
+}
+
+// Returns true if a file described by info exists in the parent and has the
+// same data, and so would be chunked into the same blobs. Must be called with
+// the file system locked.
+func (fs *FileSystem) importUnchanged(parent *Dir, info os.FileInfo, data []byte) bool {
+	if _, ent, ok := parent.entry(info.Name()); ok {
+		if file, ok := ent.(*File); ok {
+			return bytes.Equal(file.Data, data)
+		}
+	}
+	return false
+}
+
+// Create or update the file in the parent with the data read from the local
+// file described by info, unless the existing file has the same data, which
+// may happen if the file was changed after it was compared. Must be called
+// with the file system locked.
+func (fs *FileSystem) importFile(parent *Dir, info os.FileInfo, data []byte, blobs int, report *ImportReport) error {
+	var file *File
+	if _, ent, ok := parent.entry(info.Name()); ok {
+		if file, ok = ent.(*File); !ok {
+			return fmt.Errorf("exists and is not a file")
+		}
+
+		if bytes.Equal(file.Data, data) {
+			report.Skipped++
+			return nil
+		}
+	} else {
+		file = new(File)
+		if err := file.Init(info.Name(), info.Mode().Perm(), parent, fs); err != nil {
+			return err
+		}
+		parent.insert(file.Name, file)
+		fs.nfiles++
+		fs.publish(EventCreate, file.Path(), "")
+	}
+
+	// Replace the data of the file, which is clean since it matches the source
+	file.replace(data)
+	file.Attrs.Mode = info.Mode().Perm()
+	file.Attrs.Mtime = info.ModTime()
+	file.dirty = false
+	fs.publish(EventWrite, file.Path(), "")
+
+	report.Files++
+	report.Blobs += blobs
+	report.Bytes += uint64(len(data))
+	return nil
+}
+
+// Returns the number of blobs the data is chunked into without hashing them.
+func countBlobs(data []byte, conf *StorageConfig) (int, error) {
+	if len(data) == 0 {
+		return 0, nil
+	}
+
+	chunker, err := NewChunker(data, conf)
+	if err != nil {
+		return 0, err
+	}
+
+	return chunker.Count(), nil
+}
@@ -0,0 +1,168 @@
+package fluid_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	. "github.com/bbengfort/fluidfs/fluid"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Import", func() {
+
+	var fs *FileSystem
+	var root *Dir
+	var src string
+	var mtime time.Time
+
+	// The fixture tree of files and their contents.
+	fixture := map[string]string{
+		"a.txt":               "the quick brown fox",
+		"empty.txt":           "",
+		"docs/b.txt":          randString(8192),
+		"docs/notes/c.txt":    "jumped over the lazy dog",
+		"docs/notes/deep.txt": randString(100),
+		"src/main.go":         "package main",
+	}
+
+	BeforeEach(func() {
+		var err error
+		src, err = ioutil.TempDir("", "fluid-import")
+		Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+
+		mtime = time.Date(2017, 4, 1, 12, 0, 0, 0, time.UTC)
+		for name, data := range fixture {
+			path := filepath.Join(src, name)
+			Ω(os.MkdirAll(filepath.Dir(path), 0750)).Should(Succeed())
+			Ω(ioutil.WriteFile(path, []byte(data), 0640)).Should(Succeed())
+			Ω(os.Chtimes(path, mtime, mtime)).Should(Succeed())
+		}
+
+		Ω(os.Mkdir(filepath.Join(src, "empty"), 0700)).Should(Succeed())
+		Ω(os.Chmod(filepath.Join(src, "src", "main.go"), 0755)).Should(Succeed())
+
+		fs = newFileSystem()
+		node, err := fs.Root()
+		Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+		root = node.(*Dir)
+	})
+
+	AfterEach(func() {
+		Ω(os.RemoveAll(src)).Should(Succeed())
+	})
+
+	// Find the entity at the slash separated path from the root.
+	find := func(path string) Entity {
+		var ent Entity = root
+		for _, name := range strings.Split(path, "/") {
+			dir, ok := ent.(*Dir)
+			Ω(ok).Should(BeTrue(), "%s is not a directory", path)
+
+			ent, ok = dir.Children[name]
+			Ω(ok).Should(BeTrue(), "%s was not imported", path)
+		}
+		return ent
+	}
+
+	It("should mirror the directory tree", func() {
+		report, err := fs.ImportTree(src)
+		Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+
+		Ω(report.Files).Should(Equal(len(fixture)))
+		Ω(report.Dirs).Should(Equal(4))
+		Ω(report.Skipped).Should(BeZero())
+		Ω(report.Blobs).Should(BeNumerically(">=", len(fixture)-1))
+
+		nbytes := uint64(0)
+		for name, data := range fixture {
+			file, ok := find(name).(*File)
+			Ω(ok).Should(BeTrue(), "%s is not a file", name)
+			Ω(string(file.Data)).Should(Equal(data))
+			Ω(file.Consistent()).Should(Succeed())
+			Ω(file.Attrs.Mtime.Equal(mtime)).Should(BeTrue(), "%s mtime is %s", name, file.Attrs.Mtime)
+			nbytes += uint64(len(data))
+		}
+		Ω(report.Bytes).Should(Equal(nbytes))
+
+		Ω(find("a.txt").GetNode().Attrs.Mode).Should(Equal(os.FileMode(0640)))
+		Ω(find("src/main.go").GetNode().Attrs.Mode).Should(Equal(os.FileMode(0755)))
+		Ω(find("docs/notes").GetNode().Attrs.Mode).Should(Equal(os.ModeDir | 0750))
+		Ω(find("empty").GetNode().Attrs.Mode).Should(Equal(os.ModeDir | 0700))
+		Ω(find("empty").(*Dir).Children).Should(BeEmpty())
+		Ω(fs.Dirty()).Should(BeZero())
+	})
+
+	It("should skip unchanged files when imported again", func() {
+		_, err := fs.ImportTree(src)
+		Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+
+		Ω(ioutil.WriteFile(filepath.Join(src, "a.txt"), []byte("a slow green turtle"), 0640)).Should(Succeed())
+		Ω(ioutil.WriteFile(filepath.Join(src, "docs", "new.txt"), []byte("new"), 0640)).Should(Succeed())
+
+		report, err := fs.ImportTree(src)
+		Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+		Ω(report.Files).Should(Equal(2))
+		Ω(report.Dirs).Should(BeZero())
+		Ω(report.Skipped).Should(Equal(len(fixture) - 1))
+
+		Ω(string(find("a.txt").(*File).Data)).Should(Equal("a slow green turtle"))
+		Ω(string(find("docs/new.txt").(*File).Data)).Should(Equal("new"))
+	})
+
+	It("should ignore symlinks", func() {
+		Ω(os.Symlink(filepath.Join(src, "a.txt"), filepath.Join(src, "link.txt"))).Should(Succeed())
+
+		report, err := fs.ImportTree(src)
+		Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+		Ω(report.Ignored).Should(Equal(1))
+		Ω(root.Children).ShouldNot(HaveKey("link.txt"))
+	})
+
+	It("should not replace a directory with a file", func() {
+		Ω(os.RemoveAll(filepath.Join(src, "docs"))).Should(Succeed())
+		Ω(ioutil.WriteFile(filepath.Join(src, "docs"), []byte("docs"), 0640)).Should(Succeed())
+
+		other, err := ioutil.TempDir("", "fluid-import")
+		Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+		defer os.RemoveAll(other)
+		Ω(os.Mkdir(filepath.Join(other, "docs"), 0750)).Should(Succeed())
+
+		_, err = fs.ImportTree(other)
+		Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+
+		_, err = fs.ImportTree(src)
+		Ω(err).Should(MatchError(ContainSubstring("docs: exists and is not a file")))
+	})
+
+	It("should not import the mount point into itself", func() {
+		mnt := filepath.Join(suiteDir, "mnt", "docs")
+		Ω(os.MkdirAll(mnt, 0755)).Should(Succeed())
+		defer os.RemoveAll(filepath.Join(suiteDir, "mnt"))
+
+		_, err := fs.ImportTree(mnt)
+		Ω(err).Should(MatchError(ContainSubstring("it is in fluidfs://testing")))
+		Ω(root.Children).Should(BeEmpty())
+	})
+
+	It("should not import while in maintenance mode", func() {
+		fs.SetMaintenance(true)
+		_, err := fs.ImportTree(src)
+		Ω(err).Should(MatchError(ContainSubstring("is in maintenance mode")))
+		Ω(root.Children).Should(BeEmpty())
+	})
+
+	It("should require a source directory", func() {
+		_, err := fs.ImportTree(filepath.Join(src, "missing"))
+		Ω(err).Should(HaveOccurred())
+
+		_, err = fs.ImportTree(filepath.Join(src, "a.txt"))
+		Ω(err).Should(MatchError(ContainSubstring("not a directory")))
+	})
+
+})
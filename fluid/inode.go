@@ -0,0 +1,108 @@
+// Allocates inode numbers that are unique across mount points and restarts.
+
+package fluid
+
+import (
+	"encoding/binary"
+	"sync"
+
+	"github.com/bbengfort/sequence"
+
+	kvdb "github.com/bbengfort/fluidfs/fluid/db"
+)
+
+// Database location of the persisted inode sequence.
+const (
+	SequencesBucket = "sequences"
+	inodesKey       = "inodes"
+)
+
+// InodeReserveBlock is the number of inode numbers reserved in the database
+// at a time, so that the database is only written once per block.
+const InodeReserveBlock = 1024
+
+// The inode sequence shared by all of the file systems in the process.
+var inodes *InodeSequence
+
+//===========================================================================
+// Inode Sequence
+//===========================================================================
+
+// InodeSequence is a concurrency safe sequence of inode numbers that is
+// shared by every mount point so that inodes are unique in the global
+// namespace. Rather than writing every number to the database, blocks of
+// numbers are reserved by persisting a high water mark; after a restart the
+// sequence resumes above the mark, so numbers are monotonic and never reused
+// even if the replica crashes, though numbers in the last block may be
+// skipped. If no database is given the sequence is held in memory.
+type InodeSequence struct {
+	sync.Mutex
+	seq      *sequence.Sequence // The in-memory sequence of inode numbers
+	db       kvdb.Database      // Database to persist reservations, may be nil
+	reserved uint64             // The highest number reserved in the database
+}
+
+// NewInodeSequence creates an inode sequence, resuming above the high water
+// mark in the database if one has been persisted.
+func NewInodeSequence(store kvdb.Database) (*InodeSequence, error) {
+	s := &InodeSequence{db: store}
+	if store == nil {
+		s.seq, _ = sequence.New()
+		return s, nil
+	}
+
+	if err := store.CreateBucket(SequencesBucket); err != nil {
+		return nil, WrapError(ErrDatabase, err, "could not create the %s bucket", SequencesBucket)
+	}
+
+	val, err := store.Get([]byte(inodesKey), SequencesBucket)
+	if err != nil {
+		return nil, WrapError(ErrDatabase, err, "could not load the inode sequence")
+	}
+
+	switch len(val) {
+	case 0:
+		s.seq, _ = sequence.New()
+	case 8:
+		s.reserved = binary.BigEndian.Uint64(val)
+		if s.seq, err = sequence.New(s.reserved+1, sequence.MaximumBound); err != nil {
+			return nil, WrapError(ErrDatabase, err, "could not resume the inode sequence")
+		}
+	default:
+		return nil, NewError(ErrDatabase, "could not load the inode sequence: %d bytes is not a uint64", len(val))
+	}
+
+	return s, nil
+}
+
+// Next returns the next inode number, reserving another block of numbers in
+// the database if the current block has been used up.
+func (s *InodeSequence) Next() (uint64, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	id, err := s.seq.Next()
+	if err != nil {
+		return 0, err
+	}
+
+	if s.db != nil && id > s.reserved {
+		reserved := id + InodeReserveBlock - 1
+		val := make([]byte, 8)
+		binary.BigEndian.PutUint64(val, reserved)
+
+		if err := s.db.Put([]byte(inodesKey), val, SequencesBucket); err != nil {
+			return 0, WrapError(ErrDatabase, err, "could not reserve inodes")
+		}
+		s.reserved = reserved
+	}
+
+	return id, nil
+}
+
+// Reserved returns the high water mark persisted in the database.
+func (s *InodeSequence) Reserved() uint64 {
+	s.Lock()
+	defer s.Unlock()
+	return s.reserved
+}
@@ -0,0 +1,163 @@
+package fluid_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"bazil.org/fuse"
+	"golang.org/x/net/context"
+
+	. "github.com/bbengfort/fluidfs/fluid"
+	kvdb "github.com/bbengfort/fluidfs/fluid/db"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("InodeSequence", func() {
+
+	It("should not allocate colliding inodes across mounts", func() {
+		ctx := context.Background()
+		seen := make(map[uint64]string)
+
+		for _, prefix := range []string{"alpha", "bravo"} {
+			fs := newFileSystem()
+			node, err := fs.Root()
+			Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+			root := node.(*Dir)
+
+			for i := 0; i < 10; i++ {
+				name := fmt.Sprintf("file%d.txt", i)
+				req := &fuse.CreateRequest{Name: name, Mode: 0644}
+				_, _, err := root.Create(ctx, req, new(fuse.CreateResponse))
+				Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+			}
+
+			Ω(fs.Traverse(func(ent Entity) error {
+				path := prefix + ":" + ent.Path()
+				inode := ent.GetNode().Attrs.Inode
+				Ω(seen).ShouldNot(HaveKey(inode), "%s collides with %s", path, seen[inode])
+				seen[inode] = path
+				return nil
+			})).Should(Succeed())
+		}
+
+		Ω(seen).Should(HaveLen(22))
+	})
+
+	It("should allocate unique inodes concurrently", func() {
+		seq, err := NewInodeSequence(nil)
+		Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+
+		var wg sync.WaitGroup
+		ids := make(chan uint64, 400)
+		for i := 0; i < 4; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for j := 0; j < 100; j++ {
+					id, err := seq.Next()
+					Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+					ids <- id
+				}
+			}()
+		}
+
+		wg.Wait()
+		close(ids)
+
+		seen := make(map[uint64]bool)
+		for id := range ids {
+			Ω(seen).ShouldNot(HaveKey(id))
+			seen[id] = true
+		}
+		Ω(seen).Should(HaveLen(400))
+	})
+
+	Describe("persistence", func() {
+
+		var tmpDir string
+		var conf *DatabaseConfig
+
+		BeforeEach(func() {
+			var err error
+			tmpDir, err = ioutil.TempDir("", "fluid-inodes")
+			Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+
+			conf = new(DatabaseConfig)
+			conf.Defaults()
+			conf.Path = filepath.Join(tmpDir, "test.db")
+		})
+
+		AfterEach(func() {
+			Ω(os.RemoveAll(tmpDir)).Should(Succeed())
+		})
+
+		// Open the database, allocate n inodes and close the database,
+		// returning the last inode allocated.
+		allocate := func(n int) uint64 {
+			store, err := kvdb.InitDatabase(conf)
+			Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+			defer store.Close()
+
+			seq, err := NewInodeSequence(store)
+			Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+
+			var id uint64
+			for i := 0; i < n; i++ {
+				id, err = seq.Next()
+				Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+			}
+
+			Ω(seq.Reserved()).Should(BeNumerically(">=", id))
+			return id
+		}
+
+		for _, driver := range kvdb.DriverNames {
+			driver := driver
+
+			It(fmt.Sprintf("should resume above allocated inodes with %s", driver), func() {
+				conf.Driver = driver
+
+				first := allocate(10)
+				Ω(first).Should(Equal(uint64(10)))
+
+				second := allocate(InodeReserveBlock + 10)
+				Ω(second).Should(BeNumerically(">", first))
+
+				third := allocate(1)
+				Ω(third).Should(BeNumerically(">", second))
+			})
+		}
+
+		It("should not create nodes if inodes cannot be reserved", func() {
+			store, err := kvdb.InitDatabase(conf)
+			Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+
+			seq, err := NewInodeSequence(store)
+			Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+			Ω(store.Close()).Should(Succeed())
+
+			fs := newFileSystem()
+			fs.Sequence = seq
+
+			node, err := fs.Root()
+			Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+			root := node.(*Dir)
+			ctx := context.Background()
+
+			_, _, err = root.Create(ctx, &fuse.CreateRequest{Name: "a.txt", Mode: 0644}, new(fuse.CreateResponse))
+			Ω(err).Should(Equal(fuse.EIO))
+
+			_, err = root.Mkdir(ctx, &fuse.MkdirRequest{Name: "docs", Mode: 0755})
+			Ω(err).Should(Equal(fuse.EIO))
+
+			Ω(root.Children).Should(BeEmpty())
+		})
+
+	})
+
+})
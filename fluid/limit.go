@@ -0,0 +1,86 @@
+// Limits the number of concurrent FUSE requests served by the replica.
+
+package fluid
+
+import (
+	"sync/atomic"
+)
+
+// The request limiter shared by all of the file systems in the process.
+var limiter *RequestLimiter
+
+//===========================================================================
+// Request Limiter
+//===========================================================================
+
+// RequestLimiter is a semaphore that bounds the number of FUSE requests that
+// are handled concurrently, providing backpressure under heavy load so that
+// the daemon and its database are not overwhelmed. Requests over the limit
+// are queued until an in-flight request completes. The limiter is shared by
+// every mount point so that the bound applies to the whole replica.
+//
+// The node handlers acquire the limiter and release it when they return,
+// rather than when the request context is done, since the context is also
+// cancelled when the kernel interrupts a request that is still being handled.
+// Interrupts are answered by the fuse server without calling a handler, so
+// they are never queued behind the requests that they interrupt.
+type RequestLimiter struct {
+	sem      chan struct{} // Holds a token for every in-flight request
+	inflight int64         // The number of requests being handled
+	queued   int64         // The number of requests waiting for a token
+}
+
+// NewRequestLimiter creates a limiter that allows at most limit concurrent
+// requests. If the limit is zero then the number of requests is unbounded.
+func NewRequestLimiter(limit int) *RequestLimiter {
+	l := new(RequestLimiter)
+	if limit > 0 {
+		l.sem = make(chan struct{}, limit)
+	}
+	return l
+}
+
+// Acquire blocks until the request can be handled.
+func (l *RequestLimiter) Acquire() {
+	if l.sem != nil {
+		atomic.AddInt64(&l.queued, 1)
+		l.sem <- struct{}{}
+		atomic.AddInt64(&l.queued, -1)
+	}
+	atomic.AddInt64(&l.inflight, 1)
+}
+
+// Release marks a request acquired with Acquire as complete.
+func (l *RequestLimiter) Release() {
+	atomic.AddInt64(&l.inflight, -1)
+	if l.sem != nil {
+		<-l.sem
+	}
+}
+
+// Limit returns the maximum number of concurrent requests, 0 if unbounded.
+func (l *RequestLimiter) Limit() int {
+	return cap(l.sem)
+}
+
+// InFlight returns the number of requests currently being handled.
+func (l *RequestLimiter) InFlight() int {
+	return int(atomic.LoadInt64(&l.inflight))
+}
+
+// Queued returns the number of requests waiting to be handled.
+func (l *RequestLimiter) Queued() int {
+	return int(atomic.LoadInt64(&l.queued))
+}
+
+// Blocks until a FUSE request can be handled, returning the function that
+// releases the request. Node handlers defer the release so that the request
+// is held until the handler returns: defer n.fs.acquire()()
+func (fs *FileSystem) acquire() func() {
+	if fs == nil || fs.Limiter == nil {
+		return func() {}
+	}
+
+	fs.Limiter.Acquire()
+	return fs.Limiter.Release
+}
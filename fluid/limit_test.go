@@ -0,0 +1,132 @@
+package fluid_test
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"bazil.org/fuse"
+	"golang.org/x/net/context"
+
+	. "github.com/bbengfort/fluidfs/fluid"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("RequestLimiter", func() {
+
+	// Serve n concurrent requests through the limiter, returning the maximum
+	// number of requests that were handled at the same time.
+	serve := func(limiter *RequestLimiter, n int) int64 {
+		var wg sync.WaitGroup
+		var active, peak int64
+
+		for i := 0; i < n; i++ {
+			wg.Add(1)
+			go func() {
+				defer GinkgoRecover()
+				defer wg.Done()
+
+				limiter.Acquire()
+				defer limiter.Release()
+				current := atomic.AddInt64(&active, 1)
+				for {
+					max := atomic.LoadInt64(&peak)
+					if current <= max || atomic.CompareAndSwapInt64(&peak, max, current) {
+						break
+					}
+				}
+
+				Ω(limiter.InFlight()).Should(BeNumerically("<=", limiter.Limit()))
+				time.Sleep(time.Millisecond)
+				atomic.AddInt64(&active, -1)
+			}()
+		}
+
+		wg.Wait()
+		return peak
+	}
+
+	It("should never exceed the limit of in-flight requests", func() {
+		limiter := NewRequestLimiter(4)
+		Ω(limiter.Limit()).Should(Equal(4))
+
+		peak := serve(limiter, 200)
+		Ω(peak).Should(BeNumerically("<=", 4))
+		Ω(peak).Should(BeNumerically(">", 0))
+
+		Eventually(limiter.InFlight).Should(BeZero())
+		Ω(limiter.Queued()).Should(BeZero())
+	})
+
+	It("should queue requests over the limit", func() {
+		limiter := NewRequestLimiter(1)
+		limiter.Acquire()
+
+		done := make(chan struct{})
+		go func() {
+			limiter.Acquire()
+			close(done)
+		}()
+
+		Eventually(limiter.Queued).Should(Equal(1))
+		Consistently(done).ShouldNot(BeClosed())
+		Ω(limiter.InFlight()).Should(Equal(1))
+
+		limiter.Release()
+		Eventually(done).Should(BeClosed())
+		Ω(limiter.Queued()).Should(BeZero())
+		Ω(limiter.InFlight()).Should(Equal(1))
+
+		limiter.Release()
+		Ω(limiter.InFlight()).Should(BeZero())
+	})
+
+	It("should not limit requests if the limit is zero", func() {
+		limiter := NewRequestLimiter(0)
+		Ω(limiter.Limit()).Should(BeZero())
+
+		for i := 0; i < 100; i++ {
+			limiter.Acquire()
+		}
+		Ω(limiter.InFlight()).Should(Equal(100))
+		Ω(limiter.Queued()).Should(BeZero())
+	})
+
+	It("should hold a request until the handler returns", func() {
+		fs := newFileSystem()
+		fs.Limiter = NewRequestLimiter(1)
+		node, err := fs.Root()
+		Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+		root := node.(*Dir)
+
+		// An interrupted request must still wait for the in-flight request
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		fs.Limiter.Acquire()
+		done := make(chan error, 1)
+		go func() {
+			_, err := root.Mkdir(ctx, &fuse.MkdirRequest{Name: "docs", Mode: 0755})
+			done <- err
+		}()
+
+		Eventually(fs.Limiter.Queued).Should(Equal(1))
+		Consistently(done).ShouldNot(Receive())
+
+		fs.Limiter.Release()
+		Eventually(done).Should(Receive(BeNil()))
+		Ω(fs.Limiter.InFlight()).Should(BeZero())
+		Ω(fs.Limiter.Queued()).Should(BeZero())
+	})
+
+	It("should share the limiter between file systems", func() {
+		alpha := newFileSystem()
+		bravo := newFileSystem()
+		Ω(alpha.Limiter).ShouldNot(BeNil())
+		Ω(alpha.Limiter).Should(BeIdenticalTo(bravo.Limiter))
+	})
+
+})
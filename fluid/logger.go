@@ -10,6 +10,8 @@ import (
 	"os"
 	"strings"
 	"time"
+
+	"github.com/google/uuid"
 )
 
 //===========================================================================
@@ -171,19 +173,28 @@ func (logger *Logger) Fatal(msg string, args ...interface{}) {
 // HTTP logging handler for the C2S API and web interface
 //===========================================================================
 
-// :method :url :status :response-time ms - :res[content-length]
-const webLogFmt = "c2s %s %s %d %s - %d"
+// :method :url :status :response-time ms - :res[content-length] :req[x-request-id]
+const webLogFmt = "c2s %s %s %d %s - %d (request %s)"
 
 // WebLogger is a decorator for http handlers to record HTTP requests using
 // the logger API and syntax, which must be passed in as the first argument.
+// The request ID header is echoed in the response and logged so requests can
+// be correlated; if the client did not send one, a new ID is generated.
 func WebLogger(log *Logger, inner http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now()
 
+		rid := r.Header.Get(HeaderRequestIDKey)
+		if rid == "" {
+			rid = uuid.New().String()
+			r.Header.Set(HeaderRequestIDKey, rid)
+		}
+		w.Header().Set(HeaderRequestIDKey, rid)
+
 		lw := &responseLogger{w: w}
 		inner.ServeHTTP(lw, r)
 
-		log.Info(webLogFmt, r.Method, r.RequestURI, lw.Status(), time.Since(start), lw.Size())
+		log.Info(webLogFmt, r.Method, r.RequestURI, lw.Status(), time.Since(start), lw.Size(), rid)
 
 	})
 }
@@ -229,3 +240,9 @@ func (l *responseLogger) Flush() {
 		f.Flush()
 	}
 }
+
+// Unwrap returns the wrapped writer so that an http.ResponseController can
+// set the deadlines of the connection.
+func (l *responseLogger) Unwrap() http.ResponseWriter {
+	return l.w
+}
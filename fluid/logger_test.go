@@ -5,8 +5,13 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 
 	. "github.com/bbengfort/fluidfs/fluid"
@@ -186,4 +191,84 @@ var _ = Describe("Logger", func() {
 
 	})
 
+	Describe("web logging", func() {
+
+		// Temporary Buffer
+		type Buffer struct {
+			bytes.Buffer
+			io.Closer
+		}
+
+		var buf *Buffer
+		var handler http.Handler
+		var seen string
+
+		BeforeEach(func() {
+			config := new(LoggingConfig)
+			config.Defaults()
+			logger, err := InitLogger(config)
+			Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+
+			buf = new(Buffer)
+			logger.SetHandler(buf)
+
+			seen = ""
+			handler = WebLogger(logger, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				seen = r.Header.Get(HeaderRequestIDKey)
+				w.WriteHeader(http.StatusOK)
+			}))
+		})
+
+		It("should echo and log the request id", func() {
+			req := httptest.NewRequest(http.MethodGet, StatusEndpoint, nil)
+			req.Header.Set(HeaderRequestIDKey, "abc123")
+
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+
+			Ω(seen).Should(Equal("abc123"))
+			Ω(w.Header().Get(HeaderRequestIDKey)).Should(Equal("abc123"))
+			Ω(buf.String()).Should(ContainSubstring("c2s GET /status 200"))
+			Ω(buf.String()).Should(ContainSubstring("(request abc123)"))
+		})
+
+		It("should generate a request id if one is not sent", func() {
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, StatusEndpoint, nil))
+
+			Ω(seen).ShouldNot(BeEmpty())
+			Ω(w.Header().Get(HeaderRequestIDKey)).Should(Equal(seen))
+			Ω(buf.String()).Should(ContainSubstring(seen))
+		})
+
+		It("should log the request id sent by the client", func() {
+			server := httptest.NewServer(handler)
+			defer server.Close()
+
+			// Point the client at the test server
+			surl, err := url.Parse(server.URL)
+			Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+			_, port, err := net.SplitHostPort(surl.Host)
+			Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+
+			cli := new(CLIClient)
+			cli.Init()
+			cli.PID.Port, err = strconv.Atoi(port)
+			Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+
+			req, err := http.NewRequest(http.MethodGet, cli.Endpoint(StatusEndpoint).String(), nil)
+			Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+
+			res, err := cli.Do(req)
+			Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+			res.Body.Close()
+
+			Ω(seen).ShouldNot(BeEmpty())
+			Ω(seen).Should(Equal(req.Header.Get(HeaderRequestIDKey)))
+			Ω(res.Header.Get(HeaderRequestIDKey)).Should(Equal(seen))
+			Ω(buf.String()).Should(ContainSubstring(fmt.Sprintf("(request %s)", seen)))
+		})
+
+	})
+
 })
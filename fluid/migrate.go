@@ -0,0 +1,255 @@
+// Mechanisms for migrating blobs from one storage directory to another.
+
+package fluid
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// DefaultMigrationWorkers is the number of go routines that copy blobs
+// concurrently if the number of workers is not specified.
+const DefaultMigrationWorkers = 4
+
+//===========================================================================
+// Blob Migration
+//===========================================================================
+
+// MigrationReport describes the progress of a blob migration. A copy of the
+// report is passed to the progress callback after every blob is handled and
+// the final report is returned when the migration is complete.
+type MigrationReport struct {
+	Total   int // The number of blobs found in the source store
+	Copied  int // The number of blobs copied to the target store
+	Skipped int // The number of verified blobs already in the target store
+	Failed  int // The number of blobs that could not be migrated
+}
+
+// Done returns the number of blobs that have been handled so far.
+func (r MigrationReport) Done() int {
+	return r.Copied + r.Skipped + r.Failed
+}
+
+// String returns a pretty representation of the migration progress.
+func (r MigrationReport) String() string {
+	return fmt.Sprintf(
+		"%d of %d blobs migrated (%d copied, %d skipped, %d failed)",
+		r.Done(), r.Total, r.Copied, r.Skipped, r.Failed,
+	)
+}
+
+// BlobMigrator copies blobs from a source storage directory to a target
+// storage directory, verifying the hash of every blob it reads and writes.
+// Blobs that already exist in the target and whose contents match their
+// hash are skipped, so an interrupted migration can simply be run again in
+// order to resume where it left off.
+type BlobMigrator struct {
+	sync.Mutex
+	Source   string                // The storage directory to copy blobs from
+	Target   string                // The storage directory to copy blobs to
+	Workers  int                   // The number of concurrent copy workers
+	Progress func(MigrationReport) // Optional callback after each blob is handled
+	signer   *SignedChunker        // Computes blob signatures for verification
+	report   MigrationReport       // The current state of the migration
+	errs     []error               // Errors encountered during the migration
+}
+
+// NewBlobMigrator creates a migrator between the source and target storage
+// directories that verifies blobs with the named hashing algorithm.
+func NewBlobMigrator(src, dst, hashing string) (*BlobMigrator, error) {
+	if src == "" || dst == "" {
+		return nil, errors.New("must specify both a source and a target storage directory")
+	}
+
+	hasher, err := CreateHasher(Regularize(hashing))
+	if err != nil {
+		return nil, err
+	}
+
+	m := &BlobMigrator{
+		Source:  src,
+		Target:  dst,
+		Workers: DefaultMigrationWorkers,
+		signer:  new(SignedChunker),
+	}
+	m.signer.SetHasher(hasher)
+
+	return m, nil
+}
+
+// Run the migration, returning the final report. If any blobs could not be
+// migrated, an error is returned along with the report; the migration can
+// be rerun to retry the failed blobs without copying the others again.
+func (m *BlobMigrator) Run() (MigrationReport, error) {
+	// Reset the state of the migration
+	m.report = MigrationReport{}
+	m.errs = make([]error, 0)
+
+	// Enumerate all of the blobs in the source store.
+	paths, err := m.enumerate()
+	if err != nil {
+		return m.report, err
+	}
+	m.report.Total = len(paths)
+
+	// Ensure the target storage directory exists.
+	_, dirPerm := storagePerms()
+	if err := os.MkdirAll(m.Target, dirPerm); err != nil {
+		return m.report, err
+	}
+
+	workers := m.Workers
+	if workers < 1 {
+		workers = DefaultMigrationWorkers
+	}
+
+	// Feed the source paths to the worker pool.
+	queue := make(chan string, workers)
+	group := new(sync.WaitGroup)
+
+	for i := 0; i < workers; i++ {
+		group.Add(1)
+		go func() {
+			defer group.Done()
+			for path := range queue {
+				copied, err := m.migrate(path)
+				m.record(copied, err)
+			}
+		}()
+	}
+
+	for _, path := range paths {
+		queue <- path
+	}
+
+	close(queue)
+	group.Wait()
+
+	if len(m.errs) > 0 {
+		return m.report, fmt.Errorf("could not migrate %d of %d blobs", len(m.errs), m.report.Total)
+	}
+
+	return m.report, nil
+}
+
+// Walk the source storage directory and return the path of every blob.
+func (m *BlobMigrator) enumerate() ([]string, error) {
+	paths := make([]string, 0)
+
+	visit := func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if !info.IsDir() && filepath.Ext(path) == BlobExt {
+			paths = append(paths, path)
+		}
+
+		return nil
+	}
+
+	if err := filepath.Walk(m.Source, visit); err != nil {
+		return nil, fmt.Errorf("could not enumerate blobs in %s: %s", m.Source, err.Error())
+	}
+
+	return paths, nil
+}
+
+// Migrate a single blob from the source path to the target store, returning
+// true if the blob was copied or false if it was already in the target.
+func (m *BlobMigrator) migrate(path string) (bool, error) {
+	// Load and verify the blob from the source store.
+	src := new(Blob)
+	if err := src.Load(path); err != nil {
+		return false, err
+	}
+
+	if err := m.verify(src); err != nil {
+		return false, err
+	}
+
+	// Create a new blob so the source path isn't saved into the target.
+	dst := &Blob{data: src.Data(), hash: src.Hash()}
+	target := filepath.Join(m.Target, dst.Path())
+
+	// Skip the blob if it already exists in the target and is correct.
+	if data, err := ioutil.ReadFile(target); err == nil {
+		if m.signer.Signature(data) == dst.Hash() {
+			return false, nil
+		}
+	}
+
+	// Save the blob to the target and verify that it was written correctly.
+	if err := dst.Save(m.Target); err != nil {
+		return false, err
+	}
+
+	written := new(Blob)
+	if err := written.Load(target); err != nil {
+		return false, err
+	}
+
+	if err := m.verify(written); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// Verify that the contents of a blob match the hash in its filename.
+func (m *BlobMigrator) verify(blob *Blob) error {
+	if sig := m.signer.Signature(blob.Data()); sig != blob.Hash() {
+		return fmt.Errorf("blob at %s does not match its signature %s", blob.path, sig)
+	}
+	return nil
+}
+
+// Record the outcome of a single blob migration and report the progress.
+func (m *BlobMigrator) record(copied bool, err error) {
+	m.Lock()
+	defer m.Unlock()
+
+	switch {
+	case err != nil:
+		m.report.Failed++
+		m.errs = append(m.errs, err)
+	case copied:
+		m.report.Copied++
+	default:
+		m.report.Skipped++
+	}
+
+	if m.Progress != nil {
+		m.Progress(m.report)
+	}
+}
+
+//===========================================================================
+// Package Migration Helpers
+//===========================================================================
+
+// MigrateBlobs copies all blobs from the source storage directory to the
+// target storage directory using the configured hashing algorithm. If the
+// source is empty, the configured storage path is used as the source.
+func MigrateBlobs(src, dst string, workers int, progress func(MigrationReport)) (MigrationReport, error) {
+	if src == "" {
+		src = config.Storage.Path
+	}
+
+	migrator, err := NewBlobMigrator(src, dst, config.Storage.Hashing)
+	if err != nil {
+		return MigrationReport{}, err
+	}
+
+	if workers > 0 {
+		migrator.Workers = workers
+	}
+
+	migrator.Progress = progress
+	logger.Info("migrating blobs from %s to %s", src, dst)
+	return migrator.Run()
+}
@@ -0,0 +1,133 @@
+package fluid_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "github.com/bbengfort/fluidfs/fluid"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Migrate", func() {
+
+	var err error
+	var srcDir string
+	var dstDir string
+	var blobs []*Blob
+
+	BeforeEach(func() {
+		srcDir, err = ioutil.TempDir("", TempDirPrefix)
+		Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+
+		dstDir, err = ioutil.TempDir("", TempDirPrefix)
+		Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+
+		config := new(StorageConfig)
+		config.Defaults()
+		config.Path = srcDir
+
+		// Populate the source store with blobs
+		chunker, err := NewChunker([]byte(randString(65536)), config)
+		Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+
+		blobs = make([]*Blob, 0)
+		for chunker.Next() {
+			blob := chunker.Chunk().(*Blob)
+			Ω(blob.Save(srcDir)).Should(Succeed())
+			blobs = append(blobs, blob)
+		}
+	})
+
+	AfterEach(func() {
+		Ω(os.RemoveAll(srcDir)).Should(Succeed())
+		Ω(os.RemoveAll(dstDir)).Should(Succeed())
+	})
+
+	// Returns the path of the blob in the target store.
+	target := func(blob *Blob) string {
+		rel, err := filepath.Rel(srcDir, blob.Path())
+		Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+		return filepath.Join(dstDir, rel)
+	}
+
+	It("should require a source and a target", func() {
+		_, err := NewBlobMigrator("", dstDir, SHA256)
+		Ω(err).Should(HaveOccurred())
+
+		_, err = NewBlobMigrator(srcDir, "", SHA256)
+		Ω(err).Should(HaveOccurred())
+	})
+
+	It("should transfer and verify all blobs", func() {
+		migrator, err := NewBlobMigrator(srcDir, dstDir, SHA256)
+		Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+
+		calls := 0
+		migrator.Progress = func(report MigrationReport) {
+			calls++
+			Ω(report.Total).Should(Equal(len(blobs)))
+			Ω(report.Done()).Should(Equal(calls))
+		}
+
+		report, err := migrator.Run()
+		Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+		Ω(report.Total).Should(Equal(len(blobs)))
+		Ω(report.Copied).Should(Equal(len(blobs)))
+		Ω(report.Skipped).Should(BeZero())
+		Ω(report.Failed).Should(BeZero())
+		Ω(calls).Should(Equal(len(blobs)))
+
+		for _, blob := range blobs {
+			data, err := ioutil.ReadFile(target(blob))
+			Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+			Ω(data).Should(Equal(blob.Data()))
+		}
+	})
+
+	It("should resume an interrupted migration", func() {
+		migrator, err := NewBlobMigrator(srcDir, dstDir, SHA256)
+		Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+		migrator.Workers = 1
+
+		// Copy the first blob by hand and truncate the second.
+		Ω(os.MkdirAll(filepath.Dir(target(blobs[0])), 0755)).Should(Succeed())
+		Ω(ioutil.WriteFile(target(blobs[0]), blobs[0].Data(), 0644)).Should(Succeed())
+		Ω(os.MkdirAll(filepath.Dir(target(blobs[1])), 0755)).Should(Succeed())
+		Ω(ioutil.WriteFile(target(blobs[1]), blobs[1].Data()[:10], 0644)).Should(Succeed())
+
+		report, err := migrator.Run()
+		Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+		Ω(report.Skipped).Should(Equal(1))
+		Ω(report.Copied).Should(Equal(len(blobs) - 1))
+
+		data, err := ioutil.ReadFile(target(blobs[1]))
+		Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+		Ω(data).Should(Equal(blobs[1].Data()))
+
+		// A second run should not copy anything.
+		report, err = migrator.Run()
+		Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+		Ω(report.Skipped).Should(Equal(len(blobs)))
+		Ω(report.Copied).Should(BeZero())
+	})
+
+	It("should not migrate corrupted blobs", func() {
+		Ω(ioutil.WriteFile(blobs[0].Path(), []byte("corrupted"), 0644)).Should(Succeed())
+
+		migrator, err := NewBlobMigrator(srcDir, dstDir, SHA256)
+		Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+
+		report, err := migrator.Run()
+		Ω(err).Should(HaveOccurred())
+		Ω(report.Failed).Should(Equal(1))
+		Ω(report.Copied).Should(Equal(len(blobs) - 1))
+
+		exists, _ := pathExists(target(blobs[0]))
+		Ω(exists).Should(BeFalse())
+	})
+
+})
@@ -0,0 +1,162 @@
+// Architecture independent implementation of the murmur3 x64 128-bit hash.
+
+package fluid
+
+import (
+	"encoding/binary"
+	"hash"
+)
+
+// Constants of the murmur3 x64 128-bit algorithm.
+const (
+	murmurC1        = 0x87c37b91114253d5
+	murmurC2        = 0x4cf5ad432745937f
+	murmurBlockSize = 16
+)
+
+//===========================================================================
+// Portable Murmur Hash
+//===========================================================================
+
+// NewMurmur128 returns a murmur3 x64 128-bit hash that reads its input as
+// little endian words on every platform. The vendored murmur3 package casts
+// the input to native words, so on big endian platforms it produces different
+// blob hashes than on little endian platforms, which would prevent replicas
+// with mixed architectures from sharing blobs. On little endian platforms the
+// two hashes are identical.
+func NewMurmur128() hash.Hash {
+	return new(murmur128)
+}
+
+// Implements hash.Hash for the murmur3 x64 128-bit algorithm with seed 0.
+type murmur128 struct {
+	h1, h2 uint64                // The running hash of the complete blocks
+	buf    [murmurBlockSize]byte // The incomplete block of written data
+	nbuf   int                   // The number of bytes in the incomplete block
+	length uint64                // The total number of bytes written
+}
+
+// Write adds data to the running hash. It never returns an error.
+func (m *murmur128) Write(p []byte) (int, error) {
+	n := len(p)
+	m.length += uint64(n)
+
+	// Complete the buffered block first
+	if m.nbuf > 0 {
+		c := copy(m.buf[m.nbuf:], p)
+		m.nbuf += c
+		p = p[c:]
+
+		if m.nbuf < murmurBlockSize {
+			return n, nil
+		}
+
+		m.block(m.buf[:])
+		m.nbuf = 0
+	}
+
+	for len(p) >= murmurBlockSize {
+		m.block(p[:murmurBlockSize])
+		p = p[murmurBlockSize:]
+	}
+
+	m.nbuf = copy(m.buf[:], p)
+	return n, nil
+}
+
+// Sum appends the big endian hash to b without changing the running hash.
+func (m *murmur128) Sum(b []byte) []byte {
+	h1, h2 := m.h1, m.h2
+	tail := m.buf[:m.nbuf]
+
+	var k1, k2 uint64
+	for i := len(tail) - 1; i >= 8; i-- {
+		k2 ^= uint64(tail[i]) << uint((i-8)*8)
+	}
+	if len(tail) > 8 {
+		k2 *= murmurC2
+		k2 = (k2 << 33) | (k2 >> 31)
+		k2 *= murmurC1
+		h2 ^= k2
+	}
+
+	n := len(tail)
+	if n > 8 {
+		n = 8
+	}
+	for i := n - 1; i >= 0; i-- {
+		k1 ^= uint64(tail[i]) << uint(i*8)
+	}
+	if len(tail) > 0 {
+		k1 *= murmurC1
+		k1 = (k1 << 31) | (k1 >> 33)
+		k1 *= murmurC2
+		h1 ^= k1
+	}
+
+	h1 ^= m.length
+	h2 ^= m.length
+
+	h1 += h2
+	h2 += h1
+
+	h1 = fmix64(h1)
+	h2 = fmix64(h2)
+
+	h1 += h2
+	h2 += h1
+
+	var sum [murmurBlockSize]byte
+	binary.BigEndian.PutUint64(sum[:8], h1)
+	binary.BigEndian.PutUint64(sum[8:], h2)
+	return append(b, sum[:]...)
+}
+
+// Reset the hash to its initial state.
+func (m *murmur128) Reset() {
+	*m = murmur128{}
+}
+
+// Size returns the number of bytes Sum will append.
+func (m *murmur128) Size() int {
+	return murmurBlockSize
+}
+
+// BlockSize returns the block size of the hash.
+func (m *murmur128) BlockSize() int {
+	return murmurBlockSize
+}
+
+// Mix a complete block into the running hash.
+func (m *murmur128) block(p []byte) {
+	k1 := binary.LittleEndian.Uint64(p[:8])
+	k2 := binary.LittleEndian.Uint64(p[8:])
+
+	k1 *= murmurC1
+	k1 = (k1 << 31) | (k1 >> 33)
+	k1 *= murmurC2
+	m.h1 ^= k1
+
+	m.h1 = (m.h1 << 27) | (m.h1 >> 37)
+	m.h1 += m.h2
+	m.h1 = m.h1*5 + 0x52dce729
+
+	k2 *= murmurC2
+	k2 = (k2 << 33) | (k2 >> 31)
+	k2 *= murmurC1
+	m.h2 ^= k2
+
+	m.h2 = (m.h2 << 31) | (m.h2 >> 33)
+	m.h2 += m.h1
+	m.h2 = m.h2*5 + 0x38495ab5
+}
+
+// Final avalanche mix of a murmur3 64-bit hash part.
+func fmix64(k uint64) uint64 {
+	k ^= k >> 33
+	k *= 0xff51afd7ed558ccd
+	k ^= k >> 33
+	k *= 0xc4ceb9fe1a85ec53
+	k ^= k >> 33
+	return k
+}
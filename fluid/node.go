@@ -31,9 +31,16 @@ type Node struct {
 }
 
 // Init a Node with the required properties for storage in the file system.
-func (n *Node) Init(name string, mode os.FileMode, parent *Dir, fs *FileSystem) {
+// An error is returned if an inode number could not be allocated.
+func (n *Node) Init(name string, mode os.FileMode, parent *Dir, fs *FileSystem) error {
+	// Allocate an inode number, which may require reserving a block of them
+	id, err := fs.Sequence.Next()
+	if err != nil {
+		return err
+	}
+
 	// Manage the Node properties
-	n.ID, _ = fs.Sequence.Next()
+	n.ID = id
 	n.Name = name
 	n.Parent = parent
 	n.XAttrs = make(XAttr)
@@ -57,6 +64,7 @@ func (n *Node) Init(name string, mode os.FileMode, parent *Dir, fs *FileSystem)
 	n.Attrs.BlockSize = uint32(minBlockSize)
 
 	logger.Info("initialized node %d, %q", n.ID, n.Name)
+	return nil
 }
 
 //===========================================================================
@@ -75,6 +83,25 @@ func (n *Node) IsArchive() bool {
 	return false
 }
 
+// Touch the access time of the node according to the atime mode of the file
+// system. In relatime mode the access time is only updated if it is not newer
+// than the modification or change time, or is more than a day old, so that
+// tools that compare access and modification times still work.
+func (n *Node) access() {
+	now := time.Now()
+
+	switch n.fs.atime {
+	case NoAtime:
+		return
+	case RelAtime:
+		if n.Attrs.Atime.After(n.Attrs.Mtime) && n.Attrs.Atime.After(n.Attrs.Ctime) && now.Sub(n.Attrs.Atime) < 24*time.Hour {
+			return
+		}
+	}
+
+	n.Attrs.Atime = now
+}
+
 // FuseType returns the fuse type of the node for listing
 func (n *Node) FuseType() fuse.DirentType {
 	if n.IsDir() {
@@ -146,6 +173,8 @@ func (n *Node) Attr(ctx context.Context, attr *fuse.Attr) error {
 //
 // https://godoc.org/bazil.org/fuse/fs#NodeAccesser
 func (n *Node) Access(ctx context.Context, req *fuse.AccessRequest) error {
+	defer n.fs.acquire()()
+
 	logger.Debug("access called on node %d", n.ID)
 	return nil // Permission always granted, relying on checks in Open.
 }
@@ -170,6 +199,8 @@ func (n *Node) Forget() {
 //
 // https://godoc.org/bazil.org/fuse/fs#NodeGetattrer
 func (n *Node) Getattr(ctx context.Context, req *fuse.GetattrRequest, resp *fuse.GetattrResponse) error {
+	defer n.fs.acquire()()
+
 	logger.Debug("getting attrs on node %d", n.ID)
 	resp.Attr = n.Attrs
 	return nil
@@ -181,6 +212,8 @@ func (n *Node) Getattr(ctx context.Context, req *fuse.GetattrRequest, resp *fuse
 //
 // https://godoc.org/bazil.org/fuse/fs#NodeGetxattrer
 func (n *Node) Getxattr(ctx context.Context, req *fuse.GetxattrRequest, resp *fuse.GetxattrResponse) error {
+	defer n.fs.acquire()()
+
 	if data, ok := n.XAttrs[req.Name]; ok {
 		logger.Debug("getting xattr named %s on node %d", req.Name, n.ID)
 		if req.Size != 0 {
@@ -200,6 +233,8 @@ func (n *Node) Getxattr(ctx context.Context, req *fuse.GetxattrRequest, resp *fu
 //
 // https://godoc.org/bazil.org/fuse/fs#NodeListxattrer
 func (n *Node) Listxattr(ctx context.Context, req *fuse.ListxattrRequest, resp *fuse.ListxattrResponse) error {
+	defer n.fs.acquire()()
+
 	logger.Debug("listing xattr names on node %d", n.ID)
 
 	for name := range n.XAttrs {
@@ -240,6 +275,8 @@ func (n *Node) Listxattr(ctx context.Context, req *fuse.ListxattrRequest, resp *
 //
 // https://godoc.org/bazil.org/fuse/fs#NodeRemovexattrer
 func (n *Node) Removexattr(ctx context.Context, req *fuse.RemovexattrRequest) error {
+	defer n.fs.acquire()()
+
 	// if n.IsArchive() || n.fs.ReadOnly {
 	// 	return fuse.EPERM
 	// }
@@ -247,6 +284,11 @@ func (n *Node) Removexattr(ctx context.Context, req *fuse.RemovexattrRequest) er
 	n.fs.Lock()
 	defer n.fs.Unlock()
 
+	// Reject modifications while the file system is in maintenance mode
+	if err := n.fs.writable(); err != nil {
+		return err
+	}
+
 	if _, ok := n.XAttrs[req.Name]; ok {
 		logger.Debug("removing xattr named %s on node %d", req.Name, n.ID)
 		delete(n.XAttrs, req.Name)
@@ -268,6 +310,14 @@ func (n *Node) Removexattr(ctx context.Context, req *fuse.RemovexattrRequest) er
 //
 // https://godoc.org/bazil.org/fuse/fs#NodeSetattrer
 func (n *Node) Setattr(ctx context.Context, req *fuse.SetattrRequest, resp *fuse.SetattrResponse) error {
+	defer n.fs.acquire()()
+
+	return n.setattr(req, resp)
+}
+
+// Sets the metadata in the request on the node without acquiring the request
+// limiter, so that the Setattr of embedding types can call it.
+func (n *Node) setattr(req *fuse.SetattrRequest, resp *fuse.SetattrResponse) error {
 	// if n.IsArchive() || n.fs.readonly {
 	// 	return fuse.EPERM
 	// }
@@ -275,6 +325,11 @@ func (n *Node) Setattr(ctx context.Context, req *fuse.SetattrRequest, resp *fuse
 	n.fs.Lock()
 	defer n.fs.Unlock()
 
+	// Reject modifications while the file system is in maintenance mode
+	if err := n.fs.writable(); err != nil {
+		return err
+	}
+
 	// If a handle is set - we don't do anything with that currently.
 	if req.Valid.Handle() {
 		logger.Debug("(error) setting handle attr on node %d but we don't store it!", n.ID)
@@ -366,6 +421,8 @@ func (n *Node) Setattr(ctx context.Context, req *fuse.SetattrRequest, resp *fuse
 //
 // https://godoc.org/bazil.org/fuse/fs#NodeSetxattrer
 func (n *Node) Setxattr(ctx context.Context, req *fuse.SetxattrRequest) error {
+	defer n.fs.acquire()()
+
 	// if n.IsArchive() || n.fs.readonly {
 	// 	return fuse.EPERM
 	// }
@@ -373,6 +430,11 @@ func (n *Node) Setxattr(ctx context.Context, req *fuse.SetxattrRequest) error {
 	n.fs.Lock()
 	defer n.fs.Unlock()
 
+	// Reject modifications while the file system is in maintenance mode
+	if err := n.fs.writable(); err != nil {
+		return err
+	}
+
 	logger.Debug("setting xattr named %s on node %d", req.Name, n.ID)
 	n.XAttrs[req.Name] = req.Xattr
 	return nil
@@ -12,6 +12,7 @@ import (
 	"os/signal"
 	"os/user"
 	"path/filepath"
+	"strconv"
 	"syscall"
 )
 
@@ -47,9 +48,10 @@ func signalHandler() {
 // PID describes the server process and is accessed by both the server and the
 // command line client in order to facilitate cross-process communication.
 type PID struct {
-	PID  int `json:"pid"`  // The process id assigned by the OS
-	PPID int `json:"ppid"` // The parent process id
-	Port int `json:"port"` // The command port for client-server communication
+	PID  int    `json:"pid"`            // The process id assigned by the OS
+	PPID int    `json:"ppid"`           // The parent process id
+	Host string `json:"host,omitempty"` // The address the command API is bound to
+	Port int    `json:"port"`           // The command port for client-server communication
 }
 
 // Path returns the best possible PID file for the current system, by first
@@ -71,6 +73,8 @@ func (pid *PID) Path() string {
 
 // Save the PID file to disk after first determining the process id and the
 // command port -- used by the server on startup to allow clients to connect.
+// If the port has not been set, e.g. from the bound listener of the command
+// API, then any available port is selected.
 // NOTE: This method will fail if the PID file already exists.
 func (pid *PID) Save() error {
 	var err error
@@ -80,9 +84,11 @@ func (pid *PID) Save() error {
 	pid.PPID = os.Getppid()
 
 	// Get any available Port for communication
-	pid.Port, err = pid.FreePort()
-	if err != nil {
-		return err
+	if pid.Port == 0 {
+		pid.Port, err = pid.FreePort()
+		if err != nil {
+			return err
+		}
 	}
 
 	// Marshall the JSON representation
@@ -129,9 +135,15 @@ func (pid *PID) Free() error {
 	return os.Remove(pid.Path())
 }
 
-// Addr returns the localhost address with the selected PID.
+// Addr returns the address to connect to the command API on. If the API is
+// bound to all interfaces, or the host is not recorded, then localhost is
+// used. IPv6 addresses are bracketed.
 func (pid *PID) Addr() string {
-	return fmt.Sprintf("localhost:%d", pid.Port)
+	host := pid.Host
+	if ip := net.ParseIP(host); host == "" || (ip != nil && ip.IsUnspecified()) {
+		host = "localhost"
+	}
+	return net.JoinHostPort(host, strconv.Itoa(pid.Port))
 }
 
 // FreePort asks the kernel for a free, open port that is ready to use.
@@ -57,6 +57,25 @@ var _ = Describe("PID File", func() {
 		Ω(pid.Addr()).Should(Equal("localhost:6060"))
 	})
 
+	It("should compose an address with the bound host", func() {
+		pid.Port = 6060
+
+		addrs := map[string]string{
+			"127.0.0.1":    "127.0.0.1:6060",
+			"192.168.1.42": "192.168.1.42:6060",
+			"::1":          "[::1]:6060",
+			"fluid.local":  "fluid.local:6060",
+			"0.0.0.0":      "localhost:6060",
+			"::":           "localhost:6060",
+			"":             "localhost:6060",
+		}
+
+		for host, addr := range addrs {
+			pid.Host = host
+			Ω(pid.Addr()).Should(Equal(addr), host)
+		}
+	})
+
 	Context("tests only if the PID file doesn't exist", func() {
 
 		freePID := false
@@ -96,6 +115,37 @@ var _ = Describe("PID File", func() {
 			Ω(exists).Should(BeTrue(), "PID file should exist after save")
 		})
 
+		It("should connect the client to the address the API is bound to", func() {
+			SkipIfPIDExists()
+
+			conf := new(Config)
+			conf.Defaults()
+			conf.APIHost = "127.0.0.1"
+
+			// Bind the API to the configured address and serve it
+			ln, err := net.Listen("tcp", conf.APIAddr())
+			Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+			defer ln.Close()
+
+			api := new(C2SAPI)
+			Ω(api.Init()).Should(Succeed())
+			go api.Serve(ln, make(chan error, 1))
+
+			// Write the resolved address to the PID file
+			pid.Host = conf.APIHost
+			pid.Port = ln.Addr().(*net.TCPAddr).Port
+			Ω(pid.Save()).Should(Succeed())
+
+			client := new(CLIClient)
+			Ω(client.Init()).Should(Succeed())
+			Ω(client.PID.Host).Should(Equal("127.0.0.1"))
+			Ω(client.Endpoint(HealthEndpoint).Host).Should(Equal(ln.Addr().String()))
+
+			res := new(ProbeResponse)
+			Ω(client.Get(HealthEndpoint, res)).Should(Succeed())
+			Ω(res.Status).Should(Equal("ok"))
+		})
+
 		It("should be able to load the PID file", func() {
 			SkipIfPIDExists()
 
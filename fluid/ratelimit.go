@@ -0,0 +1,156 @@
+// Per-client rate limiting middleware for the C2S API.
+
+package fluid
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Number of client buckets kept before idle buckets are pruned.
+const maxRateBuckets = 1024
+
+//===========================================================================
+// Rate Limiter
+//===========================================================================
+
+// RateLimiter limits the rate of requests that each client can make to the
+// C2S API using a token bucket per client and class of request. Clients are
+// identified by their IP address rather than the bearer token they send,
+// since the limiter runs before authentication and an unverified token would
+// allow clients to evade their limit by sending a different token with every
+// request. Reads and writes are limited separately so that a client polling
+// the status cannot prevent itself from making changes and vice versa.
+type RateLimiter struct {
+	sync.Mutex
+	conf    *RateLimitConfig       // The configured rates and bursts
+	buckets map[string]*rateBucket // Token buckets by class and client
+}
+
+// A token bucket that is refilled at the rate up to the burst.
+type rateBucket struct {
+	tokens  float64   // The number of requests that may currently be made
+	updated time.Time // When the tokens were last refilled
+}
+
+// NewRateLimiter creates a rate limiter with the specified configuration.
+func NewRateLimiter(conf *RateLimitConfig) *RateLimiter {
+	return &RateLimiter{
+		conf:    conf,
+		buckets: make(map[string]*rateBucket),
+	}
+}
+
+// Limit wraps a handler so that clients that exceed their rate limit are
+// sent a 429 error response with a Retry-After header.
+func (l *RateLimiter) Limit(inner http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		wait := l.Allow(r)
+		if wait == 0 {
+			inner.ServeHTTP(w, r)
+			return
+		}
+
+		data := &ErrorResponse{
+			Code:  http.StatusTooManyRequests,
+			Error: fmt.Sprintf("rate limit exceeded, retry in %s", wait),
+		}
+		ctype, body, _ := marshalResponse(r.Header.Get(HeaderAcceptKey), data)
+
+		// Retry-After is specified in whole seconds, so round up.
+		retry := int(math.Ceil(wait.Seconds()))
+		w.Header().Set("Retry-After", strconv.Itoa(retry))
+		w.Header().Set(HeaderContentTypeKey, ctype)
+		w.WriteHeader(http.StatusTooManyRequests)
+		w.Write(body)
+	})
+}
+
+// Allow takes a token from the client's bucket for the class of request,
+// returning zero if the request is allowed, otherwise how long the client
+// must wait until the request would be allowed.
+func (l *RateLimiter) Allow(r *http.Request) time.Duration {
+	rate, burst, class := l.conf.WriteRate, l.conf.WriteBurst, "write"
+	if isReadMethod(r.Method) {
+		rate, burst, class = l.conf.ReadRate, l.conf.ReadBurst, "read"
+	}
+
+	// A rate of zero means that the class of requests is not limited.
+	if rate <= 0 {
+		return 0
+	}
+
+	l.Lock()
+	defer l.Unlock()
+
+	now := time.Now()
+	key := class + ":" + rateClient(r)
+	bucket, ok := l.buckets[key]
+	if !ok {
+		l.prune(now)
+		bucket = &rateBucket{tokens: float64(burst), updated: now}
+		l.buckets[key] = bucket
+	}
+
+	// Refill the bucket for the time since it was last updated.
+	elapsed := now.Sub(bucket.updated).Seconds()
+	bucket.tokens = math.Min(float64(burst), bucket.tokens+elapsed*rate)
+	bucket.updated = now
+
+	if bucket.tokens < 1 {
+		wait := time.Duration((1 - bucket.tokens) / rate * float64(time.Second))
+		if wait < time.Millisecond {
+			wait = time.Millisecond
+		}
+		return wait
+	}
+
+	bucket.tokens--
+	return 0
+}
+
+// Buckets returns the number of token buckets currently held by the limiter.
+func (l *RateLimiter) Buckets() int {
+	l.Lock()
+	defer l.Unlock()
+	return len(l.buckets)
+}
+
+// Remove buckets that have been idle long enough to be completely refilled,
+// since a new bucket would be identical. Must be called with the lock held.
+func (l *RateLimiter) prune(now time.Time) {
+	if len(l.buckets) < maxRateBuckets {
+		return
+	}
+
+	// Any bucket idle for longer than the slowest refill is full.
+	rate := l.conf.ReadRate
+	burst := l.conf.ReadBurst
+	if l.conf.WriteRate > 0 && (rate <= 0 || l.conf.WriteRate < rate) {
+		rate = l.conf.WriteRate
+	}
+	if l.conf.WriteBurst > burst {
+		burst = l.conf.WriteBurst
+	}
+
+	idle := time.Duration(float64(burst) / rate * float64(time.Second))
+	for key, bucket := range l.buckets {
+		if now.Sub(bucket.updated) > idle {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// Identify the client by its IP address.
+func rateClient(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,124 @@
+package fluid_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+
+	. "github.com/bbengfort/fluidfs/fluid"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("RateLimiter", func() {
+
+	var api *C2SAPI
+
+	BeforeEach(func() {
+		api = &C2SAPI{Limits: &RateLimitConfig{
+			ReadRate: 0.01, ReadBurst: 5, WriteRate: 0.01, WriteBurst: 2,
+		}}
+		Ω(api.Init()).Should(Succeed())
+	})
+
+	// Serve a request from the client address to the API router.
+	serve := func(method, endpoint, addr string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, endpoint, nil)
+		req.RemoteAddr = addr
+
+		w := httptest.NewRecorder()
+		api.Router.ServeHTTP(w, req)
+		return w
+	}
+
+	It("should limit reads after the configured burst", func() {
+		for i := 0; i < 5; i++ {
+			w := serve(http.MethodGet, FlushStatusEndpoint, "10.0.0.1:4157")
+			Ω(w.Code).Should(Equal(http.StatusOK), "request %d was limited", i)
+		}
+
+		w := serve(http.MethodGet, FlushStatusEndpoint, "10.0.0.1:4157")
+		Ω(w.Code).Should(Equal(http.StatusTooManyRequests))
+		Ω(w.Body.String()).Should(ContainSubstring("rate limit exceeded"))
+
+		retry, err := strconv.Atoi(w.Header().Get("Retry-After"))
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(retry).Should(BeNumerically(">", 0))
+		Ω(retry).Should(BeNumerically("<=", 100))
+	})
+
+	It("should limit reads and writes separately", func() {
+		for i := 0; i < 2; i++ {
+			w := serve(http.MethodPost, FlushEndpoint, "10.0.0.1:4157")
+			Ω(w.Code).Should(Equal(http.StatusOK), "request %d was limited", i)
+		}
+
+		w := serve(http.MethodPost, FlushEndpoint, "10.0.0.1:4157")
+		Ω(w.Code).Should(Equal(http.StatusTooManyRequests))
+
+		w = serve(http.MethodGet, FlushStatusEndpoint, "10.0.0.1:4157")
+		Ω(w.Code).Should(Equal(http.StatusOK))
+	})
+
+	It("should limit each client separately", func() {
+		for i := 0; i < 2; i++ {
+			serve(http.MethodPost, FlushEndpoint, "10.0.0.1:4157")
+		}
+		Ω(serve(http.MethodPost, FlushEndpoint, "10.0.0.1:5126").Code).Should(Equal(http.StatusTooManyRequests))
+		Ω(serve(http.MethodPost, FlushEndpoint, "10.0.0.2:4157").Code).Should(Equal(http.StatusOK))
+	})
+
+	It("should not identify clients by their token", func() {
+		limiter := NewRateLimiter(&RateLimitConfig{WriteRate: 0.01, WriteBurst: 1})
+
+		req := httptest.NewRequest(http.MethodPost, FlushEndpoint, nil)
+		req.RemoteAddr = "10.0.0.3:4157"
+		req.Header.Set(HeaderAuthorizationKey, "Bearer correct-horse-battery-staple")
+		Ω(limiter.Allow(req)).Should(BeZero())
+
+		// Sending a different token from the same address is still limited.
+		req.Header.Set(HeaderAuthorizationKey, "Bearer incorrect-horse-battery")
+		Ω(limiter.Allow(req)).ShouldNot(BeZero())
+
+		// Even if there are many tokens, only one bucket is created.
+		for i := 0; i < 10; i++ {
+			req.Header.Set(HeaderAuthorizationKey, "Bearer token-"+strconv.Itoa(i))
+			Ω(limiter.Allow(req)).ShouldNot(BeZero())
+		}
+		Ω(limiter.Buckets()).Should(Equal(1))
+	})
+
+	It("should not limit requests with a zero rate", func() {
+		limiter := NewRateLimiter(new(RateLimitConfig))
+		for i := 0; i < 100; i++ {
+			req := httptest.NewRequest(http.MethodGet, StatusEndpoint, nil)
+			Ω(limiter.Allow(req)).Should(BeZero())
+		}
+	})
+
+	It("should not limit the probes", func() {
+		for i := 0; i < 10; i++ {
+			Ω(serve(http.MethodGet, HealthEndpoint, "10.0.0.1:4157").Code).Should(Equal(http.StatusOK))
+		}
+	})
+
+	Describe("configuration", func() {
+
+		It("should not allow negative rates", func() {
+			conf := &RateLimitConfig{ReadRate: -1}
+			Ω(conf.Validate()).Should(MatchError("Improperly configured: rate limits cannot be negative."))
+		})
+
+		It("should require a burst for limited requests", func() {
+			conf := &RateLimitConfig{WriteRate: 1}
+			Ω(conf.Validate()).Should(MatchError("Improperly configured: rate limit bursts must be at least 1."))
+
+			conf = new(RateLimitConfig)
+			conf.Defaults()
+			Ω(conf.Validate()).Should(Succeed())
+		})
+
+	})
+
+})
@@ -0,0 +1,128 @@
+// Statistics of the blobs in a storage directory for tuning chunking.
+
+package fluid
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+//===========================================================================
+// Storage Statistics
+//===========================================================================
+
+// StorageStats describes the distribution of blob sizes in a storage
+// directory and the shape of the directory tree the blobs are stored in.
+// Operators can compare the blob sizes to the configured block sizes to tune
+// the chunking parameters.
+type StorageStats struct {
+	Blobs      int     // The number of blobs in the storage directory
+	Bytes      uint64  // The total size of the blobs in bytes
+	Min        int64   // The size of the smallest blob
+	Median     int64   // The median blob size
+	P95        int64   // The 95th percentile blob size
+	Max        int64   // The size of the largest blob
+	Dirs       int     // The number of directories in the storage tree
+	MeanFanout float64 // The mean number of entries per directory
+	MaxFanout  int     // The largest number of entries in a directory
+}
+
+// StorageStatistics walks the storage directory and computes the statistics
+// of the blobs it contains. If no directory is specified then the configured
+// storage path is used.
+func StorageStatistics(dataDir string) (*StorageStats, error) {
+	if dataDir == "" {
+		dataDir = config.Storage.Path
+	}
+
+	stats := new(StorageStats)
+	sizes := make([]int64, 0)
+	fanout := make(map[string]int)
+
+	visit := func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		// Directories are walked before their entries, so start the count.
+		isBlob := !info.IsDir() && filepath.Ext(path) == BlobExt
+		if info.IsDir() {
+			fanout[path] = 0
+		}
+
+		// Count the directory or blob as an entry of its parent directory
+		if path != dataDir && (info.IsDir() || isBlob) {
+			fanout[filepath.Dir(path)]++
+		}
+
+		if isBlob {
+			sizes = append(sizes, info.Size())
+		}
+
+		return nil
+	}
+
+	if err := filepath.Walk(dataDir, visit); err != nil {
+		return nil, fmt.Errorf("could not compute statistics of %s: %s", dataDir, err.Error())
+	}
+
+	// Compute the size distribution
+	stats.Blobs = len(sizes)
+	if stats.Blobs > 0 {
+		sort.Sort(int64s(sizes))
+		for _, size := range sizes {
+			stats.Bytes += uint64(size)
+		}
+
+		stats.Min = sizes[0]
+		stats.Median = percentile(sizes, 0.5)
+		stats.P95 = percentile(sizes, 0.95)
+		stats.Max = sizes[len(sizes)-1]
+	}
+
+	// Compute the directory fanout
+	stats.Dirs = len(fanout)
+	total := 0
+	for _, count := range fanout {
+		total += count
+		if count > stats.MaxFanout {
+			stats.MaxFanout = count
+		}
+	}
+
+	if stats.Dirs > 0 {
+		stats.MeanFanout = float64(total) / float64(stats.Dirs)
+	}
+
+	return stats, nil
+}
+
+// String returns a pretty representation of the storage statistics.
+func (s *StorageStats) String() string {
+	output := fmt.Sprintf("%d blobs using %d bytes\n", s.Blobs, s.Bytes)
+	output += fmt.Sprintf("blob sizes: min %d, median %d, p95 %d, max %d\n", s.Min, s.Median, s.P95, s.Max)
+	output += fmt.Sprintf("%d directories with %0.2f mean and %d max fanout", s.Dirs, s.MeanFanout, s.MaxFanout)
+	return output
+}
+
+// Returns the nearest rank percentile of a sorted list of sizes.
+func percentile(sorted []int64, p float64) int64 {
+	rank := int(math.Ceil(p*float64(len(sorted)))) - 1
+	if rank < 0 {
+		rank = 0
+	}
+	if rank >= len(sorted) {
+		rank = len(sorted) - 1
+	}
+	return sorted[rank]
+}
+
+// Implements sort.Interface for a list of sizes.
+type int64s []int64
+
+func (s int64s) Len() int           { return len(s) }
+func (s int64s) Less(i, j int) bool { return s[i] < s[j] }
+func (s int64s) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
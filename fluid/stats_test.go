@@ -0,0 +1,96 @@
+package fluid_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "github.com/bbengfort/fluidfs/fluid"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("StorageStats", func() {
+
+	var err error
+	var dataDir string
+
+	BeforeEach(func() {
+		dataDir, err = ioutil.TempDir("", TempDirPrefix)
+		Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+	})
+
+	AfterEach(func() {
+		Ω(os.RemoveAll(dataDir)).Should(Succeed())
+	})
+
+	It("should report the statistics of an empty store", func() {
+		stats, err := StorageStatistics(dataDir)
+		Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+		Ω(stats.Blobs).Should(BeZero())
+		Ω(stats.Bytes).Should(BeZero())
+		Ω(stats.Dirs).Should(Equal(1))
+		Ω(stats.MaxFanout).Should(BeZero())
+	})
+
+	It("should report the size distribution and fanout of a store", func() {
+		// Create 20 blobs of 100 to 2000 bytes spread across 4 directories.
+		for i := 1; i <= 20; i++ {
+			dir := filepath.Join(dataDir, fmt.Sprintf("%02d", i%4))
+			Ω(os.MkdirAll(dir, 0755)).Should(Succeed())
+
+			path := filepath.Join(dir, fmt.Sprintf("blob%02d%s", i, BlobExt))
+			Ω(ioutil.WriteFile(path, make([]byte, i*100), 0644)).Should(Succeed())
+		}
+
+		// Files that are not blobs should be ignored.
+		Ω(ioutil.WriteFile(filepath.Join(dataDir, "README"), []byte("hello"), 0644)).Should(Succeed())
+
+		stats, err := StorageStatistics(dataDir)
+		Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+
+		Ω(stats.Blobs).Should(Equal(20))
+		Ω(stats.Bytes).Should(Equal(uint64(21000)))
+		Ω(stats.Min).Should(Equal(int64(100)))
+		Ω(stats.Median).Should(Equal(int64(1000)))
+		Ω(stats.P95).Should(Equal(int64(1900)))
+		Ω(stats.Max).Should(Equal(int64(2000)))
+
+		Ω(stats.Dirs).Should(Equal(5))
+		Ω(stats.MeanFanout).Should(Equal(4.8))
+		Ω(stats.MaxFanout).Should(Equal(5))
+
+		Ω(stats.String()).Should(ContainSubstring("20 blobs using 21000 bytes"))
+	})
+
+	It("should report the statistics of chunked blobs", func() {
+		conf := new(StorageConfig)
+		conf.Defaults()
+		conf.Chunking = FixedLengthChunking
+
+		data := []byte(randString(conf.BlockSize * 10))
+		chunker, err := NewChunker(data, conf)
+		Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+
+		count := 0
+		for chunker.Next() {
+			Ω(chunker.Chunk().(*Blob).Save(dataDir)).Should(Succeed())
+			count++
+		}
+
+		stats, err := StorageStatistics(dataDir)
+		Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+		Ω(stats.Blobs).Should(Equal(count))
+		Ω(stats.Bytes).Should(Equal(uint64(len(data))))
+		Ω(stats.Median).Should(Equal(int64(conf.BlockSize)))
+		Ω(stats.Max).Should(Equal(int64(conf.BlockSize)))
+	})
+
+	It("should return an error for a missing store", func() {
+		_, err := StorageStatistics(filepath.Join(dataDir, "missing"))
+		Ω(err).Should(HaveOccurred())
+	})
+
+})
@@ -0,0 +1,91 @@
+// Mechanisms for uploading files into a file system from the web API.
+
+package fluid
+
+import (
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"time"
+)
+
+//===========================================================================
+// File Uploads
+//===========================================================================
+
+// UploadedFile describes a file that was uploaded into the file system.
+type UploadedFile struct {
+	Name  string `json:"name" yaml:"name"`
+	Size  uint64 `json:"size" yaml:"size"`
+	Blobs int    `json:"blobs" yaml:"blobs"`
+}
+
+// Upload creates the file with the name in the directory at the path relative
+// to the root of the file system, or replaces the data of the file if it
+// already exists, reading the data from r. The blobs the data would be chunked
+// into with the storage configuration are counted, and the file is marked
+// dirty so that it is flushed.
+// Only the base of the name is used, so uploads cannot escape the directory.
+func (fs *FileSystem) Upload(path, name string, r io.Reader) (*UploadedFile, error) {
+	name = filepath.Base(name)
+	if name == "." || name == ".." || name == string(filepath.Separator) {
+		return nil, NewError(ErrInvalidRequest, "invalid file name '%s'", name)
+	}
+
+	if fs.readonly {
+		return nil, NewError(ErrInvalidRequest, "fluidfs://%s is read only", fs.mount.Prefix)
+	}
+
+	// Read the data before locking so that slow clients do not block the fs;
+	// the buffer becomes the data of the file rather than being copied.
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, WrapError(ErrInvalidRequest, err, "could not read upload of %s", name)
+	}
+
+	blobs, err := countBlobs(data, config.Storage)
+	if err != nil {
+		return nil, WrapError(ErrImproperlyConfigured, err, "could not chunk %s", name)
+	}
+
+	fs.Lock()
+	defer fs.Unlock()
+
+	if fs.quiesced {
+		return nil, NewError(ErrUnavailable, "fluidfs://%s is in maintenance mode", fs.mount.Prefix)
+	}
+
+	ent, err := fs.lookup(path)
+	if err != nil {
+		return nil, NewError(ErrNotFound, "%s", err.Error())
+	}
+
+	dir, ok := ent.(*Dir)
+	if !ok {
+		return nil, NewError(ErrNotFound, "%s: not a directory", path)
+	}
+
+	var file *File
+	if _, ent, ok := dir.entry(name); ok {
+		if file, ok = ent.(*File); !ok {
+			return nil, NewError(ErrInvalidRequest, "%s exists and is not a file", name)
+		}
+	} else {
+		file = new(File)
+		if err := file.Init(name, 0644&^fs.umask, dir, fs); err != nil {
+			return nil, WrapError(ErrDatabase, err, "could not create %s", name)
+		}
+		dir.insert(file.Name, file)
+		dir.Attrs.Mtime = time.Now()
+		fs.nfiles++
+		fs.publish(EventCreate, file.Path(), "")
+	}
+
+	file.replace(data)
+	file.Attrs.Mtime = time.Now()
+	file.dirty = true
+	fs.publish(EventWrite, file.Path(), "")
+
+	logger.Info("uploaded %d bytes to %q in %q", len(data), file.Name, dir.Path())
+	return &UploadedFile{Name: file.Name, Size: file.Attrs.Size, Blobs: blobs}, nil
+}
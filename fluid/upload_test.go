@@ -0,0 +1,88 @@
+package fluid_test
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"bazil.org/fuse"
+	"golang.org/x/net/context"
+
+	. "github.com/bbengfort/fluidfs/fluid"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Upload", func() {
+
+	var ctx context.Context
+	var fs *FileSystem
+	var root *Dir
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		fs = newFileSystem()
+		node, err := fs.Root()
+		Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+		root = node.(*Dir)
+	})
+
+	It("should create a file with the uploaded data", func() {
+		data := randString(64 * 1024)
+		info, err := fs.Upload("", "a.txt", strings.NewReader(data))
+		Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+		Ω(info.Name).Should(Equal("a.txt"))
+		Ω(info.Size).Should(Equal(uint64(len(data))))
+		Ω(info.Blobs).Should(BeNumerically(">", 1))
+
+		file, ok := root.Children["a.txt"].(*File)
+		Ω(ok).Should(BeTrue())
+		Ω(string(file.Data)).Should(Equal(data))
+		Ω(file.Attrs.Size).Should(Equal(uint64(len(data))))
+		Ω(file.Attrs.Mode).Should(Equal(os.FileMode(0644)))
+		Ω(file.Consistent()).Should(Succeed())
+		Ω(fs.Dirty()).Should(Equal(1))
+	})
+
+	It("should replace the data of an existing file", func() {
+		_, err := fs.Upload("", "a.txt", strings.NewReader(randString(8192)))
+		Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+
+		info, err := fs.Upload("", "a.txt", strings.NewReader("short"))
+		Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+		Ω(info.Size).Should(Equal(uint64(5)))
+
+		Ω(root.Children).Should(HaveLen(1))
+		file := root.Children["a.txt"].(*File)
+		Ω(string(file.Data)).Should(Equal("short"))
+		Ω(file.Consistent()).Should(Succeed())
+	})
+
+	It("should upload into a directory of the mount point", func() {
+		node, err := root.Mkdir(ctx, &fuse.MkdirRequest{Name: "docs", Mode: 0755})
+		Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+
+		_, err = fs.Upload("docs", "../../b.txt", strings.NewReader("hello"))
+		Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+
+		Ω(node.(*Dir).Children).Should(HaveKey("b.txt"))
+		Ω(root.Children).ShouldNot(HaveKey("b.txt"))
+	})
+
+	It("should not upload to a missing directory or over a directory", func() {
+		_, err := root.Mkdir(ctx, &fuse.MkdirRequest{Name: "docs", Mode: 0755})
+		Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+
+		_, err = fs.Upload("missing", "a.txt", strings.NewReader("hello"))
+		Ω(errors.Is(err, &Error{Code: ErrNotFound})).Should(BeTrue(), fmt.Sprintf("%s", err))
+
+		_, err = fs.Upload("", "docs", strings.NewReader("hello"))
+		Ω(errors.Is(err, &Error{Code: ErrInvalidRequest})).Should(BeTrue(), fmt.Sprintf("%s", err))
+
+		_, err = fs.Upload("", "", strings.NewReader("hello"))
+		Ω(err).Should(MatchError(ContainSubstring("invalid file name")))
+	})
+
+})
@@ -0,0 +1,83 @@
+// Computes logical and physical space usage of files in the file system.
+
+package fluid
+
+import (
+	"fmt"
+)
+
+//===========================================================================
+// Usage Reporting
+//===========================================================================
+
+// Usage describes the space used by a set of files. Logical bytes are the
+// sum of the sizes of the files, whereas physical bytes are the sum of the
+// sizes of the unique blobs the files are chunked into, so the difference
+// between them is the space saved by deduplication. Since files are held in
+// memory rather than stored as blobs, physical bytes are an estimate and not
+// the usage on disk.
+type Usage struct {
+	Files    int    // The number of files counted
+	Logical  uint64 // The sum of the file sizes in bytes
+	Physical uint64 // The sum of the unique blob sizes in bytes
+}
+
+// Ratio returns the deduplication ratio, the number of logical bytes stored
+// per physical byte. If there is no data, the ratio is 1.
+func (u *Usage) Ratio() float64 {
+	if u.Physical == 0 {
+		return 1.0
+	}
+	return float64(u.Logical) / float64(u.Physical)
+}
+
+// String returns a pretty representation of the usage.
+func (u *Usage) String() string {
+	return fmt.Sprintf(
+		"%d files use %d bytes, an estimated %d bytes as blobs (%0.2fx dedup)",
+		u.Files, u.Logical, u.Physical, u.Ratio(),
+	)
+}
+
+// Accumulates usage by chunking file data into blobs with the storage
+// configuration, counting the size of each unique blob only once.
+type usageCounter struct {
+	Usage
+	conf *StorageConfig      // Configuration used to chunk files into blobs
+	seen map[string]struct{} // Hashes of blobs that have been counted
+}
+
+// Create a usage counter with the storage configuration.
+func newUsageCounter(conf *StorageConfig) *usageCounter {
+	return &usageCounter{
+		conf: conf,
+		seen: make(map[string]struct{}),
+	}
+}
+
+// Add the file data to the usage.
+func (c *usageCounter) add(data []byte) error {
+	c.Files++
+	c.Logical += uint64(len(data))
+
+	if len(data) == 0 {
+		return nil
+	}
+
+	chunker, err := NewChunker(data, c.conf)
+	if err != nil {
+		return err
+	}
+
+	for chunker.Next() {
+		blob := chunker.Chunk().(*Blob)
+		if _, ok := c.seen[blob.Hash()]; ok {
+			continue
+		}
+
+		c.seen[blob.Hash()] = struct{}{}
+		c.Physical += uint64(blob.Size())
+	}
+
+	return nil
+}
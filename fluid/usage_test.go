@@ -0,0 +1,98 @@
+package fluid_test
+
+import (
+	"fmt"
+	"path/filepath"
+
+	. "github.com/bbengfort/fluidfs/fluid"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Usage", func() {
+
+	var fs *FileSystem
+	var root *Dir
+
+	BeforeEach(func() {
+		fs = newFileSystem()
+		node, err := fs.Root()
+		Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+		root = node.(*Dir)
+	})
+
+	It("should report a ratio of 1 with no data", func() {
+		usage := new(Usage)
+		Ω(usage.Ratio()).Should(Equal(1.0))
+	})
+
+	Describe("subtree usage", func() {
+
+		var data, other []byte
+
+		BeforeEach(func() {
+			data = []byte(randString(64 * 1024))
+			other = []byte(randString(32 * 1024))
+
+			// Create the tree /a.txt, /docs/b.txt, /docs/c.txt, /docs/sub/d.txt
+			// where a, b, and d are duplicates and c is unique.
+			docs := mkdir(root, "docs", 0755)
+			sub := mkdir(docs, "sub", 0755)
+			createFile(root, "a.txt", 0644, data)
+			createFile(docs, "b.txt", 0644, data)
+			createFile(docs, "c.txt", 0644, other)
+			createFile(sub, "d.txt", 0644, data)
+		})
+
+		It("should compute the usage of the entire file system", func() {
+			for _, path := range []string{"", "/", "."} {
+				logical, physical, err := fs.Usage(path)
+				Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+				Ω(logical).Should(Equal(uint64(3*len(data) + len(other))))
+				Ω(physical).Should(Equal(uint64(len(data) + len(other))))
+			}
+		})
+
+		It("should compute the usage of a subtree", func() {
+			logical, physical, err := fs.Usage("docs")
+			Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+			Ω(logical).Should(Equal(uint64(2*len(data) + len(other))))
+			Ω(physical).Should(Equal(uint64(len(data) + len(other))))
+
+			logical, physical, err = fs.Usage("/docs/sub/")
+			Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+			Ω(logical).Should(Equal(uint64(len(data))))
+			Ω(physical).Should(Equal(uint64(len(data))))
+		})
+
+		It("should compute the usage of a single file", func() {
+			logical, physical, err := fs.Usage("docs/c.txt")
+			Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+			Ω(logical).Should(Equal(uint64(len(other))))
+			Ω(physical).Should(Equal(uint64(len(other))))
+		})
+
+		It("should return an error for paths that do not exist", func() {
+			_, _, err := fs.Usage("missing")
+			Ω(err).Should(MatchError("missing: no such file or directory"))
+
+			_, _, err = fs.Usage("a.txt/b.txt")
+			Ω(err).Should(MatchError("a.txt/b.txt: not a directory"))
+		})
+
+		It("should find the file system mounted at a local path", func() {
+			table := &FuseFSTable{FuseFS: []*FileSystem{fs}}
+
+			fsc, rel, err := table.Find(filepath.Join(suiteDir, "mnt", "docs", "sub"))
+			Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+			Ω(fsc).Should(Equal(fs))
+			Ω(rel).Should(Equal("docs/sub"))
+
+			_, _, err = table.Find(filepath.Join(suiteDir, "mntx"))
+			Ω(err).Should(HaveOccurred())
+		})
+
+	})
+
+})
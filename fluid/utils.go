@@ -2,7 +2,15 @@
 
 package fluid
 
-import "strings"
+import (
+	"fmt"
+	"math/rand"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
 
 // Formatters for representing the date and time as a string.
 const (
@@ -102,3 +110,134 @@ func Blocks(value uint64) uint64 {
 
 	return blocks
 }
+
+//===========================================================================
+// File Helpers
+//===========================================================================
+
+// ExpandPath expands environment variables such as $HOME or ${FLUIDFS_DATA}
+// in the path, as well as a leading ~ to the home directory of the user, so
+// that paths in configuration files do not have to be written literally.
+func ExpandPath(path string) (string, error) {
+	path = os.ExpandEnv(path)
+	if path != "~" && !strings.HasPrefix(path, "~/") {
+		return path, nil
+	}
+
+	usr, err := user.Current()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(usr.HomeDir, path[1:]), nil
+}
+
+// Returns true if the path is the root directory or is inside of it. Both
+// paths should be absolute and cleaned.
+func pathWithin(root, path string) bool {
+	rel, err := filepath.Rel(root, path)
+	if err != nil {
+		return false
+	}
+	return rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// Resolve the symlinks in the absolute path. Since the path may not exist yet,
+// e.g. the target of an export, the symlinks are resolved in the deepest
+// existing directory and the rest of the path is joined to the result.
+func resolvePath(path string) string {
+	path = filepath.Clean(path)
+	rest := ""
+	for {
+		if real, err := filepath.EvalSymlinks(path); err == nil {
+			return filepath.Join(real, rest)
+		}
+
+		parent := filepath.Dir(path)
+		if parent == path {
+			return filepath.Join(path, rest)
+		}
+
+		rest = filepath.Join(filepath.Base(path), rest)
+		path = parent
+	}
+}
+
+// Write data to a temporary file in the same directory as path then rename
+// the temporary file to path, so that the file at path is either the old or
+// the new data but never partially written. The data is synced to disk before
+// the rename so that a crash cannot leave an incomplete file at path, and the
+// directory is synced after the rename so that the rename itself is durable.
+// The temporary file is hidden and does not share the extension of path, and
+// is created with perm, which is subject to the umask of the process.
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	dir, name := filepath.Split(path)
+	tmp, err := createTemp(dir, "."+name+".", perm)
+	if err != nil {
+		return err
+	}
+
+	// Clean up the temporary file if anything goes wrong.
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	return syncDir(dir)
+}
+
+// Create a new file in dir whose name starts with the prefix and ends with a
+// random suffix, as ioutil.TempFile does, but with the permissions perm, which
+// are subject to the umask, rather than 0600.
+func createTemp(dir, prefix string, perm os.FileMode) (*os.File, error) {
+	if dir == "" {
+		dir = "."
+	}
+
+	for i := 0; i < 10000; i++ {
+		path := filepath.Join(dir, prefix+strconv.FormatUint(uint64(rand.Uint32()), 10))
+		f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_EXCL, perm)
+		if os.IsExist(err) {
+			continue
+		}
+		return f, err
+	}
+
+	return nil, fmt.Errorf("could not create a temporary file in %s", dir)
+}
+
+// Sync the directory to disk so that the entries created in it, renamed into
+// it or removed from it survive a crash.
+func syncDir(dir string) error {
+	if dir == "" {
+		dir = "."
+	}
+
+	fobj, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+
+	if err := fobj.Sync(); err != nil {
+		fobj.Close()
+		return err
+	}
+	return fobj.Close()
+}
@@ -2,7 +2,11 @@
 
 package fluid
 
-import "fmt"
+import (
+	"fmt"
+	"sync"
+	"time"
+)
 
 //===========================================================================
 // Lamport Scalar Version Type
@@ -99,3 +103,91 @@ func (v *Version) GreaterEqual(o *Version) bool {
 	}
 	return v.Scalar >= o.Scalar
 }
+
+//===========================================================================
+// Hybrid Logical Clock Versions
+//===========================================================================
+
+// HybridLogicalBits is the number of low bits of a hybrid version scalar that
+// hold the logical counter; the high bits hold the wall time in milliseconds.
+const HybridLogicalBits = 16
+
+// HybridClock issues versions whose scalars are hybrid logical timestamps:
+// the wall clock time in milliseconds combined with a logical counter that
+// breaks ties and keeps the clock monotonic when the wall clock stalls or
+// goes backwards. Versions issued by a hybrid clock are ordered by real time
+// across replicas as long as their clocks are loosely synchronized, while
+// still compared with the same methods as Lamport scalar versions.
+//
+// Remote versions whose wall time is further ahead of the local clock than
+// the maximum skew are rejected, so that a replica with a bad clock cannot
+// drag the clocks of every other replica into the future.
+//
+// Hybrid versions are optional and the Lamport versions issued by Version.Next
+// remain the default. Files do not carry versions yet, so the replica does not
+// create a clock; replication should create one with the pid of the replica
+// and the max_clock_skew of the configuration.
+type HybridClock struct {
+	sync.Mutex
+	PID     uint             // The process id assigned to issued versions
+	MaxSkew time.Duration    // Maximum tolerated clock skew, 0 for no bound
+	Now     func() time.Time // The wall clock, replaceable for testing
+	latest  uint64           // The latest scalar issued or observed
+}
+
+// NewHybridClock creates a hybrid clock for the process that rejects remote
+// versions that are more than maxSkew ahead of the local wall clock.
+func NewHybridClock(pid uint, maxSkew time.Duration) *HybridClock {
+	return &HybridClock{PID: pid, MaxSkew: maxSkew, Now: time.Now}
+}
+
+// Next returns a new version that is greater than every version issued or
+// observed by the clock. If the wall clock has advanced then the logical
+// counter is reset, otherwise the counter is incremented.
+func (c *HybridClock) Next() *Version {
+	c.Lock()
+	defer c.Unlock()
+
+	if wall := c.wall(); wall > c.latest {
+		c.latest = wall
+	} else {
+		c.latest++
+	}
+
+	return &Version{c.PID, c.latest, c.latest}
+}
+
+// Update the clock with a version observed from another replica so that the
+// next version issued is greater than it. As with Version.Update, the latest
+// value of o is also set to the latest scalar of the clock. An error is
+// returned and neither is updated if the version is too far ahead of the
+// local wall clock.
+func (c *HybridClock) Update(o *Version) error {
+	c.Lock()
+	defer c.Unlock()
+
+	if c.MaxSkew > 0 {
+		bound := c.wall() + uint64(c.MaxSkew/time.Millisecond)<<HybridLogicalBits
+		if o.Scalar > bound {
+			skew := HybridTime(o).Sub(c.Now())
+			return fmt.Errorf("version %s is %s ahead of the local clock, exceeding the %s bound", o, skew, c.MaxSkew)
+		}
+	}
+
+	c.latest = MaxUInt64(c.latest, o.Scalar, o.Latest)
+	o.Latest = c.latest
+	return nil
+}
+
+// Compute the scalar of the current wall time with a zero logical counter.
+func (c *HybridClock) wall() uint64 {
+	ms := c.Now().UnixNano() / int64(time.Millisecond)
+	return uint64(ms) << HybridLogicalBits
+}
+
+// HybridTime returns the wall clock time of a version issued by a hybrid
+// clock, truncated to the millisecond.
+func HybridTime(v *Version) time.Time {
+	ms := int64(v.Scalar >> HybridLogicalBits)
+	return time.Unix(0, ms*int64(time.Millisecond))
+}
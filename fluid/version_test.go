@@ -2,6 +2,7 @@ package fluid_test
 
 import (
 	"fmt"
+	"time"
 
 	. "github.com/bbengfort/fluidfs/fluid"
 
@@ -233,4 +234,79 @@ var _ = Describe("Version", func() {
 		})
 	})
 
+	Describe("hybrid logical clocks", func() {
+
+		var now time.Time
+		var clock *HybridClock
+
+		BeforeEach(func() {
+			now = time.Date(2017, 4, 1, 12, 0, 0, 0, time.UTC)
+			clock = NewHybridClock(1, time.Second)
+			clock.Now = func() time.Time { return now }
+		})
+
+		It("should order versions by wall time", func() {
+			alpha := clock.Next()
+			Ω(HybridTime(alpha).Equal(now)).Should(BeTrue())
+
+			now = now.Add(time.Millisecond)
+			bravo := clock.Next()
+			Ω(HybridTime(bravo).Equal(now)).Should(BeTrue())
+			Ω(bravo.Greater(alpha)).Should(BeTrue())
+			Ω(bravo.PID).Should(Equal(uint(1)))
+		})
+
+		It("should be monotonic when the wall clock stalls or goes backwards", func() {
+			prev := clock.Next()
+			for i := 0; i < 100; i++ {
+				if i%10 == 0 {
+					now = now.Add(-50 * time.Millisecond)
+				}
+
+				next := clock.Next()
+				Ω(next.Greater(prev)).Should(BeTrue(), "%s is not greater than %s", next, prev)
+				prev = next
+			}
+		})
+
+		It("should issue versions after observed remote versions", func() {
+			remote := NewHybridClock(2, time.Second)
+			remote.Now = func() time.Time { return now.Add(500 * time.Millisecond) }
+
+			// The latest value of the observed version is updated as well
+			theirs := remote.Next()
+			theirs.Latest = 0
+			Ω(clock.Update(theirs)).Should(Succeed())
+			Ω(theirs.Latest).Should(Equal(theirs.Scalar))
+
+			ours := clock.Next()
+			Ω(ours.Greater(theirs)).Should(BeTrue())
+			Ω(HybridTime(ours).Equal(HybridTime(theirs))).Should(BeTrue())
+
+			// Once the local clock catches up the wall time is used again
+			now = now.Add(time.Second)
+			Ω(HybridTime(clock.Next()).Equal(now)).Should(BeTrue())
+		})
+
+		It("should reject remote versions beyond the skew bound", func() {
+			remote := NewHybridClock(2, 0)
+			remote.Now = func() time.Time { return now.Add(2 * time.Second) }
+
+			theirs := remote.Next()
+			latest := theirs.Latest
+			err := clock.Update(theirs)
+			Ω(err).Should(MatchError(ContainSubstring("ahead of the local clock")))
+			Ω(theirs.Latest).Should(Equal(latest))
+
+			// The clock is not dragged forward by the rejected version
+			Ω(HybridTime(clock.Next()).Equal(now)).Should(BeTrue())
+
+			// Without a bound the version is accepted
+			clock.MaxSkew = 0
+			Ω(clock.Update(theirs)).Should(Succeed())
+			Ω(clock.Next().Greater(theirs)).Should(BeTrue())
+		})
+
+	})
+
 })
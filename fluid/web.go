@@ -10,45 +10,202 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
+	"math"
+	"net"
 	"net/http"
-	"os"
-	"strconv"
+	"net/http/pprof"
+	"path/filepath"
 	"strings"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/gorilla/mux"
+	"gopkg.in/yaml.v2"
 )
 
 //===========================================================================
 // Web Types and Constants
 //===========================================================================
 
-// JSON is a helper type for the most generic json object decoded by the json
-// package, namely map[string]interface{}.
-type JSON map[string]interface{}
-
 // APIHandler is a function type that defines how C2SAPI handlers are to be
 // implemented. Functions of t his type are passed to the AddHandler() method
-// of the API so that they can be routed on.
-type APIHandler func(r *http.Request) (int, JSON, error)
+// of the API so that they can be routed on. The response should be one of
+// the typed response structs below, which is marshaled for the client.
+type APIHandler func(r *http.Request) (int, interface{}, error)
+
+// Streamer is a response that is written directly to the client rather than
+// marshaled, e.g. a download that is too large to buffer in memory. If an
+// APIHandler returns a Streamer, its headers are set before it is streamed.
+// The server write timeout does not apply to streams, which may take longer.
+type Streamer interface {
+	Header(h http.Header)     // Set the content type and other headers
+	Stream(w io.Writer) error // Write the body of the response
+}
 
 // Request Header Keys and Values
 const (
-	HeaderAcceptKey      = "Accept"
-	HeaderContentTypeKey = "Content-Type"
-	HeaderContentTypeVal = "application/json;charset=UTF-8"
-	HeaderVersionKey     = "X-FluidFS-Application"
-	HeaderVersionVal     = "FluidFS/v%s"
+	HeaderAcceptKey        = "Accept"
+	HeaderContentTypeKey   = "Content-Type"
+	HeaderContentTypeVal   = "application/json;charset=UTF-8"
+	HeaderVersionKey       = "X-FluidFS-Application"
+	HeaderVersionVal       = "FluidFS/v%s"
+	HeaderRequestIDKey     = "X-Request-ID"
+	HeaderAuthorizationKey = "Authorization"
+)
+
+// Content types that the API can respond with, negotiated by Accept header.
+const (
+	MediaTypeJSON = "application/json"
+	MediaTypeYAML = "application/yaml"
+	MediaTypeText = "text/plain"
 )
 
 // Define endpoint locations and names.
 const (
-	RootEndpoint   = "/"
-	StatusEndpoint = "/status"
-	MountEndpoint  = "/mounts"
+	RootEndpoint        = "/"
+	StatusEndpoint      = "/status"
+	MountEndpoint       = "/mounts"
+	FlushEndpoint       = "/flush"
+	FlushStatusEndpoint = "/flush/status"
+	HealthEndpoint      = "/healthz"
+	ReadyEndpoint       = "/readyz"
+	ProfilingEndpoint   = "/debug/pprof/"
+	UsageEndpoint       = "/usage"
+	ImportEndpoint      = "/import"
+	ExportEndpoint      = "/export"
+	DownloadEndpoint    = "/download"
+	FilesEndpoint       = "/files"
+	ReloadEndpoint      = "/fstab/reload"
+	EventsEndpoint      = "/events"
+	MaintenanceEndpoint = "/maintenance"
+	TreeEndpoint        = "/debug/tree"
 )
 
+//===========================================================================
+// API Requests and Responses
+//===========================================================================
+
+// StatusResponse reports the status of the server and its mount points.
+type StatusResponse struct {
+	Status    string `json:"status" yaml:"status"`
+	Timestamp string `json:"timestamp" yaml:"timestamp"`
+	Mounts    string `json:"mounts" yaml:"mounts"`
+	InFlight  int    `json:"inflight_requests" yaml:"inflight_requests"`
+	Queued    int    `json:"queued_requests" yaml:"queued_requests"`
+}
+
+// ProbeResponse is returned by the liveness and readiness probes.
+type ProbeResponse struct {
+	Status string `json:"status" yaml:"status"`
+}
+
+// MountRequest is posted to create a new mount point. The UID and GID are
+// pointers so that the handler can tell when they are missing, and are wider
+// than a MountPoint's so that the handler can reject out of range values.
+type MountRequest struct {
+	Path   string `json:"path" yaml:"path"`
+	Prefix string `json:"prefix" yaml:"prefix"`
+	UID    *int64 `json:"uid" yaml:"uid"`
+	GID    *int64 `json:"gid" yaml:"gid"`
+}
+
+// MountResponse returns the fstab definition of the created mount point.
+type MountResponse struct {
+	Mount string `json:"mount" yaml:"mount"`
+}
+
+// FlushResponse reports the number of files flushed and still dirty.
+type FlushResponse struct {
+	Flushed   int    `json:"flushed" yaml:"flushed"`
+	Dirty     int    `json:"dirty" yaml:"dirty"`
+	Timestamp string `json:"timestamp" yaml:"timestamp"`
+}
+
+// MaintenanceRequest is posted to enter or leave maintenance mode.
+type MaintenanceRequest struct {
+	Enabled bool `json:"enabled" yaml:"enabled"`
+}
+
+// MaintenanceResponse reports if the replica is in maintenance mode and the
+// number of files flushed on entering it.
+type MaintenanceResponse struct {
+	Enabled   bool   `json:"enabled" yaml:"enabled"`
+	Flushed   int    `json:"flushed" yaml:"flushed"`
+	Timestamp string `json:"timestamp" yaml:"timestamp"`
+}
+
+// UsageResponse reports the space used by the subtree at a path.
+type UsageResponse struct {
+	Path          string  `json:"path" yaml:"path"`
+	LogicalBytes  uint64  `json:"logical_bytes" yaml:"logical_bytes"`
+	PhysicalBytes uint64  `json:"physical_bytes" yaml:"physical_bytes"`
+	DedupRatio    float64 `json:"dedup_ratio" yaml:"dedup_ratio"`
+}
+
+// ImportRequest is posted to import a local directory tree on the replica
+// into the mount point with the prefix.
+type ImportRequest struct {
+	Source string `json:"source" yaml:"source"`
+	Prefix string `json:"prefix" yaml:"prefix"`
+}
+
+// ImportResponse reports the result of importing a directory tree.
+type ImportResponse struct {
+	Source  string `json:"source" yaml:"source"`
+	Prefix  string `json:"prefix" yaml:"prefix"`
+	Dirs    int    `json:"dirs" yaml:"dirs"`
+	Files   int    `json:"files" yaml:"files"`
+	Skipped int    `json:"skipped" yaml:"skipped"`
+	Ignored int    `json:"ignored" yaml:"ignored"`
+	Blobs   int    `json:"blobs" yaml:"blobs"`
+	Bytes   uint64 `json:"bytes" yaml:"bytes"`
+}
+
+// ExportRequest is posted to export the mount point with the prefix to a
+// local directory on the replica.
+type ExportRequest struct {
+	Prefix string `json:"prefix" yaml:"prefix"`
+	Target string `json:"target" yaml:"target"`
+}
+
+// ExportResponse reports the result of exporting a mount point.
+type ExportResponse struct {
+	Prefix string `json:"prefix" yaml:"prefix"`
+	Target string `json:"target" yaml:"target"`
+	Dirs   int    `json:"dirs" yaml:"dirs"`
+	Files  int    `json:"files" yaml:"files"`
+	Bytes  uint64 `json:"bytes" yaml:"bytes"`
+}
+
+// UploadResponse reports the files uploaded into a directory of a mount.
+type UploadResponse struct {
+	Prefix string          `json:"prefix" yaml:"prefix"`
+	Path   string          `json:"path" yaml:"path"`
+	Files  []*UploadedFile `json:"files" yaml:"files"`
+}
+
+// ReloadRequest is posted to reload the fstab, from the path if it is given
+// or otherwise from the path the fstab was loaded from.
+type ReloadRequest struct {
+	Path string `json:"path" yaml:"path"`
+}
+
+// ReloadResponse reports how the mount points were reconciled with the fstab.
+type ReloadResponse struct {
+	Path      string   `json:"path" yaml:"path"`
+	Mounted   []string `json:"mounted" yaml:"mounted"`
+	Unmounted []string `json:"unmounted" yaml:"unmounted"`
+	Unchanged []string `json:"unchanged" yaml:"unchanged"`
+	Failed    []string `json:"failed" yaml:"failed"`
+}
+
+// ErrorResponse is returned by any handler that returns an error.
+type ErrorResponse struct {
+	Code      int    `json:"code" yaml:"code"`
+	Error     string `json:"error" yaml:"error"`
+	ErrorCode int    `json:"error_code,omitempty" yaml:"error_code,omitempty"`
+}
+
 //===========================================================================
 // Stand-Alone C2S API and Web Server
 //===========================================================================
@@ -56,17 +213,65 @@ const (
 // C2SAPI implements the web server for the command, config, and status JSON
 // API that serves both a web interface and the command line client.
 type C2SAPI struct {
-	Router *mux.Router
+	Router    *mux.Router
+	Ready     func() error     // Returns an error if the replica is not ready
+	Security  *SecurityConfig  // Authentication required by API handlers
+	Limits    *RateLimitConfig // Per-client rate limits of API handlers
+	MaxUpload int64            // The largest upload request in bytes
+	limiter   *RateLimiter     // Limits the rate of requests by clients
 }
 
 // Init the C2SAPI with a hook to the server that the API wraps.
 func (api *C2SAPI) Init() error {
 	// Initialize the API
 	api.Router = mux.NewRouter().StrictSlash(true)
+	api.Ready = ready
+
+	// Authenticate API requests with the configured token
+	if api.Security == nil {
+		api.Security = new(SecurityConfig)
+		if config != nil && config.Security != nil {
+			api.Security = config.Security
+		}
+	}
+
+	// Limit the rate of API requests by each client
+	if api.Limits == nil {
+		api.Limits = new(RateLimitConfig)
+		if config != nil && config.Limits != nil {
+			api.Limits = config.Limits
+		}
+	}
+	api.limiter = NewRateLimiter(api.Limits)
+
+	// Limit the size of upload requests
+	if api.MaxUpload == 0 {
+		api.MaxUpload = DefaultMaxUploadSize
+		if config != nil && config.MaxUpload > 0 {
+			api.MaxUpload = config.MaxUpload
+		}
+	}
 
 	// Add handlers and routes
 	api.AddHandler(StatusEndpoint, api.StatusHandler)
 	api.AddHandler(MountEndpoint, api.MountHandler)
+	api.AddHandler(FlushEndpoint, api.FlushHandler)
+	api.AddHandler(FlushStatusEndpoint, api.FlushStatusHandler)
+	api.AddHandler(UsageEndpoint, api.UsageHandler)
+	api.AddHandler(ImportEndpoint, api.ImportHandler)
+	api.AddHandler(ExportEndpoint, api.ExportHandler)
+	api.AddHandler(DownloadEndpoint, api.DownloadHandler)
+	api.AddUploadHandler(FilesEndpoint, api.UploadHandler)
+	api.AddHandler(ReloadEndpoint, api.ReloadHandler)
+	api.AddHandler(EventsEndpoint, api.EventsHandler)
+	api.AddHandler(MaintenanceEndpoint, api.MaintenanceHandler)
+	api.AddPublicHandler(HealthEndpoint, api.HealthHandler)
+	api.AddPublicHandler(ReadyEndpoint, api.ReadyHandler)
+
+	// Add the profiling endpoints only if enabled in the configuration
+	if config != nil && config.EnableProfiling {
+		api.EnableProfiling()
+	}
 
 	// Add the static files service from the binary assets
 	api.Router.Handle(RootEndpoint, WebLogger(logger, http.FileServer(assetFS())))
@@ -75,167 +280,687 @@ func (api *C2SAPI) Init() error {
 	return nil
 }
 
+// EnableProfiling adds the net/http/pprof endpoints and the directory tree
+// debugging endpoint to the API router. These expose internal details of the
+// process, so they are not added by default and require the API token.
+func (api *C2SAPI) EnableProfiling() {
+	api.AddHandler(TreeEndpoint, api.TreeHandler)
+	// Profiles expose the process, so they are authenticated like the API
+	protect := func(inner http.HandlerFunc) http.Handler {
+		return WebLogger(logger, api.limiter.Limit(Authenticate(api.Security, inner)))
+	}
+
+	api.Router.Handle(ProfilingEndpoint+"cmdline", protect(pprof.Cmdline))
+	api.Router.Handle(ProfilingEndpoint+"profile", protect(pprof.Profile))
+	api.Router.Handle(ProfilingEndpoint+"symbol", protect(pprof.Symbol))
+	api.Router.Handle(ProfilingEndpoint+"trace", protect(pprof.Trace))
+	api.Router.PathPrefix(ProfilingEndpoint).Handler(protect(pprof.Index))
+	logger.Warn("profiling endpoints enabled at %s", ProfilingEndpoint)
+}
+
+// Handler returns the router wrapped with the CORS middleware so that only
+// the origins allowed by the configuration can call the API from a browser.
+func (api *C2SAPI) Handler() http.Handler {
+	if config == nil || config.CORS == nil {
+		return api.Router
+	}
+	return CORS(config.CORS, api.Router)
+}
+
 // Run the API at the specified address.
 func (api *C2SAPI) Run(addr string, echan chan error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		echan <- fmt.Errorf("C2S API error: %s", err.Error())
+		return
+	}
+
+	api.Serve(ln, echan)
+}
+
+// Serve the API on a listener that has already been bound, e.g. so that the
+// resolved address can be written to the PID file before requests arrive.
+func (api *C2SAPI) Serve(ln net.Listener, echan chan error) {
 
 	// Create the HTTP server
 	srv := &http.Server{
-		Handler:      api.Router,
-		Addr:         addr,
+		Handler:      api.Handler(),
 		WriteTimeout: 10 * time.Second,
 		ReadTimeout:  10 * time.Second,
 	}
 
 	// Report the server status
-	logger.Info("starting C2S API and web interface at http://%s/", addr)
+	logger.Info("starting C2S API and web interface at http://%s/", ln.Addr())
 
-	// Listen and Serve
-	if err := srv.ListenAndServe(); err != nil {
+	// Serve until the listener is closed
+	if err := srv.Serve(ln); err != nil {
 		echan <- fmt.Errorf("C2S API error: %s", err.Error())
 	}
 }
 
-// AddHandler adds the specified handler to the API.
-// TODO: Simply this function and decouple various optional methods.
+// AddHandler adds the specified handler to the API, limiting the rate of
+// requests by each client and requiring requests to be authenticated if a
+// token is set in the security configuration.
 func (api *C2SAPI) AddHandler(path string, inner APIHandler) {
-	outer := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	handler := WebLogger(logger, api.limiter.Limit(Authenticate(api.Security, api.handler(inner))))
+	api.Router.Handle(path, handler)
+}
+
+// AddUploadHandler adds the specified handler to the API like AddHandler for
+// requests with large bodies. The server read timeout is cleared for these
+// requests since a large upload can take longer to arrive; instead the body
+// is limited to the maximum upload size.
+func (api *C2SAPI) AddUploadHandler(path string, inner APIHandler) {
+	handler := WebLogger(logger, api.limiter.Limit(Authenticate(api.Security, limitBody(api.MaxUpload, api.handler(inner)))))
+	api.Router.Handle(path, handler)
+}
+
+// AddPublicHandler adds the specified handler to the API without requiring
+// authentication, e.g. for liveness and readiness probes.
+func (api *C2SAPI) AddPublicHandler(path string, inner APIHandler) {
+	handler := WebLogger(logger, api.handler(inner))
+	api.Router.Handle(path, handler)
+}
+
+// Clears the read deadline of the request and limits its body to max bytes.
+func limitBody(max int64, inner http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := http.NewResponseController(w).SetReadDeadline(time.Time{}); err != nil && !errors.Is(err, http.ErrNotSupported) {
+			logger.Warn("could not clear the read deadline of %s: %s", r.URL.Path, err.Error())
+		}
+
+		r.Body = http.MaxBytesReader(w, r.Body, max)
+		inner.ServeHTTP(w, r)
+	})
+}
+
+// Wraps an APIHandler to marshal its response or error for the client.
+// TODO: Simply this function and decouple various optional methods.
+func (api *C2SAPI) handler(inner APIHandler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		code, data, err := inner(r)
 
-		// Handle errors
+		// Handle errors, using the status of fluid errors unless one is set
 		if err != nil {
+			resp := &ErrorResponse{Error: err.Error()}
+			if ferr, ok := err.(*Error); ok {
+				if code == 0 {
+					code = ferr.Status()
+				}
+				resp.ErrorCode = ferr.Code
+				resp.Error = ferr.Message
+			}
+
+			// Report request bodies over the limit even if the error is wrapped
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				code = http.StatusRequestEntityTooLarge
+				resp.Error = fmt.Sprintf("request body is larger than the limit of %d bytes", tooLarge.Limit)
+			}
+
 			if code == 0 {
 				code = http.StatusInternalServerError
 			}
 
-			// Make the data a JSON error representation.
-			data = make(JSON)
-			data["code"] = strconv.Itoa(code)
-			data["error"] = err.Error()
+			// Make the data an error representation.
+			resp.Code = code
+			data = resp
 		}
 
-		// Otherwise respond to the request
-		w.Header().Set(HeaderContentTypeKey, HeaderContentTypeVal)
-		w.WriteHeader(code)
+		// Write streamed responses directly, errors cannot be reported once
+		// the status has been written so they are only logged.
+		if stream, ok := data.(Streamer); ok {
+			if err := http.NewResponseController(w).SetWriteDeadline(time.Time{}); err != nil && !errors.Is(err, http.ErrNotSupported) {
+				logger.Warn("could not clear the write deadline of %s: %s", r.URL.Path, err.Error())
+			}
 
-		// Write the responde data as JSON to the stream
-		if err := json.NewEncoder(w).Encode(data); err != nil {
+			stream.Header(w.Header())
+			w.WriteHeader(code)
+			if err := stream.Stream(w); err != nil {
+				logger.Error("could not stream response to %s: %s", r.URL.Path, err.Error())
+			}
+			return
+		}
+
+		// Marshal the response in the format requested by the client
+		ctype, body, err := marshalResponse(r.Header.Get(HeaderAcceptKey), data)
+		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
 		}
-	})
 
-	handler := WebLogger(logger, outer)
-	api.Router.Handle(path, handler)
+		// Otherwise respond to the request
+		w.Header().Set(HeaderContentTypeKey, ctype)
+		w.WriteHeader(code)
+		w.Write(body)
+	})
 }
 
 //===========================================================================
 // API Handlers
 //===========================================================================
 
-// StatusHandler returns the status command information.
-func (api *C2SAPI) StatusHandler(r *http.Request) (int, JSON, error) {
-	data := make(JSON)
-	data["status"] = "ok"
-	data["timestamp"] = time.Now().Format(JSONDateTime)
-	data["mounts"] = fstab.Status()
-	return http.StatusOK, data, nil
+// StatusHandler returns the status command information. Space usage is not
+// reported since it requires chunking every file; see UsageHandler.
+func (api *C2SAPI) StatusHandler(r *http.Request) (int, interface{}, error) {
+	res := &StatusResponse{
+		Status:    "ok",
+		Timestamp: time.Now().Format(JSONDateTime),
+		Mounts:    fstab.Status(),
+	}
+
+	// Report the depth of the FUSE request queue if a file system is running
+	if limiter != nil {
+		res.InFlight = limiter.InFlight()
+		res.Queued = limiter.Queued()
+	}
+
+	return http.StatusOK, res, nil
+}
+
+// HealthHandler is a liveness probe that returns ok if the process is up.
+func (api *C2SAPI) HealthHandler(r *http.Request) (int, interface{}, error) {
+	return http.StatusOK, &ProbeResponse{Status: "ok"}, nil
+}
+
+// ReadyHandler is a readiness probe that returns ok only once the database
+// is open and all of the mount points are mounted.
+func (api *C2SAPI) ReadyHandler(r *http.Request) (int, interface{}, error) {
+	if err := api.Ready(); err != nil {
+		return http.StatusServiceUnavailable, nil, err
+	}
+	return http.StatusOK, &ProbeResponse{Status: "ready"}, nil
 }
 
 // MountHandler accepts POST data for the mount command and creates a new
 // MountPoint, then saves the fstable to disk, returning success or error.
 // TODO: Make this a fully formed RESTful API. See #39
 // TODO: Unhack this!
-func (api *C2SAPI) MountHandler(r *http.Request) (int, JSON, error) {
+func (api *C2SAPI) MountHandler(r *http.Request) (int, interface{}, error) {
 	// Parse the JSON data from the request
-	req, err := readRequestJSON(r)
-	if err != nil {
-		return http.StatusInternalServerError, nil, err
+	req := new(MountRequest)
+	if err := readRequestJSON(r, req); err != nil {
+		return http.StatusBadRequest, nil, err
 	}
 
-	var (
-		path   string
-		prefix string
-		uid    float64
-		gid    float64
-		ok     bool
-	)
-	fmt.Println(req)
-
 	// Validate the passed in arguments
-	if path, ok = req["path"].(string); !ok {
+	if req.Path == "" {
 		return http.StatusBadRequest, nil, errors.New("missing required path argument")
 	}
 
-	if prefix, ok = req["prefix"].(string); !ok {
+	if req.Prefix == "" {
 		return http.StatusBadRequest, nil, errors.New("missing required prefix argument")
 	}
 
-	if uid, ok = req["uid"].(float64); !ok {
-		return http.StatusBadRequest, nil, errors.New("missing required uid argument")
-	}
-
-	if gid, ok = req["gid"].(float64); !ok {
-		return http.StatusBadRequest, nil, errors.New("missing required gid argument")
-	}
-
-	info, err := os.Stat(path)
-	if os.IsNotExist(err) {
-		return http.StatusBadRequest, nil, fmt.Errorf("mount path '%s' does not exist", path)
-	}
-
-	if !info.IsDir() {
-		return http.StatusBadRequest, nil, fmt.Errorf("mount path '%s' is not a directory", path)
+	uid, err := parseID("uid", req.UID)
+	if err != nil {
+		return http.StatusBadRequest, nil, err
 	}
 
-	if strings.HasPrefix(prefix, "/") {
-		return http.StatusBadRequest, nil, errors.New("prefix cannot start with '/'")
+	gid, err := parseID("gid", req.GID)
+	if err != nil {
+		return http.StatusBadRequest, nil, err
 	}
 
-	// Create the mount point now that we've validated it (more or less)
+	// Create the mount point and validate its path and prefix
 	mp := &MountPoint{
 		UUID:      uuid.New(),
-		Path:      path,
-		Prefix:    prefix,
-		UID:       uint32(uid),
-		GID:       uint32(gid),
+		Path:      req.Path,
+		Prefix:    req.Prefix,
+		UID:       uid,
+		GID:       gid,
 		Store:     true,
 		Replicate: true,
 		Comments:  make([]string, 0, 0),
 		Options:   []string{"defaults"},
 	}
 
+	if err := mp.Validate(); err != nil {
+		return http.StatusBadRequest, nil, err
+	}
+
 	// Add the mount point to the fs table.
 	if err := fstab.AddMountPoint(mp); err != nil {
 		return http.StatusInternalServerError, nil, err
 	}
 
 	// Return the response with the created mount point
-	data := make(JSON)
-	data["mount"] = mp.String()
-	return http.StatusOK, data, nil
+	return http.StatusOK, &MountResponse{Mount: mp.String()}, nil
+}
+
+// FlushStatusHandler returns the number of files across all mounts that
+// have data which has not yet been flushed.
+func (api *C2SAPI) FlushStatusHandler(r *http.Request) (int, interface{}, error) {
+	if r.Method != http.MethodGet {
+		return http.StatusMethodNotAllowed, nil, fmt.Errorf("method %s not allowed", r.Method)
+	}
+
+	return http.StatusOK, &FlushResponse{
+		Dirty:     fstab.Dirty(),
+		Timestamp: time.Now().Format(JSONDateTime),
+	}, nil
+}
+
+// FlushHandler accepts a POST request to force a flush of all mounts and
+// returns the number of files flushed once the flush is complete.
+func (api *C2SAPI) FlushHandler(r *http.Request) (int, interface{}, error) {
+	if r.Method != http.MethodPost {
+		return http.StatusMethodNotAllowed, nil, fmt.Errorf("method %s not allowed", r.Method)
+	}
+
+	flushed := fstab.Flush()
+	return http.StatusOK, &FlushResponse{
+		Flushed:   flushed,
+		Dirty:     fstab.Dirty(),
+		Timestamp: time.Now().Format(JSONDateTime),
+	}, nil
+}
+
+// MaintenanceHandler returns if the replica is in maintenance mode on GET and
+// enters or leaves maintenance mode on POST. Entering maintenance mode flushes
+// all mounts, then rejects modifications until maintenance mode is left so
+// that the replica can be safely backed up or migrated.
+func (api *C2SAPI) MaintenanceHandler(r *http.Request) (int, interface{}, error) {
+	switch r.Method {
+	case http.MethodGet:
+		return http.StatusOK, &MaintenanceResponse{
+			Enabled:   fstab.Maintenance(),
+			Timestamp: time.Now().Format(JSONDateTime),
+		}, nil
+	case http.MethodPost:
+		req := new(MaintenanceRequest)
+		if err := readRequestJSON(r, req); err != nil {
+			return http.StatusBadRequest, nil, err
+		}
+
+		flushed := fstab.SetMaintenance(req.Enabled)
+		return http.StatusOK, &MaintenanceResponse{
+			Enabled:   req.Enabled,
+			Flushed:   flushed,
+			Timestamp: time.Now().Format(JSONDateTime),
+		}, nil
+	default:
+		return http.StatusMethodNotAllowed, nil, fmt.Errorf("method %s not allowed", r.Method)
+	}
+}
+
+// UsageHandler returns the space used by the subtree at the local path in
+// the path query parameter, which must be inside of a mount point. The
+// physical bytes are an estimate computed by chunking the data of the files.
+func (api *C2SAPI) UsageHandler(r *http.Request) (int, interface{}, error) {
+	if r.Method != http.MethodGet {
+		return http.StatusMethodNotAllowed, nil, fmt.Errorf("method %s not allowed", r.Method)
+	}
+
+	path := r.URL.Query().Get("path")
+	if path == "" {
+		return http.StatusBadRequest, nil, errors.New("missing required path argument")
+	}
+
+	fsc, rel, err := fstab.Find(path)
+	if err != nil {
+		return http.StatusNotFound, nil, err
+	}
+
+	logical, physical, err := fsc.Usage(rel)
+	if err != nil {
+		return http.StatusNotFound, nil, err
+	}
+
+	usage := &Usage{Logical: logical, Physical: physical}
+	return http.StatusOK, &UsageResponse{
+		Path:          path,
+		LogicalBytes:  logical,
+		PhysicalBytes: physical,
+		DedupRatio:    usage.Ratio(),
+	}, nil
+}
+
+// ImportHandler accepts a POST request to import a local directory tree into
+// the mount point with the prefix and returns the counts once it is complete.
+// The source must be allowed by the security configuration and cannot be in
+// any fluidfs mount point.
+func (api *C2SAPI) ImportHandler(r *http.Request) (int, interface{}, error) {
+	if r.Method != http.MethodPost {
+		return http.StatusMethodNotAllowed, nil, fmt.Errorf("method %s not allowed", r.Method)
+	}
+
+	req := new(ImportRequest)
+	if err := readRequestJSON(r, req); err != nil {
+		return http.StatusBadRequest, nil, err
+	}
+
+	if req.Source == "" {
+		return http.StatusBadRequest, nil, errors.New("missing required source argument")
+	}
+
+	if req.Prefix == "" {
+		return http.StatusBadRequest, nil, errors.New("missing required prefix argument")
+	}
+
+	if !filepath.IsAbs(req.Source) {
+		return http.StatusBadRequest, nil, fmt.Errorf("source '%s' is not an absolute path", req.Source)
+	}
+
+	fsc, err := fstab.Prefix(req.Prefix)
+	if err != nil {
+		return http.StatusNotFound, nil, err
+	}
+
+	if err := api.Security.AllowTransfer(req.Source); err != nil {
+		return http.StatusForbidden, nil, err
+	}
+
+	if mount, _, err := fstab.Find(resolvePath(req.Source)); err == nil {
+		return http.StatusBadRequest, nil, fmt.Errorf("cannot import %s: it is in fluidfs://%s", req.Source, mount.mount.Prefix)
+	}
+
+	report, err := fsc.ImportTree(req.Source)
+	if err != nil {
+		return http.StatusBadRequest, nil, err
+	}
+
+	return http.StatusOK, &ImportResponse{
+		Source:  req.Source,
+		Prefix:  req.Prefix,
+		Dirs:    report.Dirs,
+		Files:   report.Files,
+		Skipped: report.Skipped,
+		Ignored: report.Ignored,
+		Blobs:   report.Blobs,
+		Bytes:   report.Bytes,
+	}, nil
+}
+
+// ExportHandler accepts a POST request to export the mount point with the
+// prefix to a local directory and returns the counts once it is complete.
+// Since the export replaces local files, the target must be allowed by the
+// security configuration and cannot be in any fluidfs mount point.
+func (api *C2SAPI) ExportHandler(r *http.Request) (int, interface{}, error) {
+	if r.Method != http.MethodPost {
+		return http.StatusMethodNotAllowed, nil, fmt.Errorf("method %s not allowed", r.Method)
+	}
+
+	req := new(ExportRequest)
+	if err := readRequestJSON(r, req); err != nil {
+		return http.StatusBadRequest, nil, err
+	}
+
+	if req.Prefix == "" {
+		return http.StatusBadRequest, nil, errors.New("missing required prefix argument")
+	}
+
+	if req.Target == "" {
+		return http.StatusBadRequest, nil, errors.New("missing required target argument")
+	}
+
+	if !filepath.IsAbs(req.Target) {
+		return http.StatusBadRequest, nil, fmt.Errorf("target '%s' is not an absolute path", req.Target)
+	}
+
+	fsc, err := fstab.Prefix(req.Prefix)
+	if err != nil {
+		return http.StatusNotFound, nil, err
+	}
+
+	if err := api.Security.AllowTransfer(req.Target); err != nil {
+		return http.StatusForbidden, nil, err
+	}
+
+	if mount, _, err := fstab.Find(resolvePath(req.Target)); err == nil {
+		return http.StatusBadRequest, nil, fmt.Errorf("cannot export to %s: it is in fluidfs://%s", req.Target, mount.mount.Prefix)
+	}
+
+	report, err := fsc.ExportTree(req.Target)
+	if err != nil {
+		return http.StatusBadRequest, nil, err
+	}
+
+	return http.StatusOK, &ExportResponse{
+		Prefix: req.Prefix,
+		Target: req.Target,
+		Dirs:   report.Dirs,
+		Files:  report.Files,
+		Bytes:  report.Bytes,
+	}, nil
+}
+
+// DownloadHandler streams the subtree at the path query parameter of the
+// mount point with the prefix query parameter as an archive in the format
+// query parameter, either tar (the default) or zip. The path is relative to
+// the root of the mount point, which is downloaded if no path is given.
+func (api *C2SAPI) DownloadHandler(r *http.Request) (int, interface{}, error) {
+	if r.Method != http.MethodGet {
+		return http.StatusMethodNotAllowed, nil, fmt.Errorf("method %s not allowed", r.Method)
+	}
+
+	query := r.URL.Query()
+	prefix := query.Get("prefix")
+	if prefix == "" {
+		return http.StatusBadRequest, nil, errors.New("missing required prefix argument")
+	}
+
+	format := Regularize(query.Get("format"))
+	switch format {
+	case "":
+		format = ArchiveTar
+	case ArchiveTar, ArchiveZip:
+	default:
+		return http.StatusBadRequest, nil, fmt.Errorf("unknown archive format: '%s'", format)
+	}
+
+	fsc, err := fstab.Prefix(prefix)
+	if err != nil {
+		return http.StatusNotFound, nil, err
+	}
+
+	archive, err := fsc.Archive(query.Get("path"), format)
+	if err != nil {
+		return http.StatusNotFound, nil, err
+	}
+
+	return http.StatusOK, archive, nil
+}
+
+// UploadHandler accepts a multipart form POST of files to create or replace
+// in the directory at the path query parameter of the mount point with the
+// prefix query parameter. The parts are read one at a time as they arrive,
+// but each file is held in memory until it is stored, so the request is
+// limited to the maximum upload size; form fields that are not files are
+// ignored.
+func (api *C2SAPI) UploadHandler(r *http.Request) (int, interface{}, error) {
+	if r.Method != http.MethodPost {
+		return http.StatusMethodNotAllowed, nil, fmt.Errorf("method %s not allowed", r.Method)
+	}
+
+	query := r.URL.Query()
+	prefix := query.Get("prefix")
+	if prefix == "" {
+		return http.StatusBadRequest, nil, errors.New("missing required prefix argument")
+	}
+
+	fsc, err := fstab.Prefix(prefix)
+	if err != nil {
+		return http.StatusNotFound, nil, err
+	}
+
+	reader, err := r.MultipartReader()
+	if err != nil {
+		return http.StatusBadRequest, nil, err
+	}
+
+	res := &UploadResponse{Prefix: prefix, Path: query.Get("path"), Files: make([]*UploadedFile, 0)}
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			return http.StatusBadRequest, nil, err
+		}
+
+		if part.FileName() == "" {
+			part.Close()
+			continue
+		}
+
+		file, err := fsc.Upload(res.Path, part.FileName(), part)
+		part.Close()
+		if err != nil {
+			return 0, nil, err
+		}
+
+		res.Files = append(res.Files, file)
+	}
+
+	if len(res.Files) == 0 {
+		return http.StatusBadRequest, nil, errors.New("no files were uploaded")
+	}
+
+	return http.StatusOK, res, nil
+}
+
+// ReloadHandler accepts a POST request to reload the fstab without restarting,
+// mounting added mount points and unmounting removed ones.
+func (api *C2SAPI) ReloadHandler(r *http.Request) (int, interface{}, error) {
+	if r.Method != http.MethodPost {
+		return http.StatusMethodNotAllowed, nil, fmt.Errorf("method %s not allowed", r.Method)
+	}
+
+	req := new(ReloadRequest)
+	if err := readRequestJSON(r, req); err != nil {
+		return http.StatusBadRequest, nil, err
+	}
+
+	if req.Path != "" && !filepath.IsAbs(req.Path) {
+		return http.StatusBadRequest, nil, fmt.Errorf("fstab path '%s' is not an absolute path", req.Path)
+	}
+
+	report, err := fstab.Reload(req.Path)
+	if err != nil {
+		return http.StatusBadRequest, nil, err
+	}
+
+	return http.StatusOK, &ReloadResponse{
+		Path:      report.Path,
+		Mounted:   report.Mounted,
+		Unmounted: report.Unmounted,
+		Unchanged: report.Unchanged,
+		Failed:    report.Failed,
+	}, nil
+}
+
+// EventsHandler streams file system change events to the client as
+// Server-Sent Events until the client disconnects. The optional prefix query
+// parameter limits the stream to the events of a single mount point. The
+// server write timeout does not apply to the stream and keepalive comments
+// are written while it is idle so that it stays open.
+func (api *C2SAPI) EventsHandler(r *http.Request) (int, interface{}, error) {
+	if r.Method != http.MethodGet {
+		return http.StatusMethodNotAllowed, nil, fmt.Errorf("method %s not allowed", r.Method)
+	}
+
+	prefix := r.URL.Query().Get("prefix")
+	if prefix != "" {
+		if _, err := fstab.Prefix(prefix); err != nil {
+			return http.StatusNotFound, nil, err
+		}
+	}
+
+	return http.StatusOK, NewEventStream(r.Context(), events, prefix), nil
+}
+
+// TreeHandler returns the in-memory directory tree of the mount point with
+// the prefix in the prefix query parameter for debugging.
+func (api *C2SAPI) TreeHandler(r *http.Request) (int, interface{}, error) {
+	if r.Method != http.MethodGet {
+		return http.StatusMethodNotAllowed, nil, fmt.Errorf("method %s not allowed", r.Method)
+	}
+
+	prefix := r.URL.Query().Get("prefix")
+	if prefix == "" {
+		return http.StatusBadRequest, nil, errors.New("missing required prefix argument")
+	}
+
+	fsc, err := fstab.Prefix(prefix)
+	if err != nil {
+		return http.StatusNotFound, nil, err
+	}
+
+	return http.StatusOK, fsc.Tree(), nil
 }
 
 //===========================================================================
 // Helper functions
 //===========================================================================
 
-// Helper function to decode the JSON in an HTTP Request
-func readRequestJSON(r *http.Request) (JSON, error) {
+// Returns an error if the database is not open or the mounts are not ready.
+func ready() error {
+	if db == nil {
+		return errors.New("database is not open")
+	}
+
+	return fstab.Ready()
+}
+
+// Helper function to safely convert a uid or gid argument to a uint32,
+// returning an error if it is missing, negative, or out of range.
+func parseID(name string, id *int64) (uint32, error) {
+	if id == nil {
+		return 0, fmt.Errorf("missing required %s argument", name)
+	}
+
+	if *id < 0 || *id > math.MaxUint32 {
+		return 0, fmt.Errorf("%s %d is out of range", name, *id)
+	}
+
+	return uint32(*id), nil
+}
+
+// Helper function to marshal response data according to the Accept header.
+// Clients can request YAML or plain text (also YAML, which is more readable
+// than JSON), otherwise the data is marshaled as JSON. Returns the content
+// type of the response along with the marshaled data.
+func marshalResponse(accept string, data interface{}) (string, []byte, error) {
+	for _, mtype := range strings.Split(accept, ",") {
+		// Ignore any parameters such as the charset or quality
+		mtype = Regularize(strings.Split(mtype, ";")[0])
+
+		switch mtype {
+		case MediaTypeYAML, "application/x-yaml", "text/yaml":
+			body, err := yaml.Marshal(data)
+			return MediaTypeYAML + ";charset=UTF-8", body, err
+		case MediaTypeText:
+			body, err := yaml.Marshal(data)
+			return MediaTypeText + ";charset=UTF-8", body, err
+		case MediaTypeJSON, "*/*":
+			return marshalJSON(data)
+		}
+	}
+
+	return marshalJSON(data)
+}
+
+// Helper function to marshal response data as JSON.
+func marshalJSON(data interface{}) (string, []byte, error) {
+	body, err := json.Marshal(data)
+	return HeaderContentTypeVal, append(body, '\n'), err
+}
+
+// Helper function to decode the JSON in an HTTP Request into a typed request
+func readRequestJSON(r *http.Request, v interface{}) error {
 	// Read the data from the request stream (limit the size to 100 MB)
 	body, err := ioutil.ReadAll(io.LimitReader(r.Body, 104857600))
 	if err != nil {
-		return nil, err
+		return err
 	}
 
 	// Attempt to close the body of the request for reading
 	if err := r.Body.Close(); err != nil {
-		return nil, err
-	}
-
-	// Unmarshall the JSON data into a JSON data structure
-	var data JSON
-	if err := json.Unmarshal(body, &data); err != nil {
-		return nil, err
+		return err
 	}
 
-	return data, nil
+	// Unmarshall the JSON data into the request struct
+	return json.Unmarshal(body, v)
 }
@@ -0,0 +1,491 @@
+package fluid_test
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+
+	. "github.com/bbengfort/fluidfs/fluid"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Web", func() {
+
+	var api *C2SAPI
+
+	BeforeEach(func() {
+		api = new(C2SAPI)
+		Ω(api.Init()).Should(Succeed())
+	})
+
+	It("should report the status", func() {
+		code, data, err := api.StatusHandler(httptest.NewRequest(http.MethodGet, StatusEndpoint, nil))
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(code).Should(Equal(http.StatusOK))
+		Ω(data).Should(BeAssignableToTypeOf(new(StatusResponse)))
+		Ω(data.(*StatusResponse).Status).Should(Equal("ok"))
+	})
+
+	It("should report the flush status", func() {
+		req := httptest.NewRequest(http.MethodGet, FlushStatusEndpoint, nil)
+		code, data, err := api.FlushStatusHandler(req)
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(code).Should(Equal(http.StatusOK))
+		Ω(data.(*FlushResponse).Dirty).Should(BeZero())
+	})
+
+	It("should force a flush", func() {
+		req := httptest.NewRequest(http.MethodPost, FlushEndpoint, nil)
+		code, data, err := api.FlushHandler(req)
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(code).Should(Equal(http.StatusOK))
+		Ω(data.(*FlushResponse).Flushed).Should(BeZero())
+		Ω(data.(*FlushResponse).Dirty).Should(BeZero())
+	})
+
+	It("should only flush on POST", func() {
+		req := httptest.NewRequest(http.MethodGet, FlushEndpoint, nil)
+		code, _, err := api.FlushHandler(req)
+		Ω(err).Should(HaveOccurred())
+		Ω(code).Should(Equal(http.StatusMethodNotAllowed))
+
+		req = httptest.NewRequest(http.MethodPost, FlushStatusEndpoint, nil)
+		code, _, err = api.FlushStatusHandler(req)
+		Ω(err).Should(HaveOccurred())
+		Ω(code).Should(Equal(http.StatusMethodNotAllowed))
+	})
+
+	It("should enter and leave maintenance mode", func() {
+		post := func(enabled bool) *MaintenanceResponse {
+			body := strings.NewReader(fmt.Sprintf(`{"enabled": %t}`, enabled))
+			req := httptest.NewRequest(http.MethodPost, MaintenanceEndpoint, body)
+			req.Header.Set(HeaderContentTypeKey, MediaTypeJSON)
+			code, data, err := api.MaintenanceHandler(req)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(code).Should(Equal(http.StatusOK))
+			return data.(*MaintenanceResponse)
+		}
+
+		status := func() bool {
+			req := httptest.NewRequest(http.MethodGet, MaintenanceEndpoint, nil)
+			code, data, err := api.MaintenanceHandler(req)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(code).Should(Equal(http.StatusOK))
+			return data.(*MaintenanceResponse).Enabled
+		}
+
+		Ω(status()).Should(BeFalse())
+		Ω(post(true).Enabled).Should(BeTrue())
+		Ω(status()).Should(BeTrue())
+		Ω(post(false).Enabled).Should(BeFalse())
+		Ω(status()).Should(BeFalse())
+
+		req := httptest.NewRequest(http.MethodDelete, MaintenanceEndpoint, nil)
+		code, _, err := api.MaintenanceHandler(req)
+		Ω(err).Should(HaveOccurred())
+		Ω(code).Should(Equal(http.StatusMethodNotAllowed))
+	})
+
+	// Serve a GET request to the endpoint with the API router.
+	get := func(endpoint string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		api.Router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, endpoint, nil))
+		return w
+	}
+
+	It("should require a path inside a mount point for usage", func() {
+		w := get(UsageEndpoint)
+		Ω(w.Code).Should(Equal(http.StatusBadRequest))
+
+		w = get(UsageEndpoint + "?path=/not/a/mount")
+		Ω(w.Code).Should(Equal(http.StatusNotFound))
+		Ω(w.Body.String()).Should(ContainSubstring("is not in a fluidfs mount point"))
+	})
+
+	It("should require a source and a mount point prefix for import", func() {
+		code, _, err := api.ImportHandler(httptest.NewRequest(http.MethodGet, ImportEndpoint, nil))
+		Ω(err).Should(HaveOccurred())
+		Ω(code).Should(Equal(http.StatusMethodNotAllowed))
+
+		post := func(body string) (int, error) {
+			req := httptest.NewRequest(http.MethodPost, ImportEndpoint, strings.NewReader(body))
+			req.Header.Set("Content-Type", MediaTypeJSON)
+			code, _, err := api.ImportHandler(req)
+			return code, err
+		}
+
+		code, err = post(`{"prefix": "testing"}`)
+		Ω(err).Should(MatchError("missing required source argument"))
+		Ω(code).Should(Equal(http.StatusBadRequest))
+
+		code, err = post(`{"source": "/tmp"}`)
+		Ω(err).Should(MatchError("missing required prefix argument"))
+		Ω(code).Should(Equal(http.StatusBadRequest))
+
+		code, err = post(`{"source": "tmp", "prefix": "testing"}`)
+		Ω(err).Should(MatchError(ContainSubstring("is not an absolute path")))
+		Ω(code).Should(Equal(http.StatusBadRequest))
+
+		code, err = post(`{"source": "/tmp", "prefix": "missing"}`)
+		Ω(err).Should(MatchError("no mount point with prefix 'missing'"))
+		Ω(code).Should(Equal(http.StatusNotFound))
+	})
+
+	It("should require a mount point prefix and a target for export", func() {
+		code, _, err := api.ExportHandler(httptest.NewRequest(http.MethodGet, ExportEndpoint, nil))
+		Ω(err).Should(HaveOccurred())
+		Ω(code).Should(Equal(http.StatusMethodNotAllowed))
+
+		post := func(body string) (int, error) {
+			req := httptest.NewRequest(http.MethodPost, ExportEndpoint, strings.NewReader(body))
+			req.Header.Set("Content-Type", MediaTypeJSON)
+			code, _, err := api.ExportHandler(req)
+			return code, err
+		}
+
+		code, err = post(`{"target": "/tmp"}`)
+		Ω(err).Should(MatchError("missing required prefix argument"))
+		Ω(code).Should(Equal(http.StatusBadRequest))
+
+		code, err = post(`{"prefix": "testing"}`)
+		Ω(err).Should(MatchError("missing required target argument"))
+		Ω(code).Should(Equal(http.StatusBadRequest))
+
+		code, err = post(`{"prefix": "testing", "target": "tmp"}`)
+		Ω(err).Should(MatchError(ContainSubstring("is not an absolute path")))
+		Ω(code).Should(Equal(http.StatusBadRequest))
+
+		code, err = post(`{"prefix": "missing", "target": "/tmp"}`)
+		Ω(err).Should(MatchError("no mount point with prefix 'missing'"))
+		Ω(code).Should(Equal(http.StatusNotFound))
+	})
+
+	It("should require a mount point prefix and a known format for downloads", func() {
+		w := get(DownloadEndpoint)
+		Ω(w.Code).Should(Equal(http.StatusBadRequest))
+		Ω(w.Body.String()).Should(ContainSubstring("missing required prefix argument"))
+
+		w = get(DownloadEndpoint + "?prefix=testing&format=rar")
+		Ω(w.Code).Should(Equal(http.StatusBadRequest))
+		Ω(w.Body.String()).Should(ContainSubstring("unknown archive format: 'rar'"))
+
+		w = get(DownloadEndpoint + "?prefix=missing&format=zip")
+		Ω(w.Code).Should(Equal(http.StatusNotFound))
+	})
+
+	It("should require a mount point prefix and a multipart form for uploads", func() {
+		code, _, err := api.UploadHandler(httptest.NewRequest(http.MethodGet, FilesEndpoint, nil))
+		Ω(err).Should(HaveOccurred())
+		Ω(code).Should(Equal(http.StatusMethodNotAllowed))
+
+		code, _, err = api.UploadHandler(httptest.NewRequest(http.MethodPost, FilesEndpoint, nil))
+		Ω(err).Should(MatchError("missing required prefix argument"))
+		Ω(code).Should(Equal(http.StatusBadRequest))
+
+		code, _, err = api.UploadHandler(httptest.NewRequest(http.MethodPost, FilesEndpoint+"?prefix=missing", nil))
+		Ω(err).Should(MatchError("no mount point with prefix 'missing'"))
+		Ω(code).Should(Equal(http.StatusNotFound))
+	})
+
+	It("should limit the size of uploads", func() {
+		api = &C2SAPI{MaxUpload: 16}
+		Ω(api.Init()).Should(Succeed())
+		api.AddUploadHandler("/upload", func(r *http.Request) (int, interface{}, error) {
+			if _, err := ioutil.ReadAll(r.Body); err != nil {
+				return http.StatusBadRequest, nil, WrapError(ErrInvalidRequest, err, "could not read upload")
+			}
+			return http.StatusOK, nil, nil
+		})
+
+		w := httptest.NewRecorder()
+		api.Router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/upload", strings.NewReader(strings.Repeat("a", 16))))
+		Ω(w.Code).Should(Equal(http.StatusOK))
+
+		w = httptest.NewRecorder()
+		api.Router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/upload", strings.NewReader(strings.Repeat("a", 17))))
+		Ω(w.Code).Should(Equal(http.StatusRequestEntityTooLarge))
+		Ω(w.Body.String()).Should(ContainSubstring("request body is larger than the limit of 16 bytes"))
+	})
+
+	It("should not apply the server read timeout to uploads", func() {
+		api.AddUploadHandler("/upload", func(r *http.Request) (int, interface{}, error) {
+			data, err := ioutil.ReadAll(r.Body)
+			if err != nil {
+				return http.StatusBadRequest, nil, err
+			}
+			return http.StatusOK, map[string]int{"size": len(data)}, nil
+		})
+
+		srv := httptest.NewUnstartedServer(api.Router)
+		srv.Config.ReadTimeout = 100 * time.Millisecond
+		srv.Start()
+		defer srv.Close()
+
+		body, pw := io.Pipe()
+		go func() {
+			for i := 0; i < 3; i++ {
+				time.Sleep(75 * time.Millisecond)
+				pw.Write([]byte("part\n"))
+			}
+			pw.Close()
+		}()
+
+		rep, err := http.Post(srv.URL+"/upload", "text/plain", body)
+		Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+		defer rep.Body.Close()
+		Ω(rep.StatusCode).Should(Equal(http.StatusOK))
+	})
+
+	It("should require an absolute fstab path to reload", func() {
+		code, _, err := api.ReloadHandler(httptest.NewRequest(http.MethodGet, ReloadEndpoint, nil))
+		Ω(err).Should(HaveOccurred())
+		Ω(code).Should(Equal(http.StatusMethodNotAllowed))
+
+		req := httptest.NewRequest(http.MethodPost, ReloadEndpoint, strings.NewReader(`{"path": "fstab"}`))
+		code, _, err = api.ReloadHandler(req)
+		Ω(err).Should(MatchError("fstab path 'fstab' is not an absolute path"))
+		Ω(code).Should(Equal(http.StatusBadRequest))
+	})
+
+	It("should report liveness", func() {
+		w := get(HealthEndpoint)
+		Ω(w.Code).Should(Equal(http.StatusOK))
+		Ω(w.Body.String()).Should(MatchJSON(`{"status": "ok"}`))
+	})
+
+	It("should not be ready before the database is open", func() {
+		w := get(ReadyEndpoint)
+		Ω(w.Code).Should(Equal(http.StatusServiceUnavailable))
+		Ω(w.Body.String()).Should(ContainSubstring("database is not open"))
+	})
+
+	It("should only be ready once the mounts are up", func() {
+		mounted := false
+		api.Ready = func() error {
+			if !mounted {
+				return errors.New("fluidfs://testing is not mounted")
+			}
+			return nil
+		}
+
+		w := get(ReadyEndpoint)
+		Ω(w.Code).Should(Equal(http.StatusServiceUnavailable))
+
+		mounted = true
+		w = get(ReadyEndpoint)
+		Ω(w.Code).Should(Equal(http.StatusOK))
+		Ω(w.Body.String()).Should(MatchJSON(`{"status": "ready"}`))
+	})
+
+	It("should not be ready until file systems are mounted", func() {
+		table := &FuseFSTable{FuseFS: []*FileSystem{newFileSystem()}}
+		Ω(table.Ready()).Should(MatchError("fluidfs://testing is not mounted"))
+	})
+
+	Describe("typed requests and responses", func() {
+
+		// Serve a POST request with the JSON body to the endpoint.
+		post := func(endpoint, body string) *httptest.ResponseRecorder {
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodPost, endpoint, strings.NewReader(body))
+			api.Router.ServeHTTP(w, req)
+			return w
+		}
+
+		It("should decode numeric fields in a mount request", func() {
+			req := new(MountRequest)
+			data := `{"path": "/tmp", "prefix": "testing", "uid": 501, "gid": 20}`
+			Ω(json.Unmarshal([]byte(data), req)).Should(Succeed())
+			Ω(*req.UID).Should(Equal(int64(501)))
+			Ω(*req.GID).Should(Equal(int64(20)))
+		})
+
+		It("should not accept a non-integer uid in a mount request", func() {
+			w := post(MountEndpoint, `{"path": "/tmp", "prefix": "testing", "uid": 5.01, "gid": 20}`)
+			Ω(w.Code).Should(Equal(http.StatusBadRequest))
+		})
+
+		It("should require the uid and gid in a mount request", func() {
+			w := post(MountEndpoint, `{"path": "/tmp", "prefix": "testing", "gid": 20}`)
+			Ω(w.Code).Should(Equal(http.StatusBadRequest))
+
+			resp := new(ErrorResponse)
+			Ω(json.Unmarshal(w.Body.Bytes(), resp)).Should(Succeed())
+			Ω(resp.Code).Should(Equal(http.StatusBadRequest))
+			Ω(resp.Error).Should(Equal("missing required uid argument"))
+		})
+
+		It("should accept a valid uid and gid in a mount request", func() {
+			path := filepath.Join(suiteDir, "uidgid")
+			Ω(os.MkdirAll(path, 0755)).Should(Succeed())
+
+			data := `{"path": "%s", "prefix": "uidgid", "uid": 4294967295, "gid": 0}`
+			w := post(MountEndpoint, fmt.Sprintf(data, path))
+			Ω(w.Code).Should(Equal(http.StatusOK), w.Body.String())
+
+			resp := new(MountResponse)
+			Ω(json.Unmarshal(w.Body.Bytes(), resp)).Should(Succeed())
+			Ω(resp.Mount).Should(ContainSubstring("4294967295 0"))
+		})
+
+		It("should reject a negative uid or gid in a mount request", func() {
+			w := post(MountEndpoint, `{"path": "/tmp", "prefix": "testing", "uid": -1, "gid": 20}`)
+			Ω(w.Code).Should(Equal(http.StatusBadRequest))
+			Ω(w.Body.String()).Should(ContainSubstring("uid -1 is out of range"))
+
+			w = post(MountEndpoint, `{"path": "/tmp", "prefix": "testing", "uid": 501, "gid": -20}`)
+			Ω(w.Code).Should(Equal(http.StatusBadRequest))
+			Ω(w.Body.String()).Should(ContainSubstring("gid -20 is out of range"))
+		})
+
+		It("should reject an oversized uid or gid in a mount request", func() {
+			w := post(MountEndpoint, `{"path": "/tmp", "prefix": "testing", "uid": 4294967296, "gid": 20}`)
+			Ω(w.Code).Should(Equal(http.StatusBadRequest))
+			Ω(w.Body.String()).Should(ContainSubstring("uid 4294967296 is out of range"))
+
+			w = post(MountEndpoint, `{"path": "/tmp", "prefix": "testing", "uid": 501, "gid": 1e20}`)
+			Ω(w.Code).Should(Equal(http.StatusBadRequest))
+		})
+
+		It("should round trip a status response", func() {
+			w := get(StatusEndpoint)
+			Ω(w.Code).Should(Equal(http.StatusOK))
+
+			resp := new(StatusResponse)
+			Ω(json.Unmarshal(w.Body.Bytes(), resp)).Should(Succeed())
+			Ω(resp.Status).Should(Equal("ok"))
+		})
+
+	})
+
+	Describe("error responses", func() {
+
+		// Serve a request to a handler that returns the code and error.
+		serve := func(code int, err error) *httptest.ResponseRecorder {
+			api.AddHandler("/error", func(r *http.Request) (int, interface{}, error) {
+				return code, nil, err
+			})
+
+			w := httptest.NewRecorder()
+			api.Router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/error", nil))
+			return w
+		}
+
+		It("should respond with the status of fluid errors", func() {
+			w := serve(0, NewError(ErrNotFound, "no such file"))
+			Ω(w.Code).Should(Equal(http.StatusNotFound))
+			Ω(w.Body.String()).Should(MatchJSON(fmt.Sprintf(`{"code": 404, "error": "no such file", "error_code": %d}`, ErrNotFound)))
+		})
+
+		It("should prefer the status set by the handler", func() {
+			w := serve(http.StatusConflict, NewError(ErrInvalidRequest, "already mounted"))
+			Ω(w.Code).Should(Equal(http.StatusConflict))
+		})
+
+		It("should respond to other errors with an internal server error", func() {
+			w := serve(0, errors.New("something went wrong"))
+			Ω(w.Code).Should(Equal(http.StatusInternalServerError))
+			Ω(w.Body.String()).Should(MatchJSON(`{"code": 500, "error": "something went wrong"}`))
+		})
+
+	})
+
+	Describe("content negotiation", func() {
+
+		// Serve a status request with the specified Accept header.
+		status := func(accept string) *httptest.ResponseRecorder {
+			req := httptest.NewRequest(http.MethodGet, StatusEndpoint, nil)
+			if accept != "" {
+				req.Header.Set("Accept", accept)
+			}
+
+			w := httptest.NewRecorder()
+			api.Router.ServeHTTP(w, req)
+			Ω(w.Code).Should(Equal(http.StatusOK))
+			return w
+		}
+
+		It("should respond with JSON by default", func() {
+			for _, accept := range []string{"", "application/json", "*/*", "image/png"} {
+				w := status(accept)
+				Ω(w.Header().Get("Content-Type")).Should(Equal(HeaderContentTypeVal), accept)
+
+				data := make(map[string]interface{})
+				Ω(json.Unmarshal(w.Body.Bytes(), &data)).Should(Succeed())
+				Ω(data["status"]).Should(Equal("ok"))
+			}
+		})
+
+		It("should respond with YAML when requested", func() {
+			w := status("application/yaml")
+			Ω(w.Header().Get("Content-Type")).Should(HavePrefix(MediaTypeYAML))
+
+			data := make(map[string]interface{})
+			Ω(yaml.Unmarshal(w.Body.Bytes(), &data)).Should(Succeed())
+			Ω(data["status"]).Should(Equal("ok"))
+			Ω(w.Body.String()).ShouldNot(HavePrefix("{"))
+		})
+
+		It("should respond with plain text when requested", func() {
+			w := status("text/plain;q=0.9, application/json;q=0.5")
+			Ω(w.Header().Get("Content-Type")).Should(HavePrefix(MediaTypeText))
+			Ω(w.Body.String()).Should(ContainSubstring("status: ok\n"))
+		})
+
+	})
+
+	Describe("profiling", func() {
+
+		It("should not serve profiling endpoints by default", func() {
+			w := get(ProfilingEndpoint)
+			Ω(w.Code).Should(Equal(http.StatusNotFound))
+
+			w = get(ProfilingEndpoint + "goroutine")
+			Ω(w.Code).Should(Equal(http.StatusNotFound))
+		})
+
+		It("should not serve the directory tree by default", func() {
+			w := get(TreeEndpoint + "?prefix=testing")
+			Ω(w.Code).Should(Equal(http.StatusNotFound))
+		})
+
+		It("should serve the directory tree when enabled", func() {
+			api.EnableProfiling()
+
+			w := get(TreeEndpoint)
+			Ω(w.Code).Should(Equal(http.StatusBadRequest))
+
+			w = get(TreeEndpoint + "?prefix=missing")
+			Ω(w.Code).Should(Equal(http.StatusNotFound))
+			Ω(w.Body.String()).Should(ContainSubstring("no mount point with prefix 'missing'"))
+		})
+
+		It("should serve profiling endpoints when enabled", func() {
+			api.EnableProfiling()
+
+			w := get(ProfilingEndpoint)
+			Ω(w.Code).Should(Equal(http.StatusOK))
+
+			w = get(ProfilingEndpoint + "goroutine?debug=1")
+			Ω(w.Code).Should(Equal(http.StatusOK))
+			Ω(w.Body.String()).Should(ContainSubstring("goroutine profile"))
+
+			w = get(ProfilingEndpoint + "cmdline")
+			Ω(w.Code).Should(Equal(http.StatusOK))
+		})
+
+	})
+
+})
@@ -0,0 +1,223 @@
+// Interactive configuration wizard for first-run setup of FluidFS.
+
+package fluid
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+//===========================================================================
+// Configuration Wizard
+//===========================================================================
+
+// ConfigWizard prompts the user for the most important configuration values
+// on first run so that users do not have to write YAML by hand. Every answer
+// is checked by the configuration validation methods and the user is asked
+// again until a valid value (or the default, by entering nothing) is given.
+type ConfigWizard struct {
+	in  *bufio.Reader // Reads answers from the user
+	out io.Writer     // Writes prompts to the user
+}
+
+// NewConfigWizard creates a wizard that reads answers from in and writes
+// prompts to out, usually os.Stdin and os.Stdout respectively.
+func NewConfigWizard(in io.Reader, out io.Writer) *ConfigWizard {
+	return &ConfigWizard{
+		in:  bufio.NewReader(in),
+		out: out,
+	}
+}
+
+// Run the wizard, modifying the configuration with the user's answers. The
+// configuration should have its defaults set, which are used as the default
+// answers to each prompt. Nothing is created on disk until every answer has
+// been given and the user has agreed to create the storage directory.
+func (w *ConfigWizard) Run(conf *Config) error {
+	// The precedence id must be greater than zero.
+	pid := strconv.FormatUint(uint64(conf.PID), 10)
+	err := w.Prompt("Precedence ID (pid)", pid, func(val string) error {
+		pid, err := strconv.ParseUint(val, 10, 32)
+		if err != nil || pid == 0 {
+			return errors.New("the precedence id must be a number greater than 0")
+		}
+
+		conf.PID = uint(pid)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// The replica name cannot be empty.
+	err = w.Prompt("Replica name", conf.Name, func(val string) error {
+		if val == "" {
+			return errors.New("a replica name is required")
+		}
+
+		conf.Name = val
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// The storage path is checked but not created until the user confirms.
+	err = w.Prompt("Storage path", conf.Storage.Path, func(val string) error {
+		conf.Storage.Path = val
+		return conf.Storage.Check()
+	})
+	if err != nil {
+		return err
+	}
+
+	// The database driver must be one of the available drivers.
+	err = w.Prompt("Database driver", conf.Database.Driver, func(val string) error {
+		conf.Database.Driver = val
+		return conf.Database.Validate()
+	})
+	if err != nil {
+		return err
+	}
+
+	// The chunking method must be fixed or variable.
+	err = w.Prompt("Chunking method", conf.Storage.Chunking, func(val string) error {
+		conf.Storage.Chunking = val
+		return conf.Storage.Check()
+	})
+	if err != nil {
+		return err
+	}
+
+	// The hashing algorithm must be one of the available algorithms.
+	err = w.Prompt("Hashing algorithm", conf.Storage.Hashing, func(val string) error {
+		conf.Storage.Hashing = val
+		return conf.Storage.Check()
+	})
+	if err != nil {
+		return err
+	}
+
+	// The storage directory is only created if the user agrees.
+	if _, err := os.Stat(conf.Storage.Path); os.IsNotExist(err) {
+		ok, err := w.Confirm(fmt.Sprintf("create the storage directory at %s?", conf.Storage.Path))
+		if err != nil {
+			return err
+		}
+
+		if !ok {
+			return errors.New("configuration was not written")
+		}
+	}
+
+	// Finally validate the entire configuration, creating the storage directory.
+	return conf.Validate()
+}
+
+// Prompt the user for a value, using the default if no answer is given. The
+// answer is passed to the validate function; if it returns an error, the
+// error is shown and the user is prompted again.
+func (w *ConfigWizard) Prompt(label, defaultVal string, validate func(string) error) error {
+	for {
+		fmt.Fprintf(w.out, "%s [%s]: ", label, defaultVal)
+
+		val, err := w.readLine()
+		if err != nil {
+			return err
+		}
+
+		if val == "" {
+			val = defaultVal
+		}
+
+		if err := validate(val); err != nil {
+			fmt.Fprintf(w.out, "%s\n", err.Error())
+			continue
+		}
+
+		return nil
+	}
+}
+
+// Confirm prompts the user for a yes or no answer, defaulting to no.
+func (w *ConfigWizard) Confirm(question string) (bool, error) {
+	for {
+		fmt.Fprintf(w.out, "%s [y/N]: ", question)
+
+		val, err := w.readLine()
+		if err != nil {
+			return false, err
+		}
+
+		switch Regularize(val) {
+		case "y", "yes":
+			return true, nil
+		case "", "n", "no":
+			return false, nil
+		default:
+			fmt.Fprintln(w.out, "please answer yes or no")
+		}
+	}
+}
+
+// Read a line of input from the user with whitespace trimmed.
+func (w *ConfigWizard) readLine() (string, error) {
+	line, err := w.in.ReadString('\n')
+	if err != nil && (err != io.EOF || line == "") {
+		if err == io.EOF {
+			return "", errors.New("no input from the user")
+		}
+		return "", err
+	}
+
+	return strings.TrimSpace(line), nil
+}
+
+//===========================================================================
+// Package Wizard Helpers
+//===========================================================================
+
+// RunWizard prompts the user for a configuration starting from the defaults
+// and writes it to the specified path, or to the user's configuration path
+// if no path is given. If the configuration already exists, the user must
+// confirm that it should be overwritten. Returns the path written to.
+func RunWizard(path string, in io.Reader, out io.Writer) (string, error) {
+	conf := new(Config)
+	if err := conf.Defaults(); err != nil {
+		return "", err
+	}
+
+	if path == "" {
+		var err error
+		if path, err = conf.UserPath(); err != nil {
+			return "", err
+		}
+	}
+
+	wizard := NewConfigWizard(in, out)
+	if _, err := os.Stat(path); err == nil {
+		ok, err := wizard.Confirm(fmt.Sprintf("overwrite the configuration at %s?", path))
+		if err != nil {
+			return "", err
+		}
+
+		if !ok {
+			return "", errors.New("configuration was not written")
+		}
+	}
+
+	if err := wizard.Run(conf); err != nil {
+		return "", err
+	}
+
+	if err := conf.Write(path); err != nil {
+		return "", err
+	}
+
+	return path, nil
+}
@@ -0,0 +1,136 @@
+package fluid_test
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	. "github.com/bbengfort/fluidfs/fluid"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Wizard", func() {
+
+	var err error
+	var tempDir string
+	var path string
+	var out *bytes.Buffer
+
+	BeforeEach(func() {
+		tempDir, err = ioutil.TempDir("", TempDirPrefix)
+		Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+
+		path = filepath.Join(tempDir, "config.yml")
+		out = new(bytes.Buffer)
+	})
+
+	AfterEach(func() {
+		Ω(os.RemoveAll(tempDir)).Should(Succeed())
+	})
+
+	// Creates a script of answers to the wizard prompts.
+	script := func(answers ...string) *strings.Reader {
+		return strings.NewReader(strings.Join(answers, "\n") + "\n")
+	}
+
+	It("should write a valid configuration from the answers", func() {
+		storage := filepath.Join(tempDir, "data")
+		in := script("42", "alaska", storage, "leveldb", "fixed", "md5", "y")
+
+		written, err := RunWizard(path, in, out)
+		Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+		Ω(written).Should(Equal(path))
+
+		config := new(Config)
+		Ω(config.Read(path)).Should(Succeed())
+		Ω(config.Validate()).Should(Succeed())
+
+		Ω(config.PID).Should(Equal(uint(42)))
+		Ω(config.Name).Should(Equal("alaska"))
+		Ω(config.Storage.Path).Should(Equal(storage))
+		Ω(config.Database.Driver).Should(Equal("leveldb"))
+		Ω(config.Storage.Chunking).Should(Equal(FixedLengthChunking))
+		Ω(config.Storage.Hashing).Should(Equal(MD5))
+	})
+
+	It("should prompt again when an answer is invalid", func() {
+		storage := filepath.Join(tempDir, "data")
+		in := script("0", "42", "", "alaska", storage, "junodb", "boltdb", "cloudy", "variable", "protobob", "sha1", "y")
+
+		_, err := RunWizard(path, in, out)
+		Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+
+		Ω(out.String()).Should(ContainSubstring("the precedence id must be a number greater than 0"))
+		Ω(out.String()).Should(ContainSubstring("'junodb' is not a valid database driver"))
+		Ω(out.String()).Should(ContainSubstring("'cloudy' is not a valid chunking mechanism"))
+		Ω(out.String()).Should(ContainSubstring("'protobob' is not a valid hashing algorithm"))
+
+		config := new(Config)
+		Ω(config.Read(path)).Should(Succeed())
+		Ω(config.Validate()).Should(Succeed())
+		Ω(config.Storage.Hashing).Should(Equal(SHA1))
+	})
+
+	It("should use the defaults when no answer is given", func() {
+		storage := filepath.Join(tempDir, "data")
+		in := script("42", "alaska", storage, "", "", "", "y")
+
+		_, err := RunWizard(path, in, out)
+		Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+
+		config := new(Config)
+		Ω(config.Read(path)).Should(Succeed())
+		Ω(config.Database.Driver).Should(Equal("boltdb"))
+		Ω(config.Storage.Chunking).Should(Equal(VariableLengthChunking))
+		Ω(config.Storage.Hashing).Should(Equal(SHA256))
+	})
+
+	It("should return an error if the input ends early", func() {
+		storage := filepath.Join(tempDir, "data")
+		_, err := RunWizard(path, script("42", "alaska", storage, "", ""), out)
+		Ω(err).Should(HaveOccurred())
+
+		exists, _ := pathExists(path)
+		Ω(exists).Should(BeFalse())
+
+		exists, _ = pathExists(storage)
+		Ω(exists).Should(BeFalse(), "storage directory created before confirmation")
+	})
+
+	It("should not create the storage directory without confirmation", func() {
+		storage := filepath.Join(tempDir, "data")
+		_, err := RunWizard(path, script("42", "alaska", storage, "", "", "", "n"), out)
+		Ω(err).Should(MatchError("configuration was not written"))
+
+		exists, _ := pathExists(storage)
+		Ω(exists).Should(BeFalse())
+
+		exists, _ = pathExists(path)
+		Ω(exists).Should(BeFalse())
+	})
+
+	It("should not overwrite a configuration without confirmation", func() {
+		Ω(ioutil.WriteFile(path, []byte("pid: 1\n"), 0644)).Should(Succeed())
+
+		_, err := RunWizard(path, script("n"), out)
+		Ω(err).Should(HaveOccurred())
+
+		data, err := ioutil.ReadFile(path)
+		Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+		Ω(string(data)).Should(Equal("pid: 1\n"))
+
+		storage := filepath.Join(tempDir, "data")
+		_, err = RunWizard(path, script("yes", "42", "alaska", storage, "", "", "", "y"), out)
+		Ω(err).Should(BeNil(), fmt.Sprintf("%s", err))
+
+		config := new(Config)
+		Ω(config.Read(path)).Should(Succeed())
+		Ω(config.PID).Should(Equal(uint(42)))
+	})
+
+})